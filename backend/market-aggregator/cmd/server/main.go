@@ -2,19 +2,35 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	// IANA zones for the klines timeZone parameter, even without system tzdata
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/candles"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/config"
 	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/handler"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/orderbook"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/rediscache"
 	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/service"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/stream"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/tracing"
 	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
 	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -24,100 +40,279 @@ func main() {
 	zerolog.TimeFieldFormat = time.RFC3339
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-	// Get port from environment
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Load configuration from the defaults, the config file, the environment
+	// and flags, each overriding the last
+	loader, err := config.NewLoader(os.Args[1:], os.Getenv)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatal().Err(err).Str("file", loader.File).Msg("Invalid configuration")
+	}
+	if loader.Print {
+		encoded, _ := json.MarshalIndent(cfg.Redacted(), "", "  ")
+		fmt.Println(string(encoded))
+		return
+	}
+	log.Info().Str("file", loader.File).RawJSON("config", redactedJSON(cfg)).Msg("Loaded configuration")
+
+	// Trace requests through to upstream calls; spans are exported only when
+	// an exporter is configured
+	tracingConfig := tracing.DefaultConfig()
+	tracingConfig.Exporter = cfg.Tracing.Exporter
+	tracingConfig.File = cfg.Tracing.File
+	tracingConfig.SampleRatio = cfg.Tracing.SampleRatio
+	shutdownTracing, err := tracing.Setup(tracingConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up tracing")
 	}
 
-	// Initialize cache
-	cacheInstance := cache.New(30*time.Second, 1*time.Minute)
+	// Initialize cache, shared through Redis when configured so replicas
+	// reuse each other's upstream fetches
+	var cacheInstance service.Cache = cache.New(30*time.Second, 1*time.Minute)
+	var redisClient *redis.Client
+	if cfg.Redis.URL != "" {
+		options, err := redis.ParseURL(cfg.Redis.URL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid Redis URL")
+		}
+		redisClient = redis.NewClient(options)
 
-	// Initialize clients
-	binanceClient := client.NewBinanceClient()
-	coinGeckoClient := client.NewCoinGeckoClient()
+		pingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := redisClient.Ping(pingCtx).Err(); err != nil {
+			log.Warn().Err(err).Str("addr", options.Addr).Msg("Redis unreachable, cache lookups miss until it recovers")
+		}
+		cancel()
+
+		redisConfig := rediscache.DefaultConfig()
+		redisConfig.Namespace = cfg.Redis.Namespace
+		cacheInstance = rediscache.New(redisClient, service.CacheCodec{}, redisConfig)
+		log.Info().Str("addr", options.Addr).Str("namespace", redisConfig.Namespace).Msg("Using Redis cache")
+	}
+
+	// Initialize clients, retrying transient failures and budgeting upstream
+	// requests below the venues' own limits
+	binanceClient := client.NewBinanceClient(client.ClientConfig{
+		BaseURL: cfg.Binance.BaseURL,
+		Timeout: time.Duration(cfg.Binance.Timeout),
+		Retry:   cfg.Retry.Client(),
+	})
+	binanceRateLimit := client.DefaultBinanceRateLimit()
+	binanceRateLimit.Limit = cfg.Binance.WeightLimit
+	binanceClient.UseRateLimiter(client.NewRateLimiter("binance", binanceRateLimit))
+
+	coinGeckoClient := client.NewCoinGeckoClient(client.ClientConfig{
+		BaseURL: cfg.CoinGecko.BaseURL,
+		Timeout: time.Duration(cfg.CoinGecko.Timeout),
+		Retry:   cfg.Retry.Client(),
+	})
+	coinGeckoRateLimit := client.DefaultCoinGeckoRateLimit()
+	coinGeckoRateLimit.Limit = cfg.CoinGecko.CallsPerMinute
+	coinGeckoClient.UseRateLimiter(client.NewRateLimiter("coingecko", coinGeckoRateLimit))
+
+	// Resolve assets to CoinGecko coin IDs from its coin list
+	coinListConfig := provider.DefaultCoinListConfig()
+	coinListConfig.OverridesFile = cfg.CoinGecko.CoinOverrides
+	coinListConfig.RefreshInterval = time.Duration(cfg.CoinGecko.CoinsRefresh)
+	coinList := provider.NewCoinList(coinGeckoClient, coinListConfig)
+	if err := coinList.Refresh(); err != nil {
+		log.Warn().Err(err).Msg("Failed to load CoinGecko coin list, resolving pinned coins only until it loads")
+	}
+	coinList.Start()
+	coinGecko := provider.NewCoinGecko(coinGeckoClient)
+	coinGecko.UseCoinList(coinList)
+
+	// Register market data providers, highest priority first, each behind a
+	// circuit breaker
+	breakerConfig := provider.DefaultBreakerConfig()
+	breakerConfig.ErrorRate = cfg.Breaker.ErrorRate
+	breakerConfig.SlowCall = time.Duration(cfg.Breaker.SlowCall)
+	breakerConfig.OpenTimeout = time.Duration(cfg.Breaker.OpenTimeout)
+	providers := provider.NewRegistry()
+	providers.SetBreakerConfig(breakerConfig)
+	binance := provider.NewBinance(binanceClient)
+	providers.Register(binance)
+	providers.Register(coinGecko)
+
+	// Load listed symbols before serving so requests are validated from the start
+	symbolRegistry := symbols.NewRegistry(binanceClient, symbols.DefaultConfig())
+	if err := symbolRegistry.Refresh(); err != nil {
+		log.Warn().Err(err).Msg("Failed to load symbol registry, accepting any well-formed symbol until it loads")
+	}
+	symbolRegistry.Start()
+	binance.UseSymbols(symbolRegistry)
 
 	// Initialize services
-	marketService := service.NewMarketService(binanceClient, coinGeckoClient, cacheInstance)
+	marketService := service.NewMarketService(providers, cacheInstance)
+	marketService.UseSymbols(symbolRegistry)
+
+	// Provider order, cache policies, deadlines, limits and precision can
+	// change on SIGHUP; see applySettings
+	settings := func(cfg config.Config) error {
+		return applySettings(cfg, providers, symbolRegistry, marketService)
+	}
+	if err := settings(cfg); err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+
+	// Serve stale entries while refreshing them and keep hot keys refreshed
+	marketService.StartRefresh()
+
+	// Persist candles locally and keep configured series backfilled
+	var backfiller *candles.Backfiller
+	if cfg.Candles.StoreDir != "" {
+		candleStore, err := candles.Open(cfg.Candles.StoreDir)
+		if err != nil {
+			log.Fatal().Err(err).Str("dir", cfg.Candles.StoreDir).Msg("Failed to open candle store")
+		}
+		marketService.UseCandleStore(candleStore)
+
+		backfillConfig := candles.DefaultBackfillConfig()
+		backfillConfig.Symbols = resolvePairs(symbolRegistry, cfg.Candles.Symbols)
+		backfillConfig.Intervals = cfg.Candles.Intervals
+		backfillConfig.History = time.Duration(cfg.Candles.History)
+		backfiller = candles.NewBackfiller(candleStore, providers, backfillConfig)
+		backfiller.Start()
+	}
+
+	// Maintain local order books for symbols streamed from Binance
+	bookConfig := orderbook.DefaultConfig()
+	bookConfig.MaxAge = time.Duration(cfg.OrderBooks.MaxAge)
+	bookManager := orderbook.NewManager(binanceClient, client.NewBinanceStreamClient(cfg.Binance.StreamURL), bookConfig)
+	if len(cfg.OrderBooks.Symbols) > 0 {
+		for _, pair := range resolvePairs(symbolRegistry, cfg.OrderBooks.Symbols) {
+			bookManager.Track(pair)
+		}
+		marketService.UseOrderBooks(bookManager)
+	}
+
+	// Initialize streaming hub
+	streamConfig := stream.DefaultConfig()
+	streamConfig.MaxSubscriptions = cfg.Stream.MaxSubscriptions
+	streamHub := stream.NewHub(marketService, streamConfig)
+	streamHub.UseSymbols(symbolRegistry)
 
 	// Initialize handlers
-	marketHandler := handler.NewMarketHandler(marketService)
-	healthHandler := handler.NewHealthHandler()
+	marketHandler := handler.NewMarketHandler(marketService, symbolRegistry)
+	streamHandler := handler.NewStreamHandler(streamHub)
+	healthHandler := handler.NewHealthHandler(providers)
+	healthHandler.UseRateLimiters(binanceClient.RateLimiter(), coinGeckoClient.RateLimiter())
+	prometheus.MustRegister(client.NewRateLimitCollector(binanceClient.RateLimiter(), coinGeckoClient.RateLimiter()))
 
 	// Setup router
-	router := setupRouter(marketHandler, healthHandler)
+	router := setupRouter(cfg.Server, marketHandler, streamHandler, healthHandler)
+
+	// Requests derive their context from this one, so shutdown cancels the
+	// upstream calls they are waiting on rather than waiting them out
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
 
 	// Create server
 	srv := &http.Server{
-		Addr:    ":" + port,
+		Addr:    ":" + cfg.Server.Port,
 		Handler: router,
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
 	}
 
 	// Start server in goroutine
 	go func() {
-		log.Info().Str("port", port).Msg("Starting market aggregator service")
+		log.Info().Str("port", cfg.Server.Port).Msg("Starting market aggregator service")
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("Failed to start server")
 		}
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server
+	// Reload settings on SIGHUP until an interrupt signal shuts the server
+	// down gracefully
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+wait:
+	for {
+		select {
+		case <-hangup:
+			cfg = reload(loader, cfg, settings)
+		case <-quit:
+			break wait
+		}
+	}
 	log.Info().Msg("Shutting down server...")
+	cancelRequests()
 
 	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
 	defer cancel()
+	// Hijacked WebSocket connections are not tracked by srv.Shutdown
+	streamHub.Close()
+	bookManager.Close()
+	symbolRegistry.Close()
+	coinList.Close()
+	marketService.Close()
+	if backfiller != nil {
+		backfiller.Close()
+	}
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal().Err(err).Msg("Server forced to shutdown")
 	}
+	if redisClient != nil {
+		redisClient.Close()
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush traces")
+	}
 
 	log.Info().Msg("Server exited")
 }
 
-func setupRouter(marketHandler *handler.MarketHandler, healthHandler *handler.HealthHandler) *gin.Engine {
-	// Set gin mode
-	if os.Getenv("GIN_MODE") == "" {
-		gin.SetMode(gin.ReleaseMode)
-	}
+func setupRouter(server config.Server, marketHandler *handler.MarketHandler, streamHandler *handler.StreamHandler, healthHandler *handler.HealthHandler) *gin.Engine {
+	gin.SetMode(server.GinMode)
 
 	router := gin.New()
 
 	// Middlewares
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
+	router.Use(handler.Tracing())
 	router.Use(RequestIDMiddleware())
 	router.Use(LoggerMiddleware())
+	router.Use(handler.Metrics())
 
 	// CORS configuration
 	corsConfig := cors.DefaultConfig()
-	corsOrigins := os.Getenv("CORS_ORIGINS")
-	if corsOrigins != "" {
-		if corsOrigins == "*" {
+	corsConfig.AllowOrigins = server.CORSOrigins
+	for _, origin := range server.CORSOrigins {
+		if origin == "*" {
 			corsConfig.AllowAllOrigins = true
-		} else {
-			corsConfig.AllowOrigins = []string{corsOrigins}
+			corsConfig.AllowOrigins = nil
 		}
-	} else {
-		corsConfig.AllowAllOrigins = true
 	}
 	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Request-ID"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Request-ID", "traceparent", "tracestate"}
 	router.Use(cors.New(corsConfig))
 
 	// Health check
 	router.GET("/health", healthHandler.Health)
+	router.GET("/metrics", handler.MetricsHandler())
 
 	// Public market data routes
 	public := router.Group("/public")
 	{
 		market := public.Group("/market")
 		{
+			market.GET("/symbols", marketHandler.GetSymbols)
+			market.GET("/tickers", marketHandler.GetTickers)
 			market.GET("/ticker", marketHandler.GetTicker)
+			market.GET("/index", marketHandler.GetIndex)
 			market.GET("/klines", marketHandler.GetKlines)
 			market.GET("/depth", marketHandler.GetDepth)
+			market.GET("/ws", streamHandler.Stream)
 		}
 	}
 
@@ -162,6 +357,7 @@ func LoggerMiddleware() gin.HandlerFunc {
 		requestID, _ := c.Get("request_id")
 		log.Info().
 			Str("request_id", fmt.Sprintf("%v", requestID)).
+			Str("trace_id", c.GetString("trace_id")).
 			Str("method", param.Method).
 			Str("path", path).
 			Int("status", param.StatusCode).
@@ -171,6 +367,95 @@ func LoggerMiddleware() gin.HandlerFunc {
 	}
 }
 
+// applySettings applies the settings that may change while serving. Symbols
+// and the provider order are checked before anything changes, so a bad
+// reload leaves the current settings in place.
+func applySettings(cfg config.Config, providers *provider.Registry, registry *symbols.Registry, marketService *service.MarketService) error {
+	precisions := make(map[symbols.Pair]service.Precision, len(cfg.Precision))
+	for symbol, precision := range cfg.Precision {
+		pair, err := registry.Resolve(symbol)
+		if err != nil {
+			return fmt.Errorf("invalid precision symbol %s: %w", symbol, err)
+		}
+		precisions[pair] = service.Precision{Price: precision.Price, Quantity: precision.Quantity}
+	}
+	if err := providers.SetOrder(cfg.Providers.Priority); err != nil {
+		return fmt.Errorf("invalid provider priority: %w", err)
+	}
+
+	level, _ := zerolog.ParseLevel(cfg.Log.Level)
+	zerolog.SetGlobalLevel(level)
+
+	cacheConfig := service.DefaultCacheConfig()
+	cacheConfig.Ticker = cfg.Cache.Ticker.Service()
+	cacheConfig.FallbackTicker = cfg.Cache.FallbackTicker.Service()
+	cacheConfig.Klines = cfg.Cache.Klines.Service()
+	cacheConfig.KlineHistory = cfg.Cache.KlineHistory.Service()
+	cacheConfig.Depth = cfg.Cache.Depth.Service()
+	cacheConfig.Index = cfg.Cache.Index.Service()
+	cacheConfig.HotKeys = cfg.Cache.HotKeys
+	marketService.SetCacheConfig(cacheConfig)
+
+	// Bound each operation's upstream work, fallbacks included, below the
+	// HTTP clients' per-call timeouts
+	marketService.SetTimeoutConfig(service.TimeoutConfig{
+		Ticker:     time.Duration(cfg.Timeouts.Ticker),
+		Tickers:    time.Duration(cfg.Timeouts.Tickers),
+		Klines:     time.Duration(cfg.Timeouts.Klines),
+		KlineRange: time.Duration(cfg.Timeouts.KlineRange),
+		Depth:      time.Duration(cfg.Timeouts.Depth),
+		Index:      time.Duration(cfg.Timeouts.Index),
+	})
+
+	klineConfig := service.DefaultKlineRangeConfig()
+	klineConfig.MaxSpan = time.Duration(cfg.Klines.MaxSpan)
+	marketService.SetKlineRangeConfig(klineConfig)
+
+	marketService.SetPrecisions(precisions)
+	return nil
+}
+
+// reload reads the configuration again and applies what can change while
+// serving. An invalid configuration is logged and the current one kept.
+func reload(loader *config.Loader, current config.Config, apply func(config.Config) error) config.Config {
+	next, err := loader.Load()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reload configuration, keeping the current one")
+		return current
+	}
+	updated, restart := current.Reload(next)
+	if err := apply(updated); err != nil {
+		log.Error().Err(err).Msg("Failed to reload configuration, keeping the current one")
+		return current
+	}
+	if len(restart) > 0 {
+		log.Warn().Strs("sections", restart).Msg("Configuration changes to these sections take effect on restart")
+	}
+	log.Info().RawJSON("config", redactedJSON(updated)).Msg("Reloaded configuration")
+	return updated
+}
+
+func redactedJSON(cfg config.Config) []byte {
+	encoded, err := json.Marshal(cfg.Redacted())
+	if err != nil {
+		return []byte("null")
+	}
+	return encoded
+}
+
+// resolvePairs reads configured symbols in any accepted spelling.
+func resolvePairs(registry *symbols.Registry, list []string) []symbols.Pair {
+	pairs := make([]symbols.Pair, 0, len(list))
+	for _, symbol := range list {
+		pair, err := registry.Resolve(symbol)
+		if err != nil {
+			log.Fatal().Err(err).Str("symbol", symbol).Msg("Invalid configured symbol")
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
 func generateRequestID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
\ No newline at end of file
@@ -0,0 +1,253 @@
+package candles
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/rs/zerolog/log"
+)
+
+type BackfillConfig struct {
+	Symbols   []symbols.Pair
+	Intervals []string
+	// History is how far back the store is kept complete
+	History time.Duration
+	// RefreshInterval is how often every series is checked for gaps
+	RefreshInterval time.Duration
+	// RescanInterval is how often a pass checks a series' whole history
+	// window; other passes only check what is newer than the last pass
+	// found complete. Zero rescans on every pass
+	RescanInterval time.Duration
+	PageSize       int
+}
+
+func DefaultBackfillConfig() BackfillConfig {
+	return BackfillConfig{
+		Intervals:       []string{"1m", "1h", "1d"},
+		History:         30 * 24 * time.Hour,
+		RefreshInterval: 30 * time.Second,
+		RescanInterval:  1 * time.Hour,
+		PageSize:        1000,
+	}
+}
+
+// Backfiller keeps the configured series complete: each pass finds the gaps
+// in the history window, including the tail since the last stored candle,
+// and fetches exactly those ranges upstream. Passes between full rescans
+// only look past where the previous pass found the series complete.
+type Backfiller struct {
+	store     *Store
+	providers *provider.Registry
+	config    BackfillConfig
+
+	// Per series, keyed by pair and interval
+	mu     sync.Mutex
+	series map[string]*seriesProgress
+
+	// Cancelled by Close, ending a sync in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewBackfiller(store *Store, providers *provider.Registry, config BackfillConfig) *Backfiller {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Backfiller{
+		store:     store,
+		providers: providers,
+		config:    config,
+		series:    make(map[string]*seriesProgress),
+		ctx:       ctx,
+		cancel:    cancel,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs backfill passes until Close is called.
+func (b *Backfiller) Start() {
+	go func() {
+		defer close(b.done)
+
+		ticker := time.NewTicker(b.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			b.SyncAll()
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (b *Backfiller) Close() {
+	b.cancel()
+	close(b.stop)
+	<-b.done
+}
+
+// seriesProgress is what earlier passes learned about a series.
+type seriesProgress struct {
+	// Gaps the venue itself has no candles for (e.g. maintenance windows),
+	// so they are not refetched on every pass. Keyed by the gap's end,
+	// which stays put while the window start slides
+	holes map[int64]bool
+	// complete is the open time before which the window holds every candle
+	// or a known hole
+	complete int64
+	// scannedAt is when the whole window was last checked
+	scannedAt time.Time
+}
+
+// SyncAll runs one backfill pass over every configured series.
+func (b *Backfiller) SyncAll() {
+	for _, pair := range b.config.Symbols {
+		for _, interval := range b.config.Intervals {
+			select {
+			case <-b.stop:
+				return
+			default:
+			}
+			if err := b.Sync(pair, interval); err != nil {
+				log.Warn().Err(err).Stringer("symbol", pair).Str("interval", interval).Msg("Candle backfill failed")
+			}
+		}
+	}
+}
+
+// Sync fills every gap in one series' history window. Between full rescans
+// only the part of the window newer than the last complete pass is read.
+func (b *Backfiller) Sync(pair symbols.Pair, interval string) error {
+	now := time.Now()
+	start, err := OpenTime(interval, now.UnixMilli()-b.config.History.Milliseconds())
+	if err != nil {
+		return err
+	}
+	current, err := OpenTime(interval, now.UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	series := fmt.Sprintf("%s:%s", pair, interval)
+	from, rescan := b.scanFrom(series, start, now)
+
+	stored, err := b.store.Range(pair, interval, from, now.UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	// The last stored candle may have been written while still open
+	if len(stored) > 0 {
+		stored = stored[:len(stored)-1]
+	}
+	gaps, err := FindGaps(interval, stored, from, now.UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	filled := 0
+	complete := current
+	for _, gap := range gaps {
+		if b.isHole(series, gap.End) {
+			continue
+		}
+
+		klines, err := b.fetch(provider.KlineQuery{Pair: pair, Interval: interval, StartTime: gap.Start, EndTime: gap.End})
+		if err != nil {
+			return err
+		}
+
+		// Only a closed gap can be permanently empty; the tail may just not
+		// have traded yet, and is checked again on the next pass
+		if len(klines) == 0 {
+			if gap.End < now.UnixMilli() {
+				b.markHole(series, gap.End)
+			} else {
+				complete = min(complete, gap.Start)
+			}
+			continue
+		}
+		if err := b.store.Put(pair, interval, klines); err != nil {
+			return err
+		}
+		filled += len(klines)
+	}
+	b.advance(series, complete, rescan, now)
+
+	if filled > 0 {
+		log.Debug().Stringer("symbol", pair).Str("interval", interval).Int("gaps", len(gaps)).Int("candles", filled).Msg("Candle store backfilled")
+	}
+	return nil
+}
+
+// scanFrom returns where a pass over series should start checking, and
+// whether it rescans the whole window. Holes that have slid out of the
+// window are forgotten.
+func (b *Backfiller) scanFrom(series string, start int64, now time.Time) (from int64, rescan bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	progress, ok := b.series[series]
+	if !ok {
+		progress = &seriesProgress{holes: make(map[int64]bool)}
+		b.series[series] = progress
+	}
+	for end := range progress.holes {
+		if end < start {
+			delete(progress.holes, end)
+		}
+	}
+
+	if progress.scannedAt.IsZero() || now.Sub(progress.scannedAt) >= b.config.RescanInterval {
+		return start, true
+	}
+	return max(start, progress.complete), false
+}
+
+// advance records that series is complete before complete after a pass
+// that ended without errors.
+func (b *Backfiller) advance(series string, complete int64, rescan bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	progress := b.series[series]
+	progress.complete = complete
+	if rescan {
+		progress.scannedAt = now
+	}
+}
+
+func (b *Backfiller) fetch(query provider.KlineQuery) ([]provider.Kline, error) {
+	var lastErr error
+	for _, p := range b.providers.Providers(provider.CapKlines) {
+		klines, _, err := provider.PageKlines(b.ctx, p, query, b.config.PageSize)
+		if err == nil {
+			return klines, nil
+		}
+		lastErr = fmt.Errorf("%s: %v", p.Name(), err)
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("no kline provider available")
+	}
+	return nil, lastErr
+}
+
+func (b *Backfiller) isHole(series string, end int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.series[series].holes[end]
+}
+
+func (b *Backfiller) markHole(series string, end int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.series[series].holes[end] = true
+}
@@ -0,0 +1,185 @@
+package candles
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// venueProvider serves candles from a fixed history, honoring range queries.
+type venueProvider struct {
+	mu      sync.Mutex
+	history []provider.Kline
+	queries []provider.KlineQuery
+}
+
+func (p *venueProvider) Name() string                      { return "venue" }
+func (p *venueProvider) Capabilities() provider.Capability { return provider.CapKlines }
+func (p *venueProvider) Symbol(pair symbols.Pair) (string, error) {
+	return pair.Compact(), nil
+}
+func (p *venueProvider) GetTicker(ctx context.Context, pair symbols.Pair) (*provider.Ticker, error) {
+	return nil, provider.ErrNotSupported
+}
+func (p *venueProvider) GetDepth(ctx context.Context, pair symbols.Pair, limit int) (*provider.Depth, error) {
+	return nil, provider.ErrNotSupported
+}
+func (p *venueProvider) GetKlines(ctx context.Context, query provider.KlineQuery) ([]provider.Kline, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.queries = append(p.queries, query)
+	var result []provider.Kline
+	for _, k := range p.history {
+		if k.OpenTime >= query.StartTime && k.OpenTime <= query.EndTime && (query.Limit == 0 || len(result) < query.Limit) {
+			result = append(result, k)
+		}
+	}
+	return result, nil
+}
+
+func (p *venueProvider) queryCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queries)
+}
+
+func newTestBackfiller(t *testing.T, venue *venueProvider) (*Backfiller, *Store) {
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	config := DefaultBackfillConfig()
+	config.History = 10 * time.Minute
+	config.PageSize = 4
+	return NewBackfiller(store, provider.NewRegistry(venue), config), store
+}
+
+func TestBackfiller_FillsHistoryAndRepairsGaps(t *testing.T) {
+	// Arrange
+	now := time.Now().UnixMilli()
+	start, _ := OpenTime("1m", now-10*time.Minute.Milliseconds())
+	venue := &venueProvider{history: minuteKlines(start, 11)}
+	backfiller, store := newTestBackfiller(t, venue)
+	backfiller.config.RescanInterval = 0
+
+	// Act
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+
+	// Assert
+	stored, err := store.Range(btcusdt, "1m", start, now)
+	require.NoError(t, err)
+	assert.Len(t, stored, 11)
+
+	// Punch a hole and check only the hole and the tail are refetched
+	missing := stored[4:6]
+	kept := append(append([]provider.Kline{}, stored[:4]...), stored[6:]...)
+	dir, _ := store.seriesDir(btcusdt, "1m")
+	for _, key := range partitionKeys("1m", start, now) {
+		require.NoError(t, writePartition(dir+"/"+key+".jsonl", filter(kept, key)))
+	}
+	venue.queries = nil
+
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+
+	stored, err = store.Range(btcusdt, "1m", start, now)
+	require.NoError(t, err)
+	assert.Len(t, stored, 11)
+	require.Equal(t, 2, venue.queryCount())
+	assert.Equal(t, missing[0].OpenTime, venue.queries[0].StartTime)
+	assert.Equal(t, missing[1].OpenTime+time.Minute.Milliseconds()-1, venue.queries[0].EndTime)
+}
+
+func TestBackfiller_RemembersVenueHoles(t *testing.T) {
+	// Arrange
+	now := time.Now().UnixMilli()
+	start, _ := OpenTime("1m", now-10*time.Minute.Milliseconds())
+	history := minuteKlines(start, 11)
+	venue := &venueProvider{history: append(history[:3:3], history[5:]...)}
+	backfiller, _ := newTestBackfiller(t, venue)
+	backfiller.config.RescanInterval = 0
+
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+
+	// Act: the second pass probes the hole and finds it empty
+	before := venue.queryCount()
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+	probed := venue.queryCount() - before
+
+	before = venue.queryCount()
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+
+	// Assert: afterwards only the tail is refreshed
+	assert.Equal(t, 2, probed)
+	assert.Equal(t, 1, venue.queryCount()-before)
+}
+
+func TestBackfiller_ChecksOnlyNewCandlesBetweenRescans(t *testing.T) {
+	// Arrange
+	now := time.Now().UnixMilli()
+	start, _ := OpenTime("1m", now-10*time.Minute.Milliseconds())
+	venue := &venueProvider{history: minuteKlines(start, 11)}
+	backfiller, store := newTestBackfiller(t, venue)
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+
+	// Punch a hole behind the last complete pass
+	stored, err := store.Range(btcusdt, "1m", start, now)
+	require.NoError(t, err)
+	kept := append(append([]provider.Kline{}, stored[:4]...), stored[6:]...)
+	dir, _ := store.seriesDir(btcusdt, "1m")
+	for _, key := range partitionKeys("1m", start, now) {
+		require.NoError(t, writePartition(dir+"/"+key+".jsonl", filter(kept, key)))
+	}
+
+	// Act
+	before := venue.queryCount()
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+	incremental := venue.queryCount() - before
+
+	backfiller.config.RescanInterval = 0
+	before = venue.queryCount()
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+	rescan := venue.queryCount() - before
+
+	// Assert: only the tail until the rescan, which repairs the hole
+	assert.Equal(t, 1, incremental)
+	assert.Equal(t, 2, rescan)
+	stored, err = store.Range(btcusdt, "1m", start, now)
+	require.NoError(t, err)
+	assert.Len(t, stored, 11)
+}
+
+func TestBackfiller_ForgetsHolesOutsideWindow(t *testing.T) {
+	// Arrange
+	now := time.Now().UnixMilli()
+	start, _ := OpenTime("1m", now-10*time.Minute.Milliseconds())
+	history := minuteKlines(start, 11)
+	venue := &venueProvider{history: append(history[:3:3], history[5:]...)}
+	backfiller, _ := newTestBackfiller(t, venue)
+	backfiller.config.RescanInterval = 0
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+	require.Len(t, backfiller.series["BTC-USDT:1m"].holes, 1)
+
+	// Act: the window shrinks past the hole
+	backfiller.config.History = 3 * time.Minute
+	require.NoError(t, backfiller.Sync(btcusdt, "1m"))
+
+	// Assert
+	assert.Empty(t, backfiller.series["BTC-USDT:1m"].holes)
+}
+
+func filter(klines []provider.Kline, key string) []provider.Kline {
+	var result []provider.Kline
+	for _, k := range klines {
+		if partitionKey("1m", k.OpenTime) == key {
+			result = append(result, k)
+		}
+	}
+	return result
+}
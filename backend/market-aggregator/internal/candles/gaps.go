@@ -0,0 +1,45 @@
+package candles
+
+import "github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+
+// Gap is a span of missing candles, as inclusive Unix millisecond bounds
+// suitable for a startTime/endTime query.
+type Gap struct {
+	Start int64
+	End   int64
+}
+
+// FindGaps returns the spans in [start, end] where klines, sorted by open
+// time, are missing a candle.
+func FindGaps(interval string, klines []provider.Kline, start, end int64) ([]Gap, error) {
+	expected, err := OpenTime(interval, start)
+	if err != nil {
+		return nil, err
+	}
+	if expected < start {
+		if expected, err = NextOpenTime(interval, expected); err != nil {
+			return nil, err
+		}
+	}
+
+	var gaps []Gap
+	for _, k := range klines {
+		if k.OpenTime < expected {
+			continue
+		}
+		if k.OpenTime > end {
+			break
+		}
+		if k.OpenTime > expected {
+			gaps = append(gaps, Gap{Start: expected, End: k.OpenTime - 1})
+		}
+		if expected, err = NextOpenTime(interval, k.OpenTime); err != nil {
+			return nil, err
+		}
+	}
+	if expected <= end {
+		gaps = append(gaps, Gap{Start: expected, End: end})
+	}
+
+	return gaps, nil
+}
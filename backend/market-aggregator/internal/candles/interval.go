@@ -0,0 +1,163 @@
+package candles
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// maxIntervalCount bounds the multiplier in an interval such as "90m".
+const maxIntervalCount = 1000
+
+// Interval is a candle length: Count units of m (minute), h (hour), d (day),
+// w (week, opening Monday) or M (month).
+type Interval struct {
+	Count int
+	Unit  byte
+}
+
+// ParseInterval parses Binance-style intervals, including ones Binance does
+// not serve such as "10m" or "2d".
+func ParseInterval(s string) (Interval, error) {
+	if len(s) < 2 {
+		return Interval{}, fmt.Errorf("unsupported interval: %s", s)
+	}
+
+	count, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || count <= 0 || count > maxIntervalCount || s[0] == '0' || s[0] == '+' {
+		return Interval{}, fmt.Errorf("unsupported interval: %s", s)
+	}
+
+	unit := s[len(s)-1]
+	switch unit {
+	case 'm', 'h', 'd', 'w', 'M':
+	default:
+		return Interval{}, fmt.Errorf("unsupported interval: %s", s)
+	}
+
+	return Interval{Count: count, Unit: unit}, nil
+}
+
+func (iv Interval) String() string {
+	return strconv.Itoa(iv.Count) + string(iv.Unit)
+}
+
+// Step returns the nominal length of the interval; months have none.
+func (iv Interval) Step() (time.Duration, bool) {
+	switch iv.Unit {
+	case 'm':
+		return time.Duration(iv.Count) * time.Minute, true
+	case 'h':
+		return time.Duration(iv.Count) * time.Hour, true
+	case 'd':
+		return time.Duration(iv.Count) * 24 * time.Hour, true
+	case 'w':
+		return time.Duration(iv.Count) * 7 * 24 * time.Hour, true
+	}
+	return 0, false
+}
+
+// Open returns the open time of the candle containing t, with day, week and
+// month boundaries at local midnight in loc. Sub-day intervals that divide a
+// day are aligned to local midnight too, so "4h" in UTC+8 opens at 00:00,
+// 04:00, ... local time; other sub-day intervals are aligned to the epoch.
+// Times are Unix milliseconds.
+func (iv Interval) Open(t int64, loc *time.Location) int64 {
+	local := time.UnixMilli(t).In(loc)
+
+	switch iv.Unit {
+	case 'd':
+		day := civilDay(local)
+		return localMidnight(day-floorMod(day, int64(iv.Count)), loc)
+	case 'w':
+		// Day 0 is a Thursday, so week 0 opens on day -3
+		week := floorDiv(civilDay(local)+3, 7)
+		week -= floorMod(week, int64(iv.Count))
+		return localMidnight(week*7-3, loc)
+	case 'M':
+		months := int64(local.Year())*12 + int64(local.Month()) - 1
+		months -= floorMod(months, int64(iv.Count))
+		return time.Date(int(months/12), time.Month(months%12+1), 1, 0, 0, 0, 0, loc).UnixMilli()
+	}
+
+	step, _ := iv.Step()
+	ms := step.Milliseconds()
+	if (24*time.Hour)%step == 0 {
+		midnight := localMidnight(civilDay(local), loc)
+		return midnight + (t-midnight)/ms*ms
+	}
+	return t - floorMod(t, ms)
+}
+
+// Shift moves the open time openTime by n candles, backwards when n is negative.
+func (iv Interval) Shift(openTime int64, n int, loc *time.Location) int64 {
+	local := time.UnixMilli(openTime).In(loc)
+
+	switch iv.Unit {
+	case 'd':
+		return local.AddDate(0, 0, n*iv.Count).UnixMilli()
+	case 'w':
+		return local.AddDate(0, 0, n*iv.Count*7).UnixMilli()
+	case 'M':
+		return local.AddDate(0, n*iv.Count, 0).UnixMilli()
+	}
+
+	step, _ := iv.Step()
+	return openTime + int64(n)*step.Milliseconds()
+}
+
+// OpenTime returns the open time of the interval's candle containing t, using
+// Binance's UTC alignment. Times are Unix milliseconds.
+func OpenTime(interval string, t int64) (int64, error) {
+	iv, err := ParseInterval(interval)
+	if err != nil {
+		return 0, err
+	}
+	return iv.Open(t, time.UTC), nil
+}
+
+// NextOpenTime returns the open time of the candle after the one opening at openTime.
+func NextOpenTime(interval string, openTime int64) (int64, error) {
+	return ShiftOpenTime(interval, openTime, 1)
+}
+
+// ShiftOpenTime moves openTime by n candles, backwards when n is negative.
+func ShiftOpenTime(interval string, openTime int64, n int) (int64, error) {
+	iv, err := ParseInterval(interval)
+	if err != nil {
+		return 0, err
+	}
+	return iv.Shift(openTime, n, time.UTC), nil
+}
+
+// Step returns the fixed length of interval; months have no fixed length.
+func Step(interval string) (time.Duration, bool) {
+	iv, err := ParseInterval(interval)
+	if err != nil {
+		return 0, false
+	}
+	return iv.Step()
+}
+
+// civilDay is the number of days from 1970-01-01 to t's local date.
+func civilDay(t time.Time) int64 {
+	y, m, d := t.Date()
+	return floorDiv(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix(), 86400)
+}
+
+func localMidnight(day int64, loc *time.Location) int64 {
+	t := time.Unix(day*86400, 0).UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc).UnixMilli()
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func floorMod(a, b int64) int64 {
+	return a - floorDiv(a, b)*b
+}
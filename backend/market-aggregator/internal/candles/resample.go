@@ -0,0 +1,80 @@
+package candles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/shopspring/decimal"
+)
+
+// Resample aggregates base candles, sorted by open time, into target candles
+// aligned in loc. Each base candle must lie entirely inside one target
+// candle, so the base interval has to divide the target's boundaries.
+// Target candles take the first open, last close, highest high and lowest
+// low of their base candles and the exact sum of every volume and trade count;
+// their close time is the end of the target period even while it is still
+// forming.
+func Resample(base []provider.Kline, target Interval, loc *time.Location) []provider.Kline {
+	result := []provider.Kline{}
+
+	for _, k := range base {
+		openTime := target.Open(k.OpenTime, loc)
+		if len(result) == 0 || result[len(result)-1].OpenTime != openTime {
+			k.OpenTime = openTime
+			k.CloseTime = target.Shift(openTime, 1, loc) - 1
+			result = append(result, k)
+			continue
+		}
+
+		acc := &result[len(result)-1]
+		acc.High = decimal.Max(acc.High, k.High)
+		acc.Low = decimal.Min(acc.Low, k.Low)
+		acc.Close = k.Close
+		acc.Volume = acc.Volume.Add(k.Volume)
+		acc.QuoteVolume = acc.QuoteVolume.Add(k.QuoteVolume)
+		acc.Trades += k.Trades
+		acc.TakerBuyBaseVolume = acc.TakerBuyBaseVolume.Add(k.TakerBuyBaseVolume)
+		acc.TakerBuyQuoteVolume = acc.TakerBuyQuoteVolume.Add(k.TakerBuyQuoteVolume)
+	}
+	return result
+}
+
+// LoadLocation resolves a timeZone parameter: an IANA name such as
+// "Asia/Shanghai", or a UTC offset such as "+08:00", "-5" or "+5:30".
+// An empty name is UTC.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "0" {
+		return time.UTC, nil
+	}
+
+	if name[0] == '+' || name[0] == '-' || (name[0] >= '0' && name[0] <= '9') {
+		hours, minutes, hasMinutes := strings.Cut(strings.TrimLeft(name, "+-"), ":")
+		h, err := strconv.Atoi(hours)
+		if err != nil || h > 14 {
+			return nil, fmt.Errorf("invalid time zone offset: %s", name)
+		}
+		m := 0
+		if hasMinutes {
+			if m, err = strconv.Atoi(minutes); err != nil || m < 0 || m > 59 || len(minutes) != 2 {
+				return nil, fmt.Errorf("invalid time zone offset: %s", name)
+			}
+		}
+		offset := h*3600 + m*60
+		if name[0] == '-' {
+			offset = -offset
+		}
+		if offset == 0 {
+			return time.UTC, nil
+		}
+		return time.FixedZone(name, offset), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone: %s", name)
+	}
+	return loc, nil
+}
@@ -0,0 +1,146 @@
+package candles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dec = decimal.RequireFromString
+
+func TestParseInterval(t *testing.T) {
+	for _, valid := range []string{"1m", "10m", "90m", "2h", "1d", "2d", "1w", "1M", "3M"} {
+		iv, err := ParseInterval(valid)
+		require.NoError(t, err, valid)
+		assert.Equal(t, valid, iv.String())
+	}
+	for _, invalid := range []string{"", "m", "0m", "-1h", "+1h", "01h", "1y", "1.5h", "1001m"} {
+		_, err := ParseInterval(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestInterval_OpenInTimeZone(t *testing.T) {
+	shanghai := time.FixedZone("+08:00", 8*3600)
+	t0 := time.Date(2024, 3, 6, 1, 30, 0, 0, time.UTC).UnixMilli() // Wednesday, 09:30 in UTC+8
+
+	cases := []struct {
+		interval string
+		loc      *time.Location
+		want     time.Time
+	}{
+		{"4h", time.UTC, time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{"1d", time.UTC, time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{"1d", shanghai, time.Date(2024, 3, 6, 0, 0, 0, 0, shanghai)},
+		{"1w", time.UTC, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"1w", shanghai, time.Date(2024, 3, 4, 0, 0, 0, 0, shanghai)},
+		{"1M", shanghai, time.Date(2024, 3, 1, 0, 0, 0, 0, shanghai)},
+		{"10m", shanghai, time.Date(2024, 3, 6, 9, 30, 0, 0, shanghai)},
+		// 7h does not divide a day, so it stays aligned to the epoch
+		{"7h", shanghai, time.UnixMilli(t0 - t0%(7*time.Hour).Milliseconds())},
+	}
+
+	for _, tc := range cases {
+		iv, err := ParseInterval(tc.interval)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want.UnixMilli(), iv.Open(t0, tc.loc), "%s in %s", tc.interval, tc.loc)
+	}
+}
+
+func TestInterval_ShiftAcrossDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	iv, err := ParseInterval("1d")
+	require.NoError(t, err)
+
+	// Clocks go forward on 2024-03-10, so that day is 23 hours long
+	open := time.Date(2024, 3, 10, 0, 0, 0, 0, newYork).UnixMilli()
+
+	next := iv.Shift(open, 1, newYork)
+
+	assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, newYork).UnixMilli(), next)
+	assert.Equal(t, 23*time.Hour.Milliseconds(), next-open)
+}
+
+func TestResample_AggregatesOHLCV(t *testing.T) {
+	// Arrange
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	step := (5 * time.Minute).Milliseconds()
+	base := []provider.Kline{
+		{OpenTime: start, Open: dec("100"), High: dec("105"), Low: dec("99"), Close: dec("104"), Volume: dec("1.5"), QuoteVolume: dec("150"), Trades: 10, TakerBuyBaseVolume: dec("0.5"), TakerBuyQuoteVolume: dec("50")},
+		{OpenTime: start + step, Open: dec("104"), High: dec("110"), Low: dec("98.5"), Close: dec("107"), Volume: dec("0.25"), QuoteVolume: dec("26.75"), Trades: 5, TakerBuyBaseVolume: dec("0.1"), TakerBuyQuoteVolume: dec("10.7")},
+		{OpenTime: start + 2*step, Open: dec("107"), High: dec("108"), Low: dec("106"), Close: dec("106.5"), Volume: dec("2"), QuoteVolume: dec("213"), Trades: 7, TakerBuyBaseVolume: dec("1"), TakerBuyQuoteVolume: dec("106.5")},
+	}
+	iv, err := ParseInterval("10m")
+	require.NoError(t, err)
+
+	// Act
+	klines := Resample(base, iv, time.UTC)
+
+	// Assert
+	require.Len(t, klines, 2)
+	assert.True(t, provider.Kline{
+		OpenTime:            start,
+		Open:                dec("100"),
+		High:                dec("110"),
+		Low:                 dec("98.5"),
+		Close:               dec("107"),
+		Volume:              dec("1.75"),
+		CloseTime:           start + 2*step - 1,
+		QuoteVolume:         dec("176.75"),
+		Trades:              15,
+		TakerBuyBaseVolume:  dec("0.6"),
+		TakerBuyQuoteVolume: dec("60.7"),
+	}.Equal(klines[0]), "got %+v", klines[0])
+
+	// The second candle is still forming but keeps its full period
+	assert.Equal(t, start+2*step, klines[1].OpenTime)
+	assert.Equal(t, start+4*step-1, klines[1].CloseTime)
+	assert.Equal(t, "106.5", klines[1].Close.String())
+}
+
+func TestResample_DailyInTimeZone(t *testing.T) {
+	// Arrange
+	shanghai := time.FixedZone("+08:00", 8*3600)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+	hour := time.Hour.Milliseconds()
+	base := make([]provider.Kline, 8)
+	for i := range base {
+		base[i] = provider.Kline{OpenTime: start + int64(i)*hour, Open: dec("1"), High: dec("1"), Low: dec("1"), Close: dec("1"), Volume: dec("1")}
+	}
+	iv, err := ParseInterval("1d")
+	require.NoError(t, err)
+
+	// Act
+	klines := Resample(base, iv, shanghai)
+
+	// Assert: local midnight is 16:00 UTC, splitting the hours 4/4
+	require.Len(t, klines, 2)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, shanghai).UnixMilli(), klines[0].OpenTime)
+	assert.Equal(t, "4", klines[0].Volume.String())
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, shanghai).UnixMilli(), klines[1].OpenTime)
+	assert.Equal(t, "4", klines[1].Volume.String())
+}
+
+func TestLoadLocation(t *testing.T) {
+	cases := map[string]int{"": 0, "0": 0, "+08:00": 8 * 3600, "8": 8 * 3600, "-5": -5 * 3600, "+5:30": 5*3600 + 30*60}
+	for name, offset := range cases {
+		loc, err := LoadLocation(name)
+		require.NoError(t, err, name)
+		_, got := time.Now().In(loc).Zone()
+		assert.Equal(t, offset, got, name)
+	}
+
+	loc, err := LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Shanghai", loc.String())
+
+	for _, invalid := range []string{"+15", "+8:5", "+8:60", "Mars/Olympus"} {
+		_, err := LoadLocation(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
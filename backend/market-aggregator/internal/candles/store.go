@@ -0,0 +1,456 @@
+package candles
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/rs/zerolog/log"
+)
+
+// Store persists candles on disk as JSON lines, one directory per compact
+// symbol and interval, partitioned by month for sub-hour intervals and by year
+// otherwise so that a range read touches only a few small files:
+//
+//	<dir>/BTCUSDT/1m/2024-05.jsonl
+//	<dir>/BTCUSDT/1d/2024.jsonl
+//
+// Partitions stay sorted by open time. New candles are appended and an
+// unchanged candle is not written again, so a write costs what it adds
+// rather than the whole partition; only filling a hole or changing an
+// earlier candle rewrites a partition, atomically. A crash mid-append leaves
+// at most an unterminated last line, which is ignored and overwritten.
+type Store struct {
+	dir string
+
+	mu sync.Mutex
+	// series serializes writes per series; reads of a series wait only for
+	// its own writes
+	series  map[string]*sync.RWMutex
+	indexes map[string]*partitionIndex
+}
+
+// maxIndexes bounds the partition indexes kept in memory; writes mostly go
+// to the latest partition of each series.
+const maxIndexes = 64
+
+// partitionIndex is what Put needs to know of a partition without reading it.
+type partitionIndex struct {
+	// lines hashes each stored line by open time, telling unchanged
+	// candles apart from updates
+	lines map[int64]uint64
+	// last is the open time of the last line, which starts at lastOffset
+	last       int64
+	lastOffset int64
+	size       int64
+}
+
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create candle store: %v", err)
+	}
+	return &Store{
+		dir:     dir,
+		series:  make(map[string]*sync.RWMutex),
+		indexes: make(map[string]*partitionIndex),
+	}, nil
+}
+
+// Put inserts candles, replacing any stored candle with the same open time.
+func (s *Store) Put(pair symbols.Pair, interval string, klines []provider.Kline) error {
+	if len(klines) == 0 {
+		return nil
+	}
+	dir, err := s.seriesDir(pair, interval)
+	if err != nil {
+		return err
+	}
+
+	byPartition := make(map[string][]provider.Kline)
+	for _, k := range klines {
+		key := partitionKey(interval, k.OpenTime)
+		byPartition[key] = append(byPartition[key], k)
+	}
+
+	lock := s.seriesLock(dir)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create candle series: %v", err)
+	}
+	for key, updates := range byPartition {
+		if err := s.putPartition(filepath.Join(dir, key+".jsonl"), updates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putPartition writes updates to one partition; the caller holds the series
+// lock.
+func (s *Store) putPartition(path string, updates []provider.Kline) error {
+	index, err := s.index(path)
+	if err != nil {
+		return err
+	}
+
+	var changed []provider.Kline
+	var lines [][]byte
+	for _, k := range merge(nil, updates) {
+		line, err := encodeLine(k)
+		if err != nil {
+			return err
+		}
+		if hash, ok := index.lines[k.OpenTime]; ok && hash == hashLine(line) {
+			continue
+		}
+		changed = append(changed, k)
+		lines = append(lines, line)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	first := changed[0].OpenTime
+	switch {
+	case len(index.lines) == 0 || first > index.last:
+		err = index.append(path, index.size, changed, lines)
+	case first == index.last:
+		// Typically the candle that was still open when last written
+		err = index.append(path, index.lastOffset, changed, lines)
+	default:
+		err = rewritePartition(path, changed)
+	}
+	if err != nil || first < index.last {
+		// Rebuilt from the file on the next write
+		s.mu.Lock()
+		delete(s.indexes, path)
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Range returns stored candles opening in [start, end], sorted by open time.
+func (s *Store) Range(pair symbols.Pair, interval string, start, end int64) ([]provider.Kline, error) {
+	dir, err := s.seriesDir(pair, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := s.seriesLock(dir)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	var result []provider.Kline
+	for _, key := range partitionKeys(interval, start, end) {
+		klines, err := readPartition(filepath.Join(dir, key+".jsonl"))
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range klines {
+			if k.OpenTime >= start && k.OpenTime <= end {
+				result = append(result, k)
+			}
+		}
+	}
+	return result, nil
+}
+
+// Covered returns the candles in [start, end] only when none are missing.
+func (s *Store) Covered(pair symbols.Pair, interval string, start, end int64) ([]provider.Kline, bool) {
+	klines, err := s.Range(pair, interval, start, end)
+	if err != nil {
+		log.Warn().Err(err).Stringer("symbol", pair).Str("interval", interval).Msg("Failed to read candle store")
+		return nil, false
+	}
+	gaps, err := FindGaps(interval, klines, start, end)
+	if err != nil || len(gaps) > 0 {
+		return nil, false
+	}
+	return klines, true
+}
+
+func (s *Store) seriesDir(pair symbols.Pair, interval string) (string, error) {
+	// Never let a malformed pair escape the store
+	symbol := pair.Compact()
+	for _, r := range symbol {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return "", fmt.Errorf("invalid symbol for candle store: %q", symbol)
+		}
+	}
+	if symbol == "" {
+		return "", errors.New("empty symbol for candle store")
+	}
+	iv, err := ParseInterval(interval)
+	if err != nil {
+		return "", err
+	}
+
+	// "1M" and "1m" would collide on case-insensitive filesystems
+	name := interval
+	if iv.Unit == 'M' {
+		name = fmt.Sprintf("%dmo", iv.Count)
+	}
+	return filepath.Join(s.dir, symbol, name), nil
+}
+
+func (s *Store) seriesLock(dir string) *sync.RWMutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.series[dir]
+	if !ok {
+		lock = &sync.RWMutex{}
+		s.series[dir] = lock
+	}
+	return lock
+}
+
+// index returns the partition's index, reading the partition the first time.
+// A partition found out of order is rewritten sorted.
+func (s *Store) index(path string) (*partitionIndex, error) {
+	s.mu.Lock()
+	index, ok := s.indexes[path]
+	s.mu.Unlock()
+	if ok {
+		return index, nil
+	}
+
+	index = &partitionIndex{lines: make(map[int64]uint64)}
+	sorted := true
+	size, err := scanPartition(path, func(offset int64, line []byte) error {
+		var k struct {
+			OpenTime int64 `json:"openTime"`
+		}
+		if err := json.Unmarshal(line, &k); err != nil {
+			return fmt.Errorf("corrupt candle partition %s: %v", path, err)
+		}
+		if len(index.lines) > 0 && k.OpenTime <= index.last {
+			sorted = false
+		}
+		index.lines[k.OpenTime] = hashLine(line)
+		index.last = k.OpenTime
+		index.lastOffset = offset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	index.size = size
+
+	if !sorted {
+		if err := rewritePartition(path, nil); err != nil {
+			return nil, err
+		}
+		return s.index(path)
+	}
+
+	s.mu.Lock()
+	for other := range s.indexes {
+		if len(s.indexes) < maxIndexes {
+			break
+		}
+		delete(s.indexes, other)
+	}
+	s.indexes[path] = index
+	s.mu.Unlock()
+	return index, nil
+}
+
+// append writes lines at offset, cutting off whatever followed it.
+func (index *partitionIndex) append(path string, offset int64, klines []provider.Kline, lines [][]byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open candle partition: %v", err)
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write candle partition: %v", err)
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+	}
+	if _, err := f.WriteAt(buf.Bytes(), offset); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write candle partition: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write candle partition: %v", err)
+	}
+
+	for i, k := range klines {
+		index.lines[k.OpenTime] = hashLine(lines[i])
+		index.last = k.OpenTime
+		index.lastOffset = offset
+		offset += int64(len(lines[i]))
+	}
+	index.size = offset
+	return nil
+}
+
+func monthlyPartitions(interval string) bool {
+	step, ok := Step(interval)
+	return ok && step < time.Hour
+}
+
+func partitionKey(interval string, openTime int64) string {
+	t := time.UnixMilli(openTime).UTC()
+	if monthlyPartitions(interval) {
+		return t.Format("2006-01")
+	}
+	return t.Format("2006")
+}
+
+func partitionKeys(interval string, start, end int64) []string {
+	if start > end {
+		return nil
+	}
+
+	first := time.UnixMilli(start).UTC()
+	last := time.UnixMilli(end).UTC()
+
+	var keys []string
+	if monthlyPartitions(interval) {
+		for t := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC); !t.After(last); t = t.AddDate(0, 1, 0) {
+			keys = append(keys, t.Format("2006-01"))
+		}
+		return keys
+	}
+	for year := first.Year(); year <= last.Year(); year++ {
+		keys = append(keys, fmt.Sprintf("%04d", year))
+	}
+	return keys
+}
+
+func readPartition(path string) ([]provider.Kline, error) {
+	var klines []provider.Kline
+	_, err := scanPartition(path, func(offset int64, line []byte) error {
+		var k provider.Kline
+		if err := json.Unmarshal(line, &k); err != nil {
+			return fmt.Errorf("corrupt candle partition %s: %v", path, err)
+		}
+		klines = append(klines, k)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return klines, nil
+}
+
+// scanPartition calls fn with every complete line and the offset it starts
+// at, and returns the offset past the last one. An unterminated last line is
+// a torn append and is skipped.
+func scanPartition(path string, fn func(offset int64, line []byte) error) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open candle partition: %v", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read candle partition: %v", err)
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			if err := fn(offset, line); err != nil {
+				return 0, err
+			}
+		}
+		offset += int64(len(line))
+	}
+}
+
+// rewritePartition merges updates into the partition and replaces it whole.
+func rewritePartition(path string, updates []provider.Kline) error {
+	existing, err := readPartition(path)
+	if err != nil {
+		return err
+	}
+	return writePartition(path, merge(existing, updates))
+}
+
+func encodeLine(k provider.Kline) ([]byte, error) {
+	line, err := json.Marshal(k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode candle: %v", err)
+	}
+	return append(line, '\n'), nil
+}
+
+func hashLine(line []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(bytes.TrimSpace(line))
+	return h.Sum64()
+}
+
+func writePartition(path string, klines []provider.Kline) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write candle partition: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, k := range klines {
+		line, err := encodeLine(k)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(line)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write candle partition: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write candle partition: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace candle partition: %v", err)
+	}
+	return nil
+}
+
+// merge sorts candles by open time; later candles replace earlier ones with
+// the same open time.
+func merge(existing, updates []provider.Kline) []provider.Kline {
+	byOpenTime := make(map[int64]provider.Kline, len(existing)+len(updates))
+	for _, k := range existing {
+		byOpenTime[k.OpenTime] = k
+	}
+	for _, k := range updates {
+		byOpenTime[k.OpenTime] = k
+	}
+
+	merged := make([]provider.Kline, 0, len(byOpenTime))
+	for _, k := range byOpenTime {
+		merged = append(merged, k)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].OpenTime < merged[j].OpenTime })
+	return merged
+}
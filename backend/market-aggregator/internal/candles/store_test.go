@@ -0,0 +1,206 @@
+package candles
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var btcusdt = symbols.Pair{Base: "BTC", Quote: "USDT"}
+
+func minuteKlines(start int64, count int) []provider.Kline {
+	klines := make([]provider.Kline, count)
+	for i := range klines {
+		openTime := start + int64(i)*time.Minute.Milliseconds()
+		klines[i] = provider.Kline{OpenTime: openTime, CloseTime: openTime + time.Minute.Milliseconds() - 1, Close: decimal.NewFromInt(1)}
+	}
+	return klines
+}
+
+func TestStore_PutAndRangeAcrossPartitions(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	store, err := Open(dir)
+	require.NoError(t, err)
+
+	// Two minutes either side of a month boundary
+	start := time.Date(2024, 1, 31, 23, 58, 0, 0, time.UTC).UnixMilli()
+	klines := minuteKlines(start, 4)
+
+	// Act
+	require.NoError(t, store.Put(btcusdt, "1m", klines))
+
+	// Assert
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	stored, err := reopened.Range(btcusdt, "1m", start, start+3*time.Minute.Milliseconds())
+	require.NoError(t, err)
+	require.Len(t, stored, len(klines))
+	for i := range klines {
+		assert.True(t, klines[i].Equal(stored[i]), "candle %d", i)
+	}
+
+	assert.FileExists(t, dir+"/BTCUSDT/1m/2024-01.jsonl")
+	assert.FileExists(t, dir+"/BTCUSDT/1m/2024-02.jsonl")
+}
+
+func TestStore_PutReplacesSameOpenTime(t *testing.T) {
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	require.NoError(t, store.Put(btcusdt, "1m", minuteKlines(start, 2)))
+
+	updated := provider.Kline{OpenTime: start + time.Minute.Milliseconds(), Close: decimal.NewFromInt(2)}
+	require.NoError(t, store.Put(btcusdt, "1m", []provider.Kline{updated}))
+
+	stored, err := store.Range(btcusdt, "1m", start, start+time.Hour.Milliseconds())
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	assert.Equal(t, "2", stored[1].Close.String())
+}
+
+func TestStore_PutAppendsOnlyWhatChanged(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	store, err := Open(dir)
+	require.NoError(t, err)
+	path := dir + "/BTCUSDT/1m/2024-05.jsonl"
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	klines := minuteKlines(start, 4)
+	require.NoError(t, store.Put(btcusdt, "1m", klines[:3]))
+	before, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// Act: two stored candles again, the last one changed and a new one
+	changed := klines[2]
+	changed.Close = decimal.NewFromInt(2)
+	require.NoError(t, store.Put(btcusdt, "1m", []provider.Kline{klines[1], klines[0], changed, klines[3]}))
+
+	// Assert: the untouched lines are still the file's prefix
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := bytes.SplitAfter(before, []byte("\n"))
+	assert.True(t, bytes.HasPrefix(after, bytes.Join(lines[:2], nil)))
+
+	stored, err := store.Range(btcusdt, "1m", start, start+time.Hour.Milliseconds())
+	require.NoError(t, err)
+	require.Len(t, stored, 4)
+	assert.Equal(t, "2", stored[2].Close.String())
+	for i := 1; i < len(stored); i++ {
+		assert.Less(t, stored[i-1].OpenTime, stored[i].OpenTime)
+	}
+}
+
+func TestStore_PutFillsHoleInOrder(t *testing.T) {
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	klines := minuteKlines(start, 5)
+	require.NoError(t, store.Put(btcusdt, "1m", append(klines[:2:2], klines[3:]...)))
+	require.NoError(t, store.Put(btcusdt, "1m", klines[2:3]))
+
+	stored, ok := store.Covered(btcusdt, "1m", start, start+4*time.Minute.Milliseconds())
+	require.True(t, ok)
+	for i := range klines {
+		assert.Equal(t, klines[i].OpenTime, stored[i].OpenTime)
+	}
+}
+
+func TestStore_IgnoresTornAppend(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	store, err := Open(dir)
+	require.NoError(t, err)
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	klines := minuteKlines(start, 3)
+	require.NoError(t, store.Put(btcusdt, "1m", klines[:2]))
+
+	path := dir + "/BTCUSDT/1m/2024-05.jsonl"
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"openTime":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// Act
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	stored, readErr := reopened.Range(btcusdt, "1m", start, start+time.Hour.Milliseconds())
+	putErr := reopened.Put(btcusdt, "1m", klines[2:])
+
+	// Assert
+	require.NoError(t, readErr)
+	assert.Len(t, stored, 2)
+	require.NoError(t, putErr)
+	stored, err = reopened.Range(btcusdt, "1m", start, start+time.Hour.Milliseconds())
+	require.NoError(t, err)
+	assert.Len(t, stored, 3)
+}
+
+func TestStore_Covered(t *testing.T) {
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	klines := minuteKlines(start, 5)
+	require.NoError(t, store.Put(btcusdt, "1m", append(klines[:2:2], klines[3:]...)))
+
+	_, ok := store.Covered(btcusdt, "1m", start, start+time.Minute.Milliseconds())
+	assert.True(t, ok)
+	_, ok = store.Covered(btcusdt, "1m", start, start+4*time.Minute.Milliseconds())
+	assert.False(t, ok)
+}
+
+func TestStore_RejectsUnsafeSymbols(t *testing.T) {
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	assert.Error(t, store.Put(symbols.Pair{Base: "../..", Quote: "etc"}, "1m", minuteKlines(0, 1)))
+	assert.Error(t, store.Put(btcusdt, "7x", minuteKlines(0, 1)))
+}
+
+func TestFindGaps(t *testing.T) {
+	minute := time.Minute.Milliseconds()
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	klines := minuteKlines(start, 6)
+	sparse := []provider.Kline{klines[1], klines[2], klines[4]}
+
+	gaps, err := FindGaps("1m", sparse, start, start+5*minute)
+
+	require.NoError(t, err)
+	assert.Equal(t, []Gap{
+		{Start: start, End: start + minute - 1},
+		{Start: start + 3*minute, End: start + 4*minute - 1},
+		{Start: start + 5*minute, End: start + 5*minute},
+	}, gaps)
+}
+
+func TestOpenTime(t *testing.T) {
+	// Wednesday 2024-05-15 13:45 UTC
+	ts := time.Date(2024, 5, 15, 13, 45, 30, 0, time.UTC).UnixMilli()
+
+	cases := map[string]time.Time{
+		"15m": time.Date(2024, 5, 15, 13, 45, 0, 0, time.UTC),
+		"4h":  time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC),
+		"1d":  time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC),
+		"1w":  time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC),
+		"1M":  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for interval, expected := range cases {
+		openTime, err := OpenTime(interval, ts)
+		require.NoError(t, err)
+		assert.Equal(t, expected.UnixMilli(), openTime, interval)
+	}
+
+	_, err := OpenTime("7x", ts)
+	assert.Error(t, err)
+}
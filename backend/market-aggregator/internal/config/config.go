@@ -0,0 +1,448 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/candles"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/orderbook"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/service"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/stream"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/tracing"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// Config holds every setting of the market aggregator. The log, providers,
+// cache, timeouts, klines and precision sections can change while serving
+// (see Reload); the others take effect on restart.
+type Config struct {
+	Server     Server               `json:"server"`
+	Log        Log                  `json:"log"`
+	Binance    Binance              `json:"binance"`
+	CoinGecko  CoinGecko            `json:"coingecko"`
+	Retry      Retry                `json:"retry"`
+	Providers  Providers            `json:"providers"`
+	Breaker    Breaker              `json:"breaker"`
+	Redis      Redis                `json:"redis"`
+	Cache      Cache                `json:"cache"`
+	Timeouts   Timeouts             `json:"timeouts"`
+	Klines     Klines               `json:"klines"`
+	Precision  map[string]Precision `json:"precision"`
+	Candles    Candles              `json:"candles"`
+	OrderBooks OrderBooks           `json:"orderBooks"`
+	Stream     Stream               `json:"stream"`
+	Tracing    Tracing              `json:"tracing"`
+}
+
+type Server struct {
+	Port    string `json:"port"`
+	GinMode string `json:"ginMode"`
+	// CORSOrigins are the allowed origins; "*" allows any
+	CORSOrigins []string `json:"corsOrigins"`
+	// ShutdownTimeout bounds the wait for requests in flight on shutdown
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+}
+
+type Log struct {
+	Level string `json:"level"`
+}
+
+type Binance struct {
+	BaseURL   string   `json:"baseURL"`
+	StreamURL string   `json:"streamURL"`
+	Timeout   Duration `json:"timeout"`
+	// WeightLimit is the request weight budgeted per minute
+	WeightLimit int `json:"weightLimit"`
+}
+
+type CoinGecko struct {
+	BaseURL        string   `json:"baseURL"`
+	Timeout        Duration `json:"timeout"`
+	CallsPerMinute int      `json:"callsPerMinute"`
+	// CoinOverrides is an optional JSON file mapping assets to coin IDs
+	CoinOverrides string   `json:"coinOverrides"`
+	CoinsRefresh  Duration `json:"coinsRefresh"`
+}
+
+// Retry applies to upstream calls of both venues.
+type Retry struct {
+	// Attempts counts the first call; 1 disables retries
+	Attempts  int      `json:"attempts"`
+	BaseDelay Duration `json:"baseDelay"`
+	MaxDelay  Duration `json:"maxDelay"`
+}
+
+type Providers struct {
+	// Priority lists provider names; later providers are fallbacks
+	Priority []string `json:"priority"`
+}
+
+type Breaker struct {
+	ErrorRate   float64  `json:"errorRate"`
+	SlowCall    Duration `json:"slowCall"`
+	OpenTimeout Duration `json:"openTimeout"`
+}
+
+type Redis struct {
+	// URL enables the shared cache; empty keeps the cache in process
+	URL       string `json:"url"`
+	Namespace string `json:"namespace"`
+}
+
+type Cache struct {
+	Ticker         CachePolicy `json:"ticker"`
+	FallbackTicker CachePolicy `json:"fallbackTicker"`
+	Klines         CachePolicy `json:"klines"`
+	KlineHistory   CachePolicy `json:"klineHistory"`
+	Depth          CachePolicy `json:"depth"`
+	Index          CachePolicy `json:"index"`
+	HotKeys        int         `json:"hotKeys"`
+}
+
+// CachePolicy serves an entry fresh for TTL, then stale while it is
+// refreshed until StaleTTL.
+type CachePolicy struct {
+	TTL      Duration `json:"ttl"`
+	StaleTTL Duration `json:"staleTTL"`
+}
+
+type Timeouts struct {
+	Ticker     Duration `json:"ticker"`
+	Tickers    Duration `json:"tickers"`
+	Klines     Duration `json:"klines"`
+	KlineRange Duration `json:"klineRange"`
+	Depth      Duration `json:"depth"`
+	Index      Duration `json:"index"`
+}
+
+type Klines struct {
+	MaxSpan Duration `json:"maxSpan"`
+}
+
+// Precision is the decimal places published for a symbol's prices and
+// quantities.
+type Precision struct {
+	Price    int32 `json:"price"`
+	Quantity int32 `json:"quantity"`
+}
+
+type Candles struct {
+	// StoreDir enables the local candle store; empty disables it
+	StoreDir  string   `json:"storeDir"`
+	Symbols   []string `json:"symbols"`
+	Intervals []string `json:"intervals"`
+	History   Duration `json:"history"`
+}
+
+type OrderBooks struct {
+	// Symbols have their order books maintained from the depth stream
+	Symbols []string `json:"symbols"`
+	// MaxAge is how long a book's stream may go silent and the book still be
+	// served
+	MaxAge Duration `json:"maxAge"`
+}
+
+type Stream struct {
+	// MaxSubscriptions is the most topics one WebSocket client may watch
+	MaxSubscriptions int `json:"maxSubscriptions"`
+}
+
+type Tracing struct {
+	Exporter    string  `json:"exporter"`
+	File        string  `json:"file"`
+	SampleRatio float64 `json:"sampleRatio"`
+}
+
+// Default returns the components' own defaults.
+func Default() Config {
+	binance := client.DefaultBinanceConfig()
+	coinGecko := client.DefaultCoinGeckoConfig()
+	retry := client.DefaultRetryPolicy()
+	coinList := provider.DefaultCoinListConfig()
+	breaker := provider.DefaultBreakerConfig()
+	cache := service.DefaultCacheConfig()
+	timeouts := service.DefaultTimeoutConfig()
+	backfill := candles.DefaultBackfillConfig()
+	traces := tracing.DefaultConfig()
+
+	return Config{
+		Server: Server{
+			Port:            "8080",
+			GinMode:         "release",
+			CORSOrigins:     []string{"*"},
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Log: Log{Level: "info"},
+		Binance: Binance{
+			BaseURL:     binance.BaseURL,
+			StreamURL:   client.BinanceStreamURL,
+			Timeout:     Duration(binance.Timeout),
+			WeightLimit: client.DefaultBinanceRateLimit().Limit,
+		},
+		CoinGecko: CoinGecko{
+			BaseURL:        coinGecko.BaseURL,
+			Timeout:        Duration(coinGecko.Timeout),
+			CallsPerMinute: client.DefaultCoinGeckoRateLimit().Limit,
+			CoinsRefresh:   Duration(coinList.RefreshInterval),
+		},
+		Retry: Retry{
+			Attempts:  retry.MaxAttempts,
+			BaseDelay: Duration(retry.BaseDelay),
+			MaxDelay:  Duration(retry.MaxDelay),
+		},
+		Providers: Providers{Priority: []string{"binance", "coingecko"}},
+		Breaker: Breaker{
+			ErrorRate:   breaker.ErrorRate,
+			SlowCall:    Duration(breaker.SlowCall),
+			OpenTimeout: Duration(breaker.OpenTimeout),
+		},
+		Redis: Redis{Namespace: "market-aggregator:v1"},
+		Cache: Cache{
+			Ticker:         policy(cache.Ticker),
+			FallbackTicker: policy(cache.FallbackTicker),
+			Klines:         policy(cache.Klines),
+			KlineHistory:   policy(cache.KlineHistory),
+			Depth:          policy(cache.Depth),
+			Index:          policy(cache.Index),
+			HotKeys:        cache.HotKeys,
+		},
+		Timeouts: Timeouts{
+			Ticker:     Duration(timeouts.Ticker),
+			Tickers:    Duration(timeouts.Tickers),
+			Klines:     Duration(timeouts.Klines),
+			KlineRange: Duration(timeouts.KlineRange),
+			Depth:      Duration(timeouts.Depth),
+			Index:      Duration(timeouts.Index),
+		},
+		Klines:    Klines{MaxSpan: Duration(service.DefaultKlineRangeConfig().MaxSpan)},
+		Precision: map[string]Precision{},
+		Candles: Candles{
+			Intervals: backfill.Intervals,
+			History:   Duration(backfill.History),
+		},
+		OrderBooks: OrderBooks{MaxAge: Duration(orderbook.DefaultConfig().MaxAge)},
+		Stream:     Stream{MaxSubscriptions: stream.DefaultConfig().MaxSubscriptions},
+		Tracing: Tracing{
+			Exporter:    traces.Exporter,
+			File:        traces.File,
+			SampleRatio: traces.SampleRatio,
+		},
+	}
+}
+
+func policy(p service.CachePolicy) CachePolicy {
+	return CachePolicy{TTL: Duration(p.SoftTTL), StaleTTL: Duration(p.HardTTL)}
+}
+
+// Client returns the policy as the clients apply it.
+func (r Retry) Client() client.RetryPolicy {
+	return client.RetryPolicy{
+		MaxAttempts: r.Attempts,
+		BaseDelay:   time.Duration(r.BaseDelay),
+		MaxDelay:    time.Duration(r.MaxDelay),
+	}
+}
+
+// Service returns the policy as the service applies it.
+func (p CachePolicy) Service() service.CachePolicy {
+	return service.CachePolicy{SoftTTL: time.Duration(p.TTL), HardTTL: time.Duration(p.StaleTTL)}
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port <= 65535, "server.port: %q is not a TCP port", c.Server.Port)
+	check(c.Server.GinMode == "debug" || c.Server.GinMode == "release" || c.Server.GinMode == "test",
+		"server.ginMode: %q is not debug, release or test", c.Server.GinMode)
+	check(len(c.Server.CORSOrigins) > 0, "server.corsOrigins: must not be empty")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdownTimeout: must be positive")
+
+	_, err = zerolog.ParseLevel(c.Log.Level)
+	check(err == nil && c.Log.Level != "", "log.level: %q is not a log level", c.Log.Level)
+
+	check(validURL(c.Binance.BaseURL, "http", "https"), "binance.baseURL: %q is not an http(s) URL", c.Binance.BaseURL)
+	check(validURL(c.Binance.StreamURL, "ws", "wss"), "binance.streamURL: %q is not a ws(s) URL", c.Binance.StreamURL)
+	check(c.Binance.Timeout > 0, "binance.timeout: must be positive")
+	check(c.Binance.WeightLimit > 0, "binance.weightLimit: must be positive")
+
+	check(validURL(c.CoinGecko.BaseURL, "http", "https"), "coingecko.baseURL: %q is not an http(s) URL", c.CoinGecko.BaseURL)
+	check(c.CoinGecko.Timeout > 0, "coingecko.timeout: must be positive")
+	check(c.CoinGecko.CallsPerMinute > 0, "coingecko.callsPerMinute: must be positive")
+	check(c.CoinGecko.CoinsRefresh > 0, "coingecko.coinsRefresh: must be positive")
+
+	check(c.Retry.Attempts > 0, "retry.attempts: must be positive")
+	check(c.Retry.BaseDelay > 0, "retry.baseDelay: must be positive")
+	check(c.Retry.MaxDelay >= c.Retry.BaseDelay, "retry.maxDelay: must not be shorter than the base delay")
+
+	check(c.Breaker.ErrorRate > 0 && c.Breaker.ErrorRate <= 1, "breaker.errorRate: must be in (0, 1]")
+	check(c.Breaker.SlowCall > 0, "breaker.slowCall: must be positive")
+	check(c.Breaker.OpenTimeout > 0, "breaker.openTimeout: must be positive")
+
+	if c.Redis.URL != "" {
+		_, err := redis.ParseURL(c.Redis.URL)
+		check(err == nil, "redis.url: %v", err)
+	}
+
+	for _, p := range []struct {
+		name   string
+		policy CachePolicy
+	}{
+		{"ticker", c.Cache.Ticker},
+		{"fallbackTicker", c.Cache.FallbackTicker},
+		{"klines", c.Cache.Klines},
+		{"klineHistory", c.Cache.KlineHistory},
+		{"depth", c.Cache.Depth},
+		{"index", c.Cache.Index},
+	} {
+		check(p.policy.TTL > 0, "cache.%s.ttl: must be positive", p.name)
+		check(p.policy.StaleTTL >= p.policy.TTL, "cache.%s.staleTTL: must not be shorter than the TTL", p.name)
+	}
+	check(c.Cache.HotKeys >= 0, "cache.hotKeys: must not be negative")
+
+	for _, t := range []struct {
+		name    string
+		timeout Duration
+	}{
+		{"ticker", c.Timeouts.Ticker},
+		{"tickers", c.Timeouts.Tickers},
+		{"klines", c.Timeouts.Klines},
+		{"klineRange", c.Timeouts.KlineRange},
+		{"depth", c.Timeouts.Depth},
+		{"index", c.Timeouts.Index},
+	} {
+		check(t.timeout >= 0, "timeouts.%s: must not be negative", t.name)
+	}
+
+	check(c.Klines.MaxSpan > 0, "klines.maxSpan: must be positive")
+
+	for _, symbol := range sortedSymbols(c.Precision) {
+		p := c.Precision[symbol]
+		check(p.Price >= 0 && p.Quantity >= 0, "precision.%s: decimal places must not be negative", symbol)
+	}
+
+	for _, interval := range c.Candles.Intervals {
+		check(service.IsNativeInterval(interval), "candles.intervals: %q is not a native interval", interval)
+	}
+	check(c.Candles.History > 0, "candles.history: must be positive")
+
+	check(c.OrderBooks.MaxAge > 0, "orderBooks.maxAge: must be positive")
+
+	check(c.Stream.MaxSubscriptions > 0, "stream.maxSubscriptions: must be positive")
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		check(c.Tracing.File != "", "tracing.file: required by the file exporter")
+	default:
+		check(false, "tracing.exporter: %q is not none, stdout or file", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio: must be in [0, 1]")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func validURL(raw string, schemes ...string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy safe to log, with passwords in URLs masked.
+func (c Config) Redacted() Config {
+	c.Binance.BaseURL = redactURL(c.Binance.BaseURL)
+	c.Binance.StreamURL = redactURL(c.Binance.StreamURL)
+	c.CoinGecko.BaseURL = redactURL(c.CoinGecko.BaseURL)
+	c.Redis.URL = redactURL(c.Redis.URL)
+	return c
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		// Unparseable values may still hold credentials
+		return "REDACTED"
+	}
+	return u.Redacted()
+}
+
+// Reload returns c with the settings of next that can change while serving,
+// and the names of the sections that differ in next but need a restart.
+func (c Config) Reload(next Config) (Config, []string) {
+	var restart []string
+	for _, section := range []struct {
+		name          string
+		current, next interface{}
+	}{
+		{"server", c.Server, next.Server},
+		{"binance", c.Binance, next.Binance},
+		{"coingecko", c.CoinGecko, next.CoinGecko},
+		{"retry", c.Retry, next.Retry},
+		{"breaker", c.Breaker, next.Breaker},
+		{"redis", c.Redis, next.Redis},
+		{"candles", c.Candles, next.Candles},
+		{"orderBooks", c.OrderBooks, next.OrderBooks},
+		{"stream", c.Stream, next.Stream},
+		{"tracing", c.Tracing, next.Tracing},
+	} {
+		if !reflect.DeepEqual(section.current, section.next) {
+			restart = append(restart, section.name)
+		}
+	}
+
+	c.Log = next.Log
+	c.Providers = next.Providers
+	c.Cache = next.Cache
+	c.Timeouts = next.Timeouts
+	c.Klines = next.Klines
+	c.Precision = next.Precision
+	return c, restart
+}
+
+// Duration is a time.Duration written like "30s" in configuration files.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
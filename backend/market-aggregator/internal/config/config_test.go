@@ -0,0 +1,140 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func env(values map[string]string) func(string) string {
+	return func(name string) string { return values[name] }
+}
+
+func TestLoader_FlagsOverrideEnvironmentOverrideFile(t *testing.T) {
+	// Arrange
+	file := writeFile(t, `{
+		"server": {"port": "9000"},
+		"cache": {"ticker": {"ttl": "15s", "staleTTL": "1m"}},
+		"precision": {"BTCUSDT": {"price": 2, "quantity": 5}}
+	}`)
+	loader, err := NewLoader([]string{"-config", file, "-port", "9200"}, env(map[string]string{
+		"PORT":           "9100",
+		"KLINES_TIMEOUT": "3s",
+	}))
+	require.NoError(t, err)
+
+	// Act
+	config, err := loader.Load()
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "9200", config.Server.Port)
+	assert.Equal(t, Duration(3*time.Second), config.Timeouts.Klines)
+	assert.Equal(t, CachePolicy{TTL: Duration(15 * time.Second), StaleTTL: Duration(time.Minute)}, config.Cache.Ticker)
+	assert.Equal(t, map[string]Precision{"BTCUSDT": {Price: 2, Quantity: 5}}, config.Precision)
+	assert.Equal(t, Default().Cache.Klines, config.Cache.Klines)
+}
+
+func TestLoader_ParsesListsAndPrecision(t *testing.T) {
+	// Arrange
+	loader, err := NewLoader(nil, env(map[string]string{
+		"CANDLE_SYMBOLS":   "BTCUSDT, ETH-USDT,",
+		"SYMBOL_PRECISION": "BTCUSDT:2:5,ETHUSDT:2:4",
+	}))
+	require.NoError(t, err)
+
+	// Act
+	config, err := loader.Load()
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BTCUSDT", "ETH-USDT"}, config.Candles.Symbols)
+	assert.Equal(t, map[string]Precision{"BTCUSDT": {2, 5}, "ETHUSDT": {2, 4}}, config.Precision)
+}
+
+func TestLoader_RejectsUnknownFileSettings(t *testing.T) {
+	// Arrange
+	loader, err := NewLoader([]string{"-config", writeFile(t, `{"cache": {"tikcer": {}}}`)}, env(nil))
+	require.NoError(t, err)
+
+	// Act
+	_, err = loader.Load()
+
+	// Assert
+	assert.ErrorContains(t, err, `unknown field "tikcer"`)
+}
+
+func TestLoader_ReportsEveryInvalidSetting(t *testing.T) {
+	// Arrange
+	loader, err := NewLoader(nil, env(map[string]string{
+		"PORT":               "http",
+		"BINANCE_BASE_URL":   "api.binance.com",
+		"TICKER_STALE_TTL":   "10s",
+		"BREAKER_ERROR_RATE": "1.5",
+	}))
+	require.NoError(t, err)
+
+	// Act
+	_, err = loader.Load()
+
+	// Assert
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "server.port")
+	assert.ErrorContains(t, err, "binance.baseURL")
+	assert.ErrorContains(t, err, "cache.ticker.staleTTL")
+	assert.ErrorContains(t, err, "breaker.errorRate")
+}
+
+func TestLoader_RejectsMalformedValues(t *testing.T) {
+	loader, err := NewLoader([]string{"-kline-max-span", "a month"}, env(nil))
+	require.NoError(t, err)
+
+	_, err = loader.Load()
+
+	assert.ErrorContains(t, err, "-kline-max-span")
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	// Arrange
+	config := Default()
+	config.Redis.URL = "redis://:s3cret@redis:6379/0"
+
+	// Act
+	redacted := config.Redacted()
+
+	// Assert
+	assert.NotContains(t, redacted.Redis.URL, "s3cret")
+	assert.Equal(t, "redis://:xxxxx@redis:6379/0", redacted.Redis.URL)
+	assert.Equal(t, "redis://:s3cret@redis:6379/0", config.Redis.URL)
+}
+
+func TestConfig_Reload(t *testing.T) {
+	// Arrange
+	current := Default()
+	next := Default()
+	next.Cache.HotKeys = 10
+	next.Timeouts.Depth = Duration(2 * time.Second)
+	next.Server.Port = "9000"
+	next.Redis.URL = "redis://redis:6379/0"
+
+	// Act
+	updated, restart := current.Reload(next)
+
+	// Assert
+	assert.Equal(t, 10, updated.Cache.HotKeys)
+	assert.Equal(t, Duration(2*time.Second), updated.Timeouts.Depth)
+	assert.Equal(t, "8080", updated.Server.Port)
+	assert.Empty(t, updated.Redis.URL)
+	assert.Equal(t, []string{"server", "redis"}, restart)
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Loader builds the configuration from the defaults, a JSON file, the
+// environment and flags, each overriding the last. Flags are parsed once;
+// the file and environment are read again on every Load so a running
+// service can reload them.
+type Loader struct {
+	// File is the JSON file named by -config or CONFIG_FILE, if any
+	File string
+	// Print is set by -print-config: print the configuration and exit
+	Print bool
+
+	getenv func(string) string
+	flags  map[string]string
+}
+
+// NewLoader parses the command line args. Every environment variable has a
+// flag of the same name in lower case with dashes, e.g. -binance-base-url.
+func NewLoader(args []string, getenv func(string) string) (*Loader, error) {
+	l := &Loader{getenv: getenv, flags: make(map[string]string)}
+
+	fs := flag.NewFlagSet("market-aggregator", flag.ContinueOnError)
+	fs.StringVar(&l.File, "config", getenv("CONFIG_FILE"), "JSON configuration file, overridden by the environment and flags ($CONFIG_FILE)")
+	fs.BoolVar(&l.Print, "print-config", false, "print the configuration with secrets redacted and exit")
+	defaults := Default()
+	for _, s := range defaults.settings() {
+		fs.String(s.flag(), s.value.String(), fmt.Sprintf("%s ($%s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	fs.Visit(func(f *flag.Flag) {
+		l.flags[f.Name] = f.Value.String()
+	})
+	return l, nil
+}
+
+// Load reads and validates the configuration.
+func (l *Loader) Load() (Config, error) {
+	config := Default()
+	if l.File != "" {
+		if err := config.readFile(l.File); err != nil {
+			return Config{}, err
+		}
+	}
+
+	settings := config.settings()
+	for _, s := range settings {
+		if value := l.getenv(s.env); value != "" {
+			if err := s.value.Set(value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %v", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if value, ok := l.flags[s.flag()]; ok {
+			if err := s.value.Set(value); err != nil {
+				return Config{}, fmt.Errorf("invalid -%s: %v", s.flag(), err)
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// readFile overrides the settings present in the JSON file at path.
+// Unknown fields are rejected so misspelt settings do not go unnoticed.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// setting binds an environment variable and its flag to a field.
+type setting struct {
+	env   string
+	usage string
+	value flag.Value
+}
+
+func (s setting) flag() string {
+	return strings.ReplaceAll(strings.ToLower(s.env), "_", "-")
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"PORT", "HTTP listen port", (*stringValue)(&c.Server.Port)},
+		{"GIN_MODE", "gin mode: debug, release or test", (*stringValue)(&c.Server.GinMode)},
+		{"CORS_ORIGINS", "comma-separated allowed origins, * for any", (*listValue)(&c.Server.CORSOrigins)},
+		{"SHUTDOWN_TIMEOUT", "wait for requests in flight on shutdown", (*durationValue)(&c.Server.ShutdownTimeout)},
+		{"LOG_LEVEL", "log level: trace, debug, info, warn or error", (*stringValue)(&c.Log.Level)},
+
+		{"BINANCE_BASE_URL", "Binance REST API", (*stringValue)(&c.Binance.BaseURL)},
+		{"BINANCE_STREAM_URL", "Binance WebSocket streams", (*stringValue)(&c.Binance.StreamURL)},
+		{"BINANCE_TIMEOUT", "timeout of each Binance call", (*durationValue)(&c.Binance.Timeout)},
+		{"BINANCE_WEIGHT_LIMIT", "Binance request weight budgeted per minute", (*intValue)(&c.Binance.WeightLimit)},
+		{"COINGECKO_BASE_URL", "CoinGecko REST API", (*stringValue)(&c.CoinGecko.BaseURL)},
+		{"COINGECKO_TIMEOUT", "timeout of each CoinGecko call", (*durationValue)(&c.CoinGecko.Timeout)},
+		{"COINGECKO_CALLS_PER_MINUTE", "CoinGecko calls budgeted per minute", (*intValue)(&c.CoinGecko.CallsPerMinute)},
+		{"COINGECKO_COIN_OVERRIDES", "JSON file mapping assets to CoinGecko coin IDs", (*stringValue)(&c.CoinGecko.CoinOverrides)},
+		{"COINGECKO_COINS_REFRESH", "CoinGecko coin list refresh interval", (*durationValue)(&c.CoinGecko.CoinsRefresh)},
+		{"UPSTREAM_RETRY_ATTEMPTS", "attempts per upstream call, the first included", (*intValue)(&c.Retry.Attempts)},
+		{"UPSTREAM_RETRY_BASE_DELAY", "wait before the first retry, doubled per retry", (*durationValue)(&c.Retry.BaseDelay)},
+		{"UPSTREAM_RETRY_MAX_DELAY", "longest wait between retries", (*durationValue)(&c.Retry.MaxDelay)},
+
+		{"PROVIDER_PRIORITY", "comma-separated provider order; later providers are fallbacks", (*listValue)(&c.Providers.Priority)},
+		{"BREAKER_ERROR_RATE", "share of failed calls that opens a provider's breaker", (*floatValue)(&c.Breaker.ErrorRate)},
+		{"BREAKER_SLOW_CALL", "latency above which a call counts as slow", (*durationValue)(&c.Breaker.SlowCall)},
+		{"BREAKER_OPEN_TIMEOUT", "time an open breaker waits before probing", (*durationValue)(&c.Breaker.OpenTimeout)},
+
+		{"REDIS_URL", "shared Redis cache; empty keeps the cache in process", (*stringValue)(&c.Redis.URL)},
+		{"CACHE_NAMESPACE", "prefix of Redis cache keys", (*stringValue)(&c.Redis.Namespace)},
+		{"TICKER_CACHE_TTL", "time a ticker is served fresh", (*durationValue)(&c.Cache.Ticker.TTL)},
+		{"TICKER_STALE_TTL", "time a ticker is served at all", (*durationValue)(&c.Cache.Ticker.StaleTTL)},
+		{"FALLBACK_TICKER_CACHE_TTL", "time a fallback provider's ticker is served fresh", (*durationValue)(&c.Cache.FallbackTicker.TTL)},
+		{"FALLBACK_TICKER_STALE_TTL", "time a fallback provider's ticker is served at all", (*durationValue)(&c.Cache.FallbackTicker.StaleTTL)},
+		{"KLINES_CACHE_TTL", "time klines are served fresh", (*durationValue)(&c.Cache.Klines.TTL)},
+		{"KLINES_STALE_TTL", "time klines are served at all", (*durationValue)(&c.Cache.Klines.StaleTTL)},
+		{"KLINE_HISTORY_CACHE_TTL", "time a kline range that ended over an hour ago is served fresh", (*durationValue)(&c.Cache.KlineHistory.TTL)},
+		{"KLINE_HISTORY_STALE_TTL", "time a kline range that ended over an hour ago is served at all", (*durationValue)(&c.Cache.KlineHistory.StaleTTL)},
+		{"DEPTH_CACHE_TTL", "time an order book is served fresh", (*durationValue)(&c.Cache.Depth.TTL)},
+		{"DEPTH_STALE_TTL", "time an order book is served at all", (*durationValue)(&c.Cache.Depth.StaleTTL)},
+		{"INDEX_CACHE_TTL", "time an index price is served fresh", (*durationValue)(&c.Cache.Index.TTL)},
+		{"INDEX_STALE_TTL", "time an index price is served at all", (*durationValue)(&c.Cache.Index.StaleTTL)},
+		{"CACHE_HOT_KEYS", "most requested keys refreshed ahead of expiry", (*intValue)(&c.Cache.HotKeys)},
+
+		{"TICKER_TIMEOUT", "deadline of a ticker request's upstream work", (*durationValue)(&c.Timeouts.Ticker)},
+		{"TICKERS_TIMEOUT", "deadline of a multi-ticker request's batch calls", (*durationValue)(&c.Timeouts.Tickers)},
+		{"KLINES_TIMEOUT", "deadline of a klines request's upstream work", (*durationValue)(&c.Timeouts.Klines)},
+		{"KLINE_RANGE_TIMEOUT", "deadline of a paged kline range request", (*durationValue)(&c.Timeouts.KlineRange)},
+		{"DEPTH_TIMEOUT", "deadline of a depth request's upstream work", (*durationValue)(&c.Timeouts.Depth)},
+		{"INDEX_TIMEOUT", "deadline of an index request's upstream work", (*durationValue)(&c.Timeouts.Index)},
+		{"KLINE_MAX_SPAN", "largest startTime..endTime window served", (*durationValue)(&c.Klines.MaxSpan)},
+		{"SYMBOL_PRECISION", "decimal places per symbol as SYMBOL:PRICE:QUANTITY,...", (*precisionValue)(&c.Precision)},
+
+		{"CANDLE_STORE_DIR", "local candle store; empty disables it", (*stringValue)(&c.Candles.StoreDir)},
+		{"CANDLE_SYMBOLS", "comma-separated symbols kept backfilled", (*listValue)(&c.Candles.Symbols)},
+		{"CANDLE_INTERVALS", "comma-separated intervals kept backfilled", (*listValue)(&c.Candles.Intervals)},
+		{"CANDLE_HISTORY", "how far back candles are kept complete", (*durationValue)(&c.Candles.History)},
+		{"DEPTH_STREAM_SYMBOLS", "comma-separated symbols with locally maintained order books", (*listValue)(&c.OrderBooks.Symbols)},
+		{"ORDER_BOOK_MAX_AGE", "time a local order book's stream may go silent and the book still be served", (*durationValue)(&c.OrderBooks.MaxAge)},
+		{"STREAM_MAX_SUBSCRIPTIONS", "most topics one WebSocket client may watch", (*intValue)(&c.Stream.MaxSubscriptions)},
+
+		{"OTEL_TRACES_EXPORTER", "trace exporter: none, stdout or file", (*stringValue)(&c.Tracing.Exporter)},
+		{"OTEL_TRACES_FILE", "file spans are appended to by the file exporter", (*stringValue)(&c.Tracing.File)},
+		{"OTEL_TRACES_SAMPLER_ARG", "share of new traces recorded", (*floatValue)(&c.Tracing.SampleRatio)},
+	}
+}
+
+type stringValue string
+
+func (v *stringValue) String() string { return string(*v) }
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(strings.TrimSpace(s))
+	return nil
+}
+
+type intValue int
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+type floatValue float64
+
+func (v *floatValue) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
+	}
+	*v = floatValue(f)
+	return nil
+}
+
+type durationValue Duration
+
+func (v *durationValue) String() string { return Duration(*v).String() }
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+// listValue is a comma-separated list; blank items are dropped.
+type listValue []string
+
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+
+func (v *listValue) Set(s string) error {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*v = items
+	return nil
+}
+
+// precisionValue is a comma-separated list of SYMBOL:PRICE:QUANTITY.
+type precisionValue map[string]Precision
+
+func (v *precisionValue) String() string {
+	entries := make([]string, 0, len(*v))
+	for _, symbol := range sortedSymbols(*v) {
+		p := (*v)[symbol]
+		entries = append(entries, fmt.Sprintf("%s:%d:%d", symbol, p.Price, p.Quantity))
+	}
+	return strings.Join(entries, ",")
+}
+
+func (v *precisionValue) Set(s string) error {
+	precisions := make(map[string]Precision)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return fmt.Errorf("%q is not SYMBOL:PRICE:QUANTITY", entry)
+		}
+		price, priceErr := strconv.ParseInt(parts[1], 10, 32)
+		quantity, quantityErr := strconv.ParseInt(parts[2], 10, 32)
+		if priceErr != nil || quantityErr != nil {
+			return fmt.Errorf("%q is not SYMBOL:PRICE:QUANTITY", entry)
+		}
+		precisions[parts[0]] = Precision{Price: int32(price), Quantity: int32(quantity)}
+	}
+	*v = precisions
+	return nil
+}
+
+func sortedSymbols(m map[string]Precision) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -5,33 +5,61 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
 )
 
-type HealthHandler struct{}
+type HealthHandler struct {
+	providers  *provider.Registry
+	rateLimits []*client.RateLimiter
+}
 
 type HealthResponse struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Service   string    `json:"service"`
-	Version   string    `json:"version"`
-	Uptime    string    `json:"uptime"`
+	Status     string                  `json:"status"`
+	Timestamp  time.Time               `json:"timestamp"`
+	Service    string                  `json:"service"`
+	Version    string                  `json:"version"`
+	Uptime     string                  `json:"uptime"`
+	Providers  []provider.Health       `json:"providers"`
+	RateLimits []client.RateLimitStats `json:"rateLimits"`
 }
 
 var startTime = time.Now()
 
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
+func NewHealthHandler(providers *provider.Registry) *HealthHandler {
+	return &HealthHandler{providers: providers}
+}
+
+// UseRateLimiters reports the upstream request budgets of limiters.
+func (h *HealthHandler) UseRateLimiters(limiters ...*client.RateLimiter) {
+	h.rateLimits = append(h.rateLimits, limiters...)
 }
 
 func (h *HealthHandler) Health(c *gin.Context) {
 	uptime := time.Since(startTime)
 	
+	// Degraded while any provider's breaker is not closed
+	status := "healthy"
+	providers := h.providers.Health()
+	for _, p := range providers {
+		if p.State != provider.StateClosed {
+			status = "degraded"
+		}
+	}
+
+	rateLimits := make([]client.RateLimitStats, 0, len(h.rateLimits))
+	for _, limiter := range h.rateLimits {
+		rateLimits = append(rateLimits, limiter.Stats())
+	}
+
 	response := HealthResponse{
-		Status:    "healthy",
-		Timestamp: time.Now(),
-		Service:   "market-aggregator",
-		Version:   "0.1.0-dev",
-		Uptime:    uptime.String(),
+		Status:     status,
+		Timestamp:  time.Now(),
+		Service:    "market-aggregator",
+		Version:    "0.1.0-dev",
+		Uptime:     uptime.String(),
+		Providers:  providers,
+		RateLimits: rateLimits,
 	}
 
 	c.JSON(http.StatusOK, response)
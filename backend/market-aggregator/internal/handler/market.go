@@ -1,115 +1,319 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/candles"
 	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/service"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
 	"github.com/rs/zerolog/log"
 )
 
 type MarketHandler struct {
 	marketService *service.MarketService
+	symbols       *symbols.Registry
 }
 
 type ErrorResponse struct {
 	Error     string `json:"error"`
 	Code      string `json:"code"`
 	RequestID string `json:"request_id"`
+	TraceID   string `json:"trace_id,omitempty"`
 	Timestamp int64  `json:"timestamp"`
 }
 
-func NewMarketHandler(marketService *service.MarketService) *MarketHandler {
+// maxTickerSymbols bounds the symbols named in one /tickers request.
+const maxTickerSymbols = 100
+
+type SymbolsResponse struct {
+	Symbols   []symbols.Symbol `json:"symbols"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+func NewMarketHandler(marketService *service.MarketService, symbolRegistry *symbols.Registry) *MarketHandler {
 	return &MarketHandler{
 		marketService: marketService,
+		symbols:       symbolRegistry,
 	}
 }
 
 func (h *MarketHandler) GetTicker(c *gin.Context) {
-	symbol := c.Query("symbol")
-	if symbol == "" {
-		h.respondError(c, http.StatusBadRequest, "MISSING_SYMBOL", "symbol parameter is required")
+	pair, ok := h.resolveSymbol(c, c.Query("symbol"))
+	if !ok {
 		return
 	}
 
-	// Validate symbol format (basic validation)
-	if len(symbol) < 6 || len(symbol) > 12 {
-		h.respondError(c, http.StatusBadRequest, "INVALID_SYMBOL", "symbol format is invalid")
+	ticker, err := h.marketService.GetTicker(c.Request.Context(), pair)
+	if err != nil {
+		log.Error().Err(err).Stringer("symbol", pair).Msg("Failed to get ticker")
+		h.respondError(c, http.StatusServiceUnavailable, "TICKER_UNAVAILABLE", "unable to fetch ticker data")
+		return
+	}
+
+	setAge(c, ticker.Freshness)
+	c.JSON(http.StatusOK, ticker)
+}
+
+// GetTickers serves the tickers of a comma-separated symbols list, or of every
+// trading symbol (optionally of one quoteAsset) when symbols is omitted.
+// Symbols that cannot be served are reported in errors rather than failing
+// the request.
+func (h *MarketHandler) GetTickers(c *gin.Context) {
+	var pairs []symbols.Pair
+	invalid := []service.TickerError{}
+
+	if list := c.Query("symbols"); list != "" {
+		requested := strings.Split(list, ",")
+		if len(requested) > maxTickerSymbols {
+			h.respondError(c, http.StatusBadRequest, "TOO_MANY_SYMBOLS", fmt.Sprintf("at most %d symbols per request", maxTickerSymbols))
+			return
+		}
+		for _, symbol := range requested {
+			pair, err := h.symbols.Resolve(symbol)
+			if err != nil {
+				code := "INVALID_SYMBOL"
+				if errors.Is(err, symbols.ErrUnknownSymbol) {
+					code = "UNKNOWN_SYMBOL"
+				}
+				invalid = append(invalid, service.TickerError{Symbol: strings.TrimSpace(symbol), Code: code, Error: err.Error()})
+				continue
+			}
+			pairs = append(pairs, pair)
+		}
+	} else {
+		if !h.symbols.Loaded() {
+			h.respondError(c, http.StatusServiceUnavailable, "SYMBOLS_UNAVAILABLE", "symbol list is not loaded yet")
+			return
+		}
+		quoteAsset := c.Query("quoteAsset")
+		for _, s := range h.symbols.All() {
+			if s.Status == symbols.StatusTrading && (quoteAsset == "" || s.QuoteAsset == quoteAsset) {
+				pairs = append(pairs, s.Pair)
+			}
+		}
+	}
+
+	tickers := h.marketService.GetTickers(c.Request.Context(), pairs)
+	tickers.Errors = append(invalid, tickers.Errors...)
+	c.JSON(http.StatusOK, tickers)
+}
+
+func (h *MarketHandler) GetIndex(c *gin.Context) {
+	pair, ok := h.resolveSymbol(c, c.Query("symbol"))
+	if !ok {
 		return
 	}
 
-	ticker, err := h.marketService.GetTicker(symbol)
+	index, err := h.marketService.GetIndex(c.Request.Context(), pair)
 	if err != nil {
-		log.Error().Err(err).Str("symbol", symbol).Msg("Failed to get ticker")
-		h.respondError(c, http.StatusServiceUnavailable, "TICKER_UNAVAILABLE", "unable to fetch ticker data")
+		log.Error().Err(err).Stringer("symbol", pair).Msg("Failed to get index")
+		h.respondError(c, http.StatusServiceUnavailable, "INDEX_UNAVAILABLE", "unable to compute index price")
 		return
 	}
 
-	c.JSON(http.StatusOK, ticker)
+	setAge(c, index.Freshness)
+	c.JSON(http.StatusOK, index)
 }
 
 func (h *MarketHandler) GetKlines(c *gin.Context) {
-	symbol := c.Query("symbol")
-	if symbol == "" {
-		h.respondError(c, http.StatusBadRequest, "MISSING_SYMBOL", "symbol parameter is required")
+	pair, ok := h.resolveSymbol(c, c.Query("symbol"))
+	if !ok {
 		return
 	}
 
 	interval := c.DefaultQuery("interval", "1h")
-	limitStr := c.DefaultQuery("limit", "100")
 
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 || limit > 1000 {
-		h.respondError(c, http.StatusBadRequest, "INVALID_LIMIT", "limit must be between 1 and 1000")
+	// startTime/endTime are Unix milliseconds, as in the Binance API
+	var startTime, endTime int64
+	var err error
+	if v := c.Query("startTime"); v != "" {
+		if startTime, err = strconv.ParseInt(v, 10, 64); err != nil || startTime <= 0 {
+			h.respondError(c, http.StatusBadRequest, "INVALID_START_TIME", "startTime must be a Unix timestamp in milliseconds")
+			return
+		}
+	}
+	if v := c.Query("endTime"); v != "" {
+		if endTime, err = strconv.ParseInt(v, 10, 64); err != nil || endTime <= 0 {
+			h.respondError(c, http.StatusBadRequest, "INVALID_END_TIME", "endTime must be a Unix timestamp in milliseconds")
+			return
+		}
+	}
+	if startTime > 0 && endTime > 0 && startTime > endTime {
+		h.respondError(c, http.StatusBadRequest, "INVALID_RANGE", "startTime must not be after endTime")
 		return
 	}
 
-	// Validate interval
-	validIntervals := map[string]bool{
-		"1m": true, "3m": true, "5m": true, "15m": true, "30m": true,
-		"1h": true, "2h": true, "4h": true, "6h": true, "8h": true, "12h": true,
-		"1d": true, "3d": true, "1w": true, "1M": true,
+	// A range is paged through upstream, so its limit is not capped at 1000
+	var limit int
+	if startTime > 0 {
+		if limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil || limit < 0 {
+			h.respondError(c, http.StatusBadRequest, "INVALID_LIMIT", "limit must not be negative")
+			return
+		}
+	} else {
+		limit, err = strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			h.respondError(c, http.StatusBadRequest, "INVALID_LIMIT", "limit must be between 1 and 1000")
+			return
+		}
 	}
-	if !validIntervals[interval] {
+
+	// Validate interval; intervals providers do not serve are resampled
+	if !service.IsValidInterval(interval) {
 		h.respondError(c, http.StatusBadRequest, "INVALID_INTERVAL", "invalid interval format")
 		return
 	}
 
-	klines, err := h.marketService.GetKlines(symbol, interval, limit)
+	// timeZone moves day, week and month boundaries off UTC midnight
+	loc, err := candles.LoadLocation(c.Query("timeZone"))
 	if err != nil {
-		log.Error().Err(err).Str("symbol", symbol).Str("interval", interval).Msg("Failed to get klines")
+		h.respondError(c, http.StatusBadRequest, "INVALID_TIMEZONE", "timeZone must be an IANA name or a UTC offset such as +08:00")
+		return
+	}
+
+	// "legacy" keeps the original [openTime, open, high, low, close, volume] rows
+	format := c.DefaultQuery("format", "typed")
+	if format != "typed" && format != "legacy" {
+		h.respondError(c, http.StatusBadRequest, "INVALID_FORMAT", "format must be typed or legacy")
+		return
+	}
+
+	var klines *service.KlineResponse
+	switch {
+	case loc != time.UTC:
+		klines, err = h.marketService.GetResampledKlines(c.Request.Context(), pair, interval, loc, startTime, endTime, limit)
+	case startTime > 0 || endTime > 0:
+		klines, err = h.marketService.GetKlineRange(c.Request.Context(), pair, interval, startTime, endTime, limit)
+	default:
+		klines, err = h.marketService.GetKlines(c.Request.Context(), pair, interval, limit)
+	}
+	if errors.Is(err, service.ErrRangeTooLarge) {
+		h.respondError(c, http.StatusBadRequest, "RANGE_TOO_LARGE", err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Stringer("symbol", pair).Str("interval", interval).Msg("Failed to get klines")
 		h.respondError(c, http.StatusServiceUnavailable, "KLINES_UNAVAILABLE", "unable to fetch klines data")
 		return
 	}
 
+	setAge(c, klines.Freshness)
+	if format == "legacy" {
+		c.JSON(http.StatusOK, klines.Legacy())
+		return
+	}
 	c.JSON(http.StatusOK, klines)
 }
 
 func (h *MarketHandler) GetDepth(c *gin.Context) {
-	symbol := c.Query("symbol")
-	if symbol == "" {
-		h.respondError(c, http.StatusBadRequest, "MISSING_SYMBOL", "symbol parameter is required")
+	pair, ok := h.resolveSymbol(c, c.Query("symbol"))
+	if !ok {
 		return
 	}
 
 	limitStr := c.DefaultQuery("limit", "20")
 	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 || limit > 100 {
-		h.respondError(c, http.StatusBadRequest, "INVALID_LIMIT", "limit must be between 1 and 100")
+	if err != nil || limit <= 0 || limit > 5000 {
+		h.respondError(c, http.StatusBadRequest, "INVALID_LIMIT", "limit must be between 1 and 5000")
+		return
+	}
+
+	consolidated, err := strconv.ParseBool(c.DefaultQuery("consolidated", "false"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "INVALID_CONSOLIDATED", "consolidated must be true or false")
+		return
+	}
+	if consolidated {
+		depth, err := h.marketService.GetConsolidatedDepth(c.Request.Context(), pair, limit)
+		if err != nil {
+			log.Error().Err(err).Stringer("symbol", pair).Msg("Failed to get consolidated depth")
+			h.respondError(c, http.StatusServiceUnavailable, "DEPTH_UNAVAILABLE", "unable to fetch depth data")
+			return
+		}
+		setAge(c, depth.Freshness)
+		c.JSON(http.StatusOK, depth)
 		return
 	}
 
-	depth, err := h.marketService.GetDepth(symbol, limit)
+	depth, err := h.marketService.GetDepth(c.Request.Context(), pair, limit)
 	if err != nil {
-		log.Error().Err(err).Str("symbol", symbol).Msg("Failed to get depth")
+		log.Error().Err(err).Stringer("symbol", pair).Msg("Failed to get depth")
 		h.respondError(c, http.StatusServiceUnavailable, "DEPTH_UNAVAILABLE", "unable to fetch depth data")
 		return
 	}
 
+	setAge(c, depth.Freshness)
 	c.JSON(http.StatusOK, depth)
 }
 
+func (h *MarketHandler) GetSymbols(c *gin.Context) {
+	if !h.symbols.Loaded() {
+		h.respondError(c, http.StatusServiceUnavailable, "SYMBOLS_UNAVAILABLE", "symbol list is not loaded yet")
+		return
+	}
+
+	if symbol := c.Query("symbol"); symbol != "" {
+		pair, ok := h.resolveSymbol(c, symbol)
+		if !ok {
+			return
+		}
+		info, _ := h.symbols.Lookup(pair)
+		info.VenueSymbols = h.marketService.VenueSymbols(pair)
+		c.JSON(http.StatusOK, info)
+		return
+	}
+
+	// Optional filters, e.g. quoteAsset=USDT&status=TRADING
+	quoteAsset, status := c.Query("quoteAsset"), c.Query("status")
+	listing := []symbols.Symbol{}
+	for _, s := range h.symbols.All() {
+		if (quoteAsset == "" || s.QuoteAsset == quoteAsset) && (status == "" || s.Status == status) {
+			s.VenueSymbols = h.marketService.VenueSymbols(s.Pair)
+			listing = append(listing, s)
+		}
+	}
+
+	c.JSON(http.StatusOK, SymbolsResponse{
+		Symbols:   listing,
+		UpdatedAt: h.symbols.UpdatedAt(),
+	})
+}
+
+// resolveSymbol maps any accepted spelling of symbol to its pair, or
+// responds with an error unless the pair is listed.
+func (h *MarketHandler) resolveSymbol(c *gin.Context, symbol string) (symbols.Pair, bool) {
+	if symbol == "" {
+		h.respondError(c, http.StatusBadRequest, "MISSING_SYMBOL", "symbol parameter is required")
+		return symbols.Pair{}, false
+	}
+
+	pair, err := h.symbols.Resolve(symbol)
+	if errors.Is(err, symbols.ErrUnknownSymbol) {
+		h.respondError(c, http.StatusNotFound, "UNKNOWN_SYMBOL", "symbol is not listed")
+		return symbols.Pair{}, false
+	}
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, "INVALID_SYMBOL", "symbol format is invalid")
+		return symbols.Pair{}, false
+	}
+	return pair, true
+}
+
+// setAge reports in the Age header how many seconds ago the response data
+// was fetched upstream.
+func setAge(c *gin.Context, freshness service.Freshness) {
+	if freshness.FetchedAt.IsZero() {
+		return
+	}
+	c.Header("Age", strconv.Itoa(int(freshness.Age().Seconds())))
+}
+
 func (h *MarketHandler) respondError(c *gin.Context, statusCode int, errorCode, message string) {
 	requestID, _ := c.Get("request_id")
 	
@@ -117,6 +321,7 @@ func (h *MarketHandler) respondError(c *gin.Context, statusCode int, errorCode,
 		Error:     message,
 		Code:      errorCode,
 		RequestID: requestID.(string),
+		TraceID:   c.GetString("trace_id"),
 		Timestamp: c.GetInt64("timestamp"),
 	}
 
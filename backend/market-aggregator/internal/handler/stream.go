@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/stream"
+	"github.com/rs/zerolog/log"
+)
+
+type StreamHandler struct {
+	hub      *stream.Hub
+	upgrader websocket.Upgrader
+}
+
+func NewStreamHandler(hub *stream.Hub) *StreamHandler {
+	return &StreamHandler{
+		hub: hub,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Origin policy is enforced by the CORS configuration
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+func (h *StreamHandler) Stream(c *gin.Context) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written an HTTP error response
+		log.Warn().Err(err).Msg("Failed to upgrade stream connection")
+		return
+	}
+
+	h.hub.Serve(conn)
+}
@@ -0,0 +1,119 @@
+package orderbook
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+)
+
+// Book is an in-memory order book for one symbol. It only serves reads
+// once it has been synced with the stream.
+type Book struct {
+	mu           sync.RWMutex
+	symbol       string
+	bids         map[string]provider.Level
+	asks         map[string]provider.Level
+	lastUpdateId int64
+	synced       bool
+	updatedAt    time.Time
+}
+
+func NewBook(symbol string) *Book {
+	return &Book{
+		symbol: symbol,
+		bids:   make(map[string]provider.Level),
+		asks:   make(map[string]provider.Level),
+	}
+}
+
+// reset replaces the book with a snapshot; it stays unsynced until the
+// first stream event has been applied on top of it.
+func (b *Book) reset(lastUpdateId int64, bids, asks []client.BinanceLevel) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bids = make(map[string]provider.Level, len(bids))
+	b.asks = make(map[string]provider.Level, len(asks))
+	applyLevels(b.bids, bids)
+	applyLevels(b.asks, asks)
+	b.lastUpdateId = lastUpdateId
+	b.synced = false
+	b.updatedAt = time.Now()
+}
+
+func (b *Book) apply(finalUpdateId int64, bids, asks []client.BinanceLevel) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	applyLevels(b.bids, bids)
+	applyLevels(b.asks, asks)
+	b.lastUpdateId = finalUpdateId
+	b.synced = true
+	b.updatedAt = time.Now()
+}
+
+func (b *Book) invalidate() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.synced = false
+}
+
+// Synced reports whether the book currently mirrors the venue.
+func (b *Book) Synced() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.synced
+}
+
+// LastUpdateId returns the update ID of the last applied event or snapshot.
+func (b *Book) LastUpdateId() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.lastUpdateId
+}
+
+// Levels returns up to limit levels per side, best first. A limit of zero
+// or less returns the whole book.
+func (b *Book) Levels(limit int) (bids, asks []provider.Level, updatedAt time.Time) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return sortedLevels(b.bids, limit, true), sortedLevels(b.asks, limit, false), b.updatedAt
+}
+
+// applyLevels keys levels by canonical price, so an update quoting "100.10"
+// replaces a level first seen as "100.1".
+func applyLevels(side map[string]provider.Level, updates []client.BinanceLevel) {
+	for _, u := range updates {
+		key := u[0].String()
+		if u[1].IsZero() {
+			delete(side, key)
+			continue
+		}
+		side[key] = provider.Level(u)
+	}
+}
+
+func sortedLevels(side map[string]provider.Level, limit int, descending bool) []provider.Level {
+	levels := make([]provider.Level, 0, len(side))
+	for _, l := range side {
+		levels = append(levels, l)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		if descending {
+			return levels[i].Price().GreaterThan(levels[j].Price())
+		}
+		return levels[i].Price().LessThan(levels[j].Price())
+	})
+
+	if limit > 0 && len(levels) > limit {
+		levels = levels[:limit]
+	}
+	return levels
+}
@@ -0,0 +1,265 @@
+package orderbook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrSequenceGap is returned when a stream event does not continue from the
+// previous one, meaning updates were missed and the book must be resynced.
+var ErrSequenceGap = errors.New("depth stream sequence gap")
+
+var errStopped = errors.New("order book manager stopped")
+
+// SnapshotFetcher loads a REST depth snapshot; *client.BinanceClient implements it.
+type SnapshotFetcher interface {
+	GetDepth(ctx context.Context, symbol string, limit int) (*client.BinanceDepth, error)
+}
+
+type Config struct {
+	// SnapshotLimit is the depth of the REST snapshot a book starts from;
+	// deeper requests are not served from the book
+	SnapshotLimit  int
+	ReconnectDelay time.Duration
+	EventBuffer    int
+	// MaxAge is how long a book's stream may go without an event, ping or
+	// pong before the book stops being served; the stream is then likely
+	// stalled. It must exceed the stream's ping interval, a third of its
+	// read timeout, or quiet books are dropped too
+	MaxAge time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		// Binance's deepest snapshot, so every depth request can be
+		// served from the book
+		SnapshotLimit:  5000,
+		ReconnectDelay: 1 * time.Second,
+		EventBuffer:    1000,
+		MaxAge:         30 * time.Second,
+	}
+}
+
+// Manager keeps one book per tracked symbol in sync with the Binance
+// diff-depth stream, following Binance's documented procedure: buffer stream
+// events, fetch a snapshot, drop events older than the snapshot's
+// lastUpdateId, then require every event to continue from the previous one.
+type Manager struct {
+	snapshots SnapshotFetcher
+	streams   *client.BinanceStreamClient
+	config    Config
+
+	mu    sync.RWMutex
+	books map[string]*Book
+	// The open stream of each book being synced
+	sessions map[string]*client.BinanceDepthStream
+
+	// Cancelled by Close, ending a snapshot fetch in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewManager(snapshots SnapshotFetcher, streams *client.BinanceStreamClient, config Config) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		snapshots: snapshots,
+		streams:   streams,
+		config:    config,
+		books:     make(map[string]*Book),
+		sessions:  make(map[string]*client.BinanceDepthStream),
+		ctx:       ctx,
+		cancel:    cancel,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Track starts maintaining a book for pair. Tracking an already tracked
+// pair is a no-op.
+func (m *Manager) Track(pair symbols.Pair) {
+	// Books are keyed by Binance symbol, the name used on the stream
+	symbol := pair.Compact()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.books[symbol]; exists {
+		return
+	}
+	book := NewBook(symbol)
+	m.books[symbol] = book
+
+	m.wg.Add(1)
+	go m.run(book)
+}
+
+// Book returns the book for pair if it is tracked.
+func (m *Manager) Book(pair symbols.Pair) (*Book, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	book, exists := m.books[pair.Compact()]
+	return book, exists
+}
+
+// Depth serves a snapshot from memory when the pair's book is synced and its
+// stream was recently seen live. A book that has had no events is still
+// current as long as the stream answers pings. Limits deeper than the
+// snapshot the book started from are not served, as the book may not hold
+// that many levels.
+func (m *Manager) Depth(pair symbols.Pair, limit int) (*provider.Depth, bool) {
+	if limit > m.config.SnapshotLimit {
+		return nil, false
+	}
+	book, exists := m.Book(pair)
+	if !exists || !book.Synced() {
+		return nil, false
+	}
+	lastSeen, live := m.lastSeen(book.symbol)
+	if !live || time.Since(lastSeen) > m.config.MaxAge {
+		return nil, false
+	}
+
+	bids, asks, updatedAt := book.Levels(limit)
+	if lastSeen.After(updatedAt) {
+		updatedAt = lastSeen
+	}
+	return &provider.Depth{Symbol: book.symbol, Bids: bids, Asks: asks, UpdatedAt: updatedAt}, true
+}
+
+// lastSeen reports when symbol's stream was last seen live; live is false
+// while it has no stream open.
+func (m *Manager) lastSeen(symbol string) (lastSeen time.Time, live bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stream, ok := m.sessions[symbol]
+	if !ok {
+		return time.Time{}, false
+	}
+	return stream.LastSeen(), true
+}
+
+func (m *Manager) setSession(symbol string, stream *client.BinanceDepthStream) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stream == nil {
+		delete(m.sessions, symbol)
+		return
+	}
+	m.sessions[symbol] = stream
+}
+
+// Close stops all sync loops and waits for them to exit.
+func (m *Manager) Close() {
+	m.cancel()
+	close(m.stop)
+	m.wg.Wait()
+}
+
+func (m *Manager) run(book *Book) {
+	defer m.wg.Done()
+
+	for {
+		err := m.sync(book)
+		book.invalidate()
+		if err == errStopped {
+			return
+		}
+		log.Warn().Err(err).Str("symbol", book.symbol).Msg("Order book out of sync, resyncing")
+
+		select {
+		case <-m.stop:
+			return
+		case <-time.After(m.config.ReconnectDelay):
+		}
+	}
+}
+
+// sync runs one stream session and returns when it can no longer keep the
+// book consistent.
+func (m *Manager) sync(book *Book) error {
+	stream, err := m.streams.DialDepth(m.ctx, book.symbol)
+	if err != nil {
+		if m.ctx.Err() != nil {
+			return errStopped
+		}
+		return err
+	}
+	defer stream.Close()
+	m.setSession(book.symbol, stream)
+	defer m.setSession(book.symbol, nil)
+
+	// Buffer events while the snapshot is being fetched. done ends the
+	// reader when this session does, even with the buffer full
+	events := make(chan *client.BinanceDepthEvent, m.config.EventBuffer)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(events)
+		for {
+			event, err := stream.Read()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	snapshot, err := m.snapshots.GetDepth(m.ctx, book.symbol, m.config.SnapshotLimit)
+	if err != nil {
+		return err
+	}
+	book.reset(snapshot.LastUpdateId, snapshot.Bids, snapshot.Asks)
+
+	lastUpdateId := snapshot.LastUpdateId
+	first := true
+	for {
+		select {
+		case <-m.stop:
+			return errStopped
+		case event, ok := <-events:
+			if !ok {
+				select {
+				case err := <-readErr:
+					return err
+				default:
+					return errStopped
+				}
+			}
+
+			// Already contained in the snapshot
+			if event.FinalUpdateId <= lastUpdateId {
+				continue
+			}
+
+			if first {
+				if event.FirstUpdateId > lastUpdateId+1 {
+					return fmt.Errorf("%w: snapshot %d, first event %d", ErrSequenceGap, lastUpdateId, event.FirstUpdateId)
+				}
+				first = false
+			} else if event.FirstUpdateId != lastUpdateId+1 {
+				return fmt.Errorf("%w: expected %d, got %d", ErrSequenceGap, lastUpdateId+1, event.FirstUpdateId)
+			}
+
+			book.apply(event.FinalUpdateId, event.Bids, event.Asks)
+			lastUpdateId = event.FinalUpdateId
+		}
+	}
+}
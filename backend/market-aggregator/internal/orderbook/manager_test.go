@@ -0,0 +1,339 @@
+package orderbook
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDepthServer is a local stand-in for the Binance stream endpoint. The
+// Nth connection receives the Nth scripted session and is then held open,
+// ignoring pings unless answerPings was called.
+type fakeDepthServer struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	sessions [][]client.BinanceDepthEvent
+	conns    int
+	paths    []string
+	pongs    bool
+}
+
+var btcusdt = symbols.Pair{Base: "BTC", Quote: "USDT"}
+
+func newFakeDepthServer(t *testing.T, sessions ...[]client.BinanceDepthEvent) *fakeDepthServer {
+	f := &fakeDepthServer{sessions: sessions}
+	upgrader := websocket.Upgrader{}
+	done := make(chan struct{})
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		f.mu.Lock()
+		var events []client.BinanceDepthEvent
+		if f.conns < len(f.sessions) {
+			events = f.sessions[f.conns]
+		}
+		f.conns++
+		f.paths = append(f.paths, r.URL.Path)
+		pongs := f.pongs
+		f.mu.Unlock()
+
+		for _, event := range events {
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+		if pongs {
+			// Reading runs the default ping handler, which answers with a pong
+			go func() {
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+		<-done
+	}))
+	t.Cleanup(func() {
+		close(done)
+		f.server.Close()
+	})
+	return f
+}
+
+func (f *fakeDepthServer) answerPings() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pongs = true
+}
+
+func (f *fakeDepthServer) url() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+type fakeSnapshots struct {
+	mu        sync.Mutex
+	snapshots []*client.BinanceDepth
+	calls     int
+}
+
+func (f *fakeSnapshots) GetDepth(ctx context.Context, symbol string, limit int) (*client.BinanceDepth, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	snapshot := f.snapshots[min(f.calls, len(f.snapshots)-1)]
+	f.calls++
+	return snapshot, nil
+}
+
+func (f *fakeSnapshots) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func event(first, final int64, bids, asks [][]string) client.BinanceDepthEvent {
+	return client.BinanceDepthEvent{EventType: "depthUpdate", Symbol: "BTCUSDT", FirstUpdateId: first, FinalUpdateId: final, Bids: levels(bids), Asks: levels(asks)}
+}
+
+func levels(rows [][]string) []client.BinanceLevel {
+	result := make([]client.BinanceLevel, len(rows))
+	for i, row := range rows {
+		result[i] = client.BinanceLevel{decimal.RequireFromString(row[0]), decimal.RequireFromString(row[1])}
+	}
+	return result
+}
+
+// rows renders levels canonically, so "99.50" reads back as "99.5".
+func rows(levels []provider.Level) [][]string {
+	result := make([][]string, len(levels))
+	for i, l := range levels {
+		result[i] = []string{l.Price().String(), l.Quantity().String()}
+	}
+	return result
+}
+
+func testConfig() Config {
+	config := DefaultConfig()
+	config.ReconnectDelay = 10 * time.Millisecond
+	return config
+}
+
+func newTestManager(t *testing.T, snapshots SnapshotFetcher, server *fakeDepthServer) *Manager {
+	return newTestManagerWith(t, snapshots, client.NewBinanceStreamClient(server.url()), testConfig())
+}
+
+func newTestManagerWith(t *testing.T, snapshots SnapshotFetcher, streams *client.BinanceStreamClient, config Config) *Manager {
+	manager := NewManager(snapshots, streams, config)
+	t.Cleanup(manager.Close)
+	return manager
+}
+
+func TestManager_SyncsSnapshotWithStream(t *testing.T) {
+	// Arrange
+	snapshots := &fakeSnapshots{snapshots: []*client.BinanceDepth{{
+		LastUpdateId: 100,
+		Bids:         levels([][]string{{"100.00", "1"}, {"99.00", "2"}}),
+		Asks:         levels([][]string{{"101.00", "1"}}),
+	}}}
+	server := newFakeDepthServer(t, []client.BinanceDepthEvent{
+		event(90, 100, [][]string{{"98.00", "9"}}, nil), // already in snapshot, dropped
+		event(99, 102, [][]string{{"100.00", "0"}, {"99.50", "3"}}, nil),
+		event(103, 104, nil, [][]string{{"101.50", "5"}}),
+	})
+	manager := newTestManager(t, snapshots, server)
+
+	// Act
+	manager.Track(btcusdt)
+
+	// Assert
+	book, ok := manager.Book(btcusdt)
+	require.True(t, ok)
+	require.Eventually(t, func() bool { return book.LastUpdateId() == 104 }, 2*time.Second, 5*time.Millisecond)
+
+	depth, ok := manager.Depth(btcusdt, 10)
+	require.True(t, ok)
+	assert.Equal(t, [][]string{{"99.5", "3"}, {"99", "2"}}, rows(depth.Bids))
+	assert.Equal(t, [][]string{{"101", "1"}, {"101.5", "5"}}, rows(depth.Asks))
+
+	depth, _ = manager.Depth(btcusdt, 1)
+	assert.Len(t, depth.Bids, 1)
+	server.mu.Lock()
+	assert.Equal(t, []string{"/ws/btcusdt@depth@100ms"}, server.paths)
+	server.mu.Unlock()
+}
+
+func TestManager_ResyncsOnSequenceGap(t *testing.T) {
+	// Arrange
+	snapshots := &fakeSnapshots{snapshots: []*client.BinanceDepth{
+		{LastUpdateId: 100, Bids: levels([][]string{{"100.00", "1"}})},
+		{LastUpdateId: 200, Bids: levels([][]string{{"200.00", "1"}})},
+	}}
+	server := newFakeDepthServer(t,
+		[]client.BinanceDepthEvent{
+			event(101, 102, nil, nil),
+			event(105, 106, [][]string{{"100.00", "7"}}, nil), // 103-104 missing
+		},
+		[]client.BinanceDepthEvent{
+			event(201, 201, [][]string{{"199.00", "2"}}, nil),
+		},
+	)
+	manager := newTestManager(t, snapshots, server)
+
+	// Act
+	manager.Track(btcusdt)
+
+	// Assert
+	book, _ := manager.Book(btcusdt)
+	require.Eventually(t, func() bool { return book.LastUpdateId() == 201 }, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, snapshots.callCount())
+
+	depth, ok := manager.Depth(btcusdt, 0)
+	require.True(t, ok)
+	assert.Equal(t, [][]string{{"200", "1"}, {"199", "2"}}, rows(depth.Bids))
+}
+
+func TestManager_FirstEventAfterSnapshotGap(t *testing.T) {
+	// Arrange
+	snapshots := &fakeSnapshots{snapshots: []*client.BinanceDepth{{LastUpdateId: 100}}}
+	server := newFakeDepthServer(t, []client.BinanceDepthEvent{
+		event(150, 151, nil, nil),
+	})
+	manager := newTestManager(t, snapshots, server)
+
+	// Act
+	manager.Track(btcusdt)
+
+	// Assert
+	require.Eventually(t, func() bool { return snapshots.callCount() >= 2 }, 2*time.Second, 5*time.Millisecond)
+	_, ok := manager.Depth(btcusdt, 10)
+	assert.False(t, ok)
+}
+
+func TestManager_ResyncsSilentStream(t *testing.T) {
+	// Arrange: the fake server never answers pings, like a half-open connection
+	snapshots := &fakeSnapshots{snapshots: []*client.BinanceDepth{{LastUpdateId: 100}}}
+	server := newFakeDepthServer(t, []client.BinanceDepthEvent{event(101, 101, nil, nil)})
+	streams := client.NewBinanceStreamClient(server.url())
+	streams.SetReadTimeout(100 * time.Millisecond)
+	manager := newTestManagerWith(t, snapshots, streams, testConfig())
+
+	// Act
+	manager.Track(btcusdt)
+
+	// Assert
+	require.Eventually(t, func() bool { return snapshots.callCount() >= 2 }, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestManager_DoesNotServeStaleBook(t *testing.T) {
+	// Arrange: the fake server sends one event and then neither events nor pongs
+	snapshots := &fakeSnapshots{snapshots: []*client.BinanceDepth{{LastUpdateId: 100, Bids: levels([][]string{{"100.00", "1"}})}}}
+	server := newFakeDepthServer(t, []client.BinanceDepthEvent{event(101, 101, nil, nil)})
+	config := testConfig()
+	config.MaxAge = 100 * time.Millisecond
+	manager := newTestManagerWith(t, snapshots, client.NewBinanceStreamClient(server.url()), config)
+
+	// Act
+	manager.Track(btcusdt)
+
+	// Assert
+	book, _ := manager.Book(btcusdt)
+	require.Eventually(t, func() bool { return book.LastUpdateId() == 101 }, 2*time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, ok := manager.Depth(btcusdt, 10)
+		return !ok
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.True(t, book.Synced())
+}
+
+func TestManager_ServesQuietLiveBook(t *testing.T) {
+	// Arrange: no events after the first, but pings are answered
+	snapshots := &fakeSnapshots{snapshots: []*client.BinanceDepth{{LastUpdateId: 100, Bids: levels([][]string{{"100.00", "1"}})}}}
+	server := newFakeDepthServer(t, []client.BinanceDepthEvent{event(101, 101, nil, nil)})
+	server.answerPings()
+	streams := client.NewBinanceStreamClient(server.url())
+	streams.SetReadTimeout(150 * time.Millisecond)
+	config := testConfig()
+	config.MaxAge = 120 * time.Millisecond
+	manager := newTestManagerWith(t, snapshots, streams, config)
+	manager.Track(btcusdt)
+	book, _ := manager.Book(btcusdt)
+	require.Eventually(t, func() bool { return book.LastUpdateId() == 101 }, 2*time.Second, 5*time.Millisecond)
+
+	// Act
+	time.Sleep(400 * time.Millisecond)
+	depth, ok := manager.Depth(btcusdt, 10)
+
+	// Assert
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now(), depth.UpdatedAt, config.MaxAge)
+	assert.Equal(t, 1, snapshots.callCount())
+}
+
+func TestManager_DoesNotServeDeeperThanSnapshot(t *testing.T) {
+	// Arrange
+	snapshots := &fakeSnapshots{snapshots: []*client.BinanceDepth{{LastUpdateId: 100, Bids: levels([][]string{{"100.00", "1"}})}}}
+	server := newFakeDepthServer(t, []client.BinanceDepthEvent{event(101, 101, nil, nil)})
+	manager := newTestManager(t, snapshots, server)
+	manager.Track(btcusdt)
+	book, _ := manager.Book(btcusdt)
+	require.Eventually(t, book.Synced, 2*time.Second, 5*time.Millisecond)
+
+	// Act
+	_, deep := manager.Depth(btcusdt, DefaultConfig().SnapshotLimit+1)
+	_, shallow := manager.Depth(btcusdt, DefaultConfig().SnapshotLimit)
+
+	// Assert
+	assert.False(t, deep)
+	assert.True(t, shallow)
+}
+
+func TestManager_CloseAbortsDial(t *testing.T) {
+	// Arrange: a listener that accepts connections but never completes the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	manager := NewManager(&fakeSnapshots{}, client.NewBinanceStreamClient("ws://"+listener.Addr().String()), testConfig())
+	manager.Track(btcusdt)
+	conn := <-accepted
+	defer conn.Close()
+
+	// Act
+	closed := make(chan struct{})
+	go func() {
+		manager.Close()
+		close(closed)
+	}()
+
+	// Assert
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close waited for the handshake")
+	}
+}
@@ -0,0 +1,232 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/shopspring/decimal"
+)
+
+const BinanceName = "binance"
+
+// binanceMaxTickerSymbols is the most symbols worth naming in one tickers
+// call; beyond it fetching every ticker costs Binance the same weight.
+const binanceMaxTickerSymbols = 100
+
+// binanceTickerWorkers bounds the per-symbol calls that replace a rejected
+// batch, so they neither burst through the weight budget nor hit the
+// breaker all at once.
+const binanceTickerWorkers = 8
+
+// BinanceAPI is the subset of client.BinanceClient used by the Binance provider.
+type BinanceAPI interface {
+	Get24hrTicker(ctx context.Context, symbol string) (*client.BinanceTicker, error)
+	Get24hrTickers(ctx context.Context, symbols []string) ([]client.BinanceTicker, error)
+	GetKlines(ctx context.Context, symbol, interval string, limit int) ([]client.BinanceKline, error)
+	GetKlinesRange(ctx context.Context, symbol, interval string, startTime, endTime int64, limit int) ([]client.BinanceKline, error)
+	GetDepth(ctx context.Context, symbol string, limit int) (*client.BinanceDepth, error)
+}
+
+// ErrNotTrading is returned for pairs Binance lists but does not trade, or
+// does not list at all, without asking Binance.
+var ErrNotTrading = fmt.Errorf("%w: symbol is not trading on Binance", ErrNotSupported)
+
+// SymbolListing tells which symbols Binance lists; *symbols.Registry
+// implements it.
+type SymbolListing interface {
+	Loaded() bool
+	Lookup(pair symbols.Pair) (symbols.Symbol, bool)
+}
+
+type Binance struct {
+	api     BinanceAPI
+	listing SymbolListing
+}
+
+func NewBinance(api BinanceAPI) *Binance {
+	return &Binance{api: api}
+}
+
+// UseSymbols keeps symbols that are not trading out of batch ticker calls,
+// which Binance would otherwise reject whole.
+func (p *Binance) UseSymbols(listing SymbolListing) {
+	p.listing = listing
+}
+
+func (p *Binance) Name() string {
+	return BinanceName
+}
+
+func (p *Binance) Capabilities() Capability {
+	return CapTicker | CapKlines | CapDepth
+}
+
+// Symbol joins the assets without a separator, e.g. BTCUSDT.
+func (p *Binance) Symbol(pair symbols.Pair) (string, error) {
+	return pair.Compact(), nil
+}
+
+func (p *Binance) GetTicker(ctx context.Context, pair symbols.Pair) (*Ticker, error) {
+	data, err := p.api.Get24hrTicker(ctx, pair.Compact())
+	if err != nil {
+		return nil, binanceError(err)
+	}
+
+	return binanceTicker(data), nil
+}
+
+// GetTickers fetches the tickers of pairs in one call. Binance rejects the
+// whole call over a single symbol it does not list, so pairs known not to
+// trade are left out, and a rejected call is retried one pair at a time.
+func (p *Binance) GetTickers(ctx context.Context, pairs []symbols.Pair) (map[symbols.Pair]TickerResult, error) {
+	result := make(map[symbols.Pair]TickerResult, len(pairs))
+	bySymbol := make(map[string]symbols.Pair, len(pairs))
+	names := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		if _, ok := bySymbol[pair.Compact()]; ok {
+			continue
+		}
+		if !p.trading(pair) {
+			result[pair] = TickerResult{Err: ErrNotTrading}
+			continue
+		}
+		bySymbol[pair.Compact()] = pair
+		names = append(names, pair.Compact())
+	}
+	if len(names) == 0 {
+		return result, nil
+	}
+	if len(names) > binanceMaxTickerSymbols {
+		names = nil
+	}
+
+	data, err := p.api.Get24hrTickers(ctx, names)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == client.BinanceInvalidSymbol {
+		p.getTickersOneByOne(ctx, bySymbol, result)
+		return result, nil
+	}
+	if err != nil {
+		return nil, binanceError(err)
+	}
+
+	for i := range data {
+		if pair, ok := bySymbol[data[i].Symbol]; ok {
+			result[pair] = TickerResult{Ticker: binanceTicker(&data[i])}
+		}
+	}
+	return result, nil
+}
+
+// trading reports whether pair may be asked for. Until the listing loads
+// every pair may.
+func (p *Binance) trading(pair symbols.Pair) bool {
+	if p.listing == nil || !p.listing.Loaded() {
+		return true
+	}
+	s, ok := p.listing.Lookup(pair)
+	return ok && s.Status == symbols.StatusTrading
+}
+
+// getTickersOneByOne asks for each pair separately, binanceTickerWorkers at a
+// time.
+func (p *Binance) getTickersOneByOne(ctx context.Context, bySymbol map[string]symbols.Pair, result map[symbols.Pair]TickerResult) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, binanceTickerWorkers)
+	for _, pair := range bySymbol {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(pair symbols.Pair) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			ticker, err := p.GetTicker(ctx, pair)
+			mu.Lock()
+			result[pair] = TickerResult{Ticker: ticker, Err: err}
+			mu.Unlock()
+		}(pair)
+	}
+	wg.Wait()
+}
+
+// binanceError marks requests Binance refused as invalid with ErrRejected,
+// keeping the client error in the chain.
+func binanceError(err error) error {
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.ClientError() {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	return err
+}
+
+func binanceTicker(data *client.BinanceTicker) *Ticker {
+	return &Ticker{
+		Symbol:     data.Symbol,
+		Price:      data.LastPrice,
+		Change24h:  decimal.NewNullDecimal(data.PriceChangePercent),
+		Volume24h:  decimal.NewNullDecimal(data.Volume),
+		High24h:    decimal.NewNullDecimal(data.HighPrice),
+		Low24h:     decimal.NewNullDecimal(data.LowPrice),
+		LastUpdate: time.Unix(data.CloseTime/1000, 0),
+	}
+}
+
+func (p *Binance) GetKlines(ctx context.Context, query KlineQuery) ([]Kline, error) {
+	var binanceKlines []client.BinanceKline
+	var err error
+	if query.StartTime > 0 || query.EndTime > 0 {
+		binanceKlines, err = p.api.GetKlinesRange(ctx, query.Pair.Compact(), query.Interval, query.StartTime, query.EndTime, query.Limit)
+	} else {
+		binanceKlines, err = p.api.GetKlines(ctx, query.Pair.Compact(), query.Interval, query.Limit)
+	}
+	if err != nil {
+		return nil, binanceError(err)
+	}
+
+	klines := make([]Kline, len(binanceKlines))
+	for i, k := range binanceKlines {
+		klines[i] = Kline{
+			OpenTime:            k.OpenTime,
+			Open:                k.Open,
+			High:                k.High,
+			Low:                 k.Low,
+			Close:               k.Close,
+			Volume:              k.Volume,
+			CloseTime:           k.CloseTime,
+			QuoteVolume:         k.QuoteAssetVolume,
+			Trades:              k.NumberOfTrades,
+			TakerBuyBaseVolume:  k.TakerBuyBaseAssetVolume,
+			TakerBuyQuoteVolume: k.TakerBuyQuoteAssetVolume,
+		}
+	}
+
+	return klines, nil
+}
+
+func (p *Binance) GetDepth(ctx context.Context, pair symbols.Pair, limit int) (*Depth, error) {
+	data, err := p.api.GetDepth(ctx, pair.Compact(), limit)
+	if err != nil {
+		return nil, binanceError(err)
+	}
+
+	return &Depth{
+		Symbol: pair.Compact(),
+		Bids:   binanceLevels(data.Bids),
+		Asks:   binanceLevels(data.Asks),
+	}, nil
+}
+
+func binanceLevels(levels []client.BinanceLevel) []Level {
+	result := make([]Level, len(levels))
+	for i, l := range levels {
+		result[i] = Level(l)
+	}
+	return result
+}
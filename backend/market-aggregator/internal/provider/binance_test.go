@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	btcusdt = symbols.Pair{Base: "BTC", Quote: "USDT"}
+	ethusdt = symbols.Pair{Base: "ETH", Quote: "USDT"}
+	foousdt = symbols.Pair{Base: "FOO", Quote: "USDT"}
+)
+
+// fakeBinanceTickers answers ticker calls like Binance: a batch naming an
+// unlisted symbol is rejected whole.
+func fakeBinanceTickers(t *testing.T, listed ...string) (*Binance, *int32) {
+	t.Helper()
+	var batches int32
+	invalid := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+	}
+	ticker := func(symbol string) string {
+		return fmt.Sprintf(`{"symbol":%q,"lastPrice":"100","closeTime":1700000000000}`, symbol)
+	}
+	isListed := func(symbol string) bool {
+		for _, l := range listed {
+			if l == symbol {
+				return true
+			}
+		}
+		return false
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if symbol := r.URL.Query().Get("symbol"); symbol != "" {
+			if !isListed(symbol) {
+				invalid(w)
+				return
+			}
+			w.Write([]byte(ticker(symbol)))
+			return
+		}
+
+		atomic.AddInt32(&batches, 1)
+		var tickers []string
+		for _, symbol := range strings.Split(strings.Trim(r.URL.Query().Get("symbols"), `[]`), ",") {
+			symbol = strings.Trim(symbol, `"`)
+			if !isListed(symbol) {
+				invalid(w)
+				return
+			}
+			tickers = append(tickers, ticker(symbol))
+		}
+		w.Write([]byte("[" + strings.Join(tickers, ",") + "]"))
+	}))
+	t.Cleanup(server.Close)
+
+	config := client.DefaultBinanceConfig()
+	config.BaseURL = server.URL
+	return NewBinance(client.NewBinanceClient(config)), &batches
+}
+
+type fakeListing map[symbols.Pair]string
+
+func (l fakeListing) Loaded() bool { return true }
+func (l fakeListing) Lookup(pair symbols.Pair) (symbols.Symbol, bool) {
+	status, ok := l[pair]
+	return symbols.Symbol{Pair: pair, Status: status}, ok
+}
+
+func TestBinance_GetTickers_RetriesRejectedBatchPerSymbol(t *testing.T) {
+	// Arrange
+	binance, batches := fakeBinanceTickers(t, "BTCUSDT", "ETHUSDT")
+
+	// Act
+	result, err := binance.GetTickers(context.Background(), []symbols.Pair{btcusdt, foousdt, ethusdt})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(batches))
+	require.NotNil(t, result[btcusdt].Ticker)
+	require.NotNil(t, result[ethusdt].Ticker)
+	assert.Equal(t, "100", result[ethusdt].Ticker.Price.String())
+	assert.ErrorIs(t, result[foousdt].Err, ErrRejected)
+}
+
+func TestBinance_GetTickers_LeavesOutPairsNotTrading(t *testing.T) {
+	// Arrange
+	binance, batches := fakeBinanceTickers(t, "BTCUSDT")
+	binance.UseSymbols(fakeListing{btcusdt: symbols.StatusTrading, ethusdt: "BREAK"})
+
+	// Act
+	result, err := binance.GetTickers(context.Background(), []symbols.Pair{btcusdt, ethusdt, foousdt})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(batches))
+	assert.NotNil(t, result[btcusdt].Ticker)
+	assert.ErrorIs(t, result[ethusdt].Err, ErrNotTrading)
+	assert.ErrorIs(t, result[foousdt].Err, ErrNotSupported)
+}
+
+func TestBinance_GetTickers_BoundsPerSymbolRetries(t *testing.T) {
+	// Arrange: every batch is rejected, and single calls take a while
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		symbol := r.URL.Query().Get("symbol")
+		if symbol == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+			return
+		}
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(w, `{"symbol":%q,"lastPrice":"100","closeTime":1700000000000}`, symbol)
+	}))
+	t.Cleanup(server.Close)
+	config := client.DefaultBinanceConfig()
+	config.BaseURL = server.URL
+	binance := NewBinance(client.NewBinanceClient(config))
+
+	pairs := make([]symbols.Pair, 30)
+	for i := range pairs {
+		pairs[i] = symbols.Pair{Base: fmt.Sprintf("C%d", i), Quote: "USDT"}
+	}
+
+	// Act
+	result, err := binance.GetTickers(context.Background(), pairs)
+
+	// Assert
+	require.NoError(t, err)
+	for _, pair := range pairs {
+		assert.NotNil(t, result[pair].Ticker, pair.String())
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(binanceTickerWorkers))
+}
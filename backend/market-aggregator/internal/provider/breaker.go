@@ -0,0 +1,243 @@
+package provider
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the provider while its circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("provider circuit breaker is open")
+
+// degradedScore is the health score below which a provider is tried after
+// healthier ones regardless of priority.
+const degradedScore = 0.5
+
+type BreakerState string
+
+const (
+	StateClosed   BreakerState = "closed"
+	StateOpen     BreakerState = "open"
+	StateHalfOpen BreakerState = "half_open"
+)
+
+type BreakerConfig struct {
+	// Window is the number of recent calls the rates are computed over
+	Window int
+	// MinCalls is the fewest calls in the window before the breaker can open
+	MinCalls int
+	// ErrorRate opens the breaker when this share of calls failed
+	ErrorRate float64
+	// SlowCall is the latency above which a call counts as slow
+	SlowCall time.Duration
+	// SlowRate opens the breaker when this share of calls was slow
+	SlowRate float64
+	// OpenTimeout is how long the breaker stays open before probing
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of successful trial calls that close it
+	HalfOpenProbes int
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Window:         20,
+		MinCalls:       5,
+		ErrorRate:      0.5,
+		SlowCall:       2 * time.Second,
+		SlowRate:       0.8,
+		OpenTimeout:    30 * time.Second,
+		HalfOpenProbes: 2,
+	}
+}
+
+// Health is a snapshot of a provider's breaker. Score is the share of recent
+// calls that succeeded without being slow, and zero while the breaker is open.
+type Health struct {
+	Name      string       `json:"name"`
+	State     BreakerState `json:"state"`
+	Score     float64      `json:"score"`
+	Calls     int          `json:"calls"`
+	ErrorRate float64      `json:"errorRate"`
+	SlowRate  float64      `json:"slowRate"`
+	OpenedAt  *time.Time   `json:"openedAt,omitempty"`
+}
+
+type outcome struct {
+	failed bool
+	slow   bool
+}
+
+// Breaker is a closed/open/half-open circuit breaker over a sliding window
+// of call outcomes. While open, calls are refused until OpenTimeout passes;
+// then up to HalfOpenProbes trial calls decide whether it closes again.
+type Breaker struct {
+	config BreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	outcomes []outcome
+	next     int
+	openedAt time.Time
+	// Trial calls in flight and succeeded while half-open
+	probing   int
+	succeeded int
+}
+
+func NewBreaker(config BreakerConfig) *Breaker {
+	return &Breaker{
+		config:   config,
+		now:      time.Now,
+		state:    StateClosed,
+		outcomes: make([]outcome, 0, config.Window),
+	}
+}
+
+// Allow reports whether a call may go ahead. Every allowed call must be
+// followed by Record or Release.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.config.OpenTimeout {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probing, b.succeeded = 0, 0
+		fallthrough
+	case StateHalfOpen:
+		if b.probing+b.succeeded >= b.config.HalfOpenProbes {
+			return false
+		}
+		b.probing++
+	}
+	return true
+}
+
+// Record reports the outcome of an allowed call.
+func (b *Breaker) Record(err error, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	o := outcome{failed: err != nil, slow: latency > b.config.SlowCall}
+
+	if b.state == StateHalfOpen {
+		b.probing--
+		if o.failed || o.slow {
+			b.trip()
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.config.HalfOpenProbes {
+			b.state = StateClosed
+			b.outcomes, b.next = b.outcomes[:0], 0
+		}
+		return
+	}
+	if b.state == StateOpen {
+		// A call allowed before the breaker opened
+		return
+	}
+
+	if len(b.outcomes) < b.config.Window {
+		b.outcomes = append(b.outcomes, o)
+	} else {
+		b.outcomes[b.next] = o
+		b.next = (b.next + 1) % b.config.Window
+	}
+
+	if len(b.outcomes) < b.config.MinCalls {
+		return
+	}
+	errorRate, slowRate := b.rates()
+	if errorRate >= b.config.ErrorRate || slowRate >= b.config.SlowRate {
+		b.trip()
+	}
+}
+
+// Release ends an allowed call without an outcome, for calls whose caller
+// gave up before the venue answered. A half-open probe slot is freed for the
+// next call.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// A probe slot taken before the breaker last reopened is already free
+	if b.state == StateHalfOpen && b.probing > 0 {
+		b.probing--
+	}
+}
+
+func (b *Breaker) trip() {
+	b.state = StateOpen
+	b.openedAt = b.now()
+	b.probing, b.succeeded = 0, 0
+}
+
+func (b *Breaker) rates() (errorRate, slowRate float64) {
+	if len(b.outcomes) == 0 {
+		return 0, 0
+	}
+	var failed, slow int
+	for _, o := range b.outcomes {
+		if o.failed {
+			failed++
+		}
+		if o.slow {
+			slow++
+		}
+	}
+	return float64(failed) / float64(len(b.outcomes)), float64(slow) / float64(len(b.outcomes))
+}
+
+// Health reports the breaker state and the score the registry orders by.
+func (b *Breaker) Health() Health {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	if state == StateOpen && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		// Due for a probe on the next call
+		state = StateHalfOpen
+	}
+
+	health := Health{State: state, Calls: len(b.outcomes), Score: 1}
+	health.ErrorRate, health.SlowRate = b.rates()
+
+	good := 0
+	for _, o := range b.outcomes {
+		if !o.failed && !o.slow {
+			good++
+		}
+	}
+	if len(b.outcomes) > 0 {
+		health.Score = float64(good) / float64(len(b.outcomes))
+	}
+
+	if b.state == StateOpen {
+		openedAt := b.openedAt
+		health.OpenedAt = &openedAt
+		if state == StateOpen {
+			health.Score = 0
+		}
+	}
+	return health
+}
+
+// rank orders providers by health: 0 healthy, 1 degraded or probing, 2 open.
+// Scores only count once the window holds MinCalls calls.
+func (b *Breaker) rank() int {
+	health := b.Health()
+	switch {
+	case health.State == StateOpen:
+		return 2
+	case health.State == StateHalfOpen:
+		return 1
+	case health.Calls >= b.config.MinCalls && health.Score < degradedScore:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock lets tests move a breaker through its open timeout.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func testBreaker() (*Breaker, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	breaker := NewBreaker(BreakerConfig{
+		Window:         4,
+		MinCalls:       4,
+		ErrorRate:      0.5,
+		SlowCall:       time.Second,
+		SlowRate:       0.75,
+		OpenTimeout:    30 * time.Second,
+		HalfOpenProbes: 1,
+	})
+	breaker.now = clock.Now
+	return breaker, clock
+}
+
+func TestBreaker_OpensOnErrorRate(t *testing.T) {
+	breaker, _ := testBreaker()
+	failure := errors.New("timeout")
+
+	for _, err := range []error{nil, failure, nil} {
+		require.True(t, breaker.Allow())
+		breaker.Record(err, 10*time.Millisecond)
+	}
+	assert.Equal(t, StateClosed, breaker.Health().State)
+
+	require.True(t, breaker.Allow())
+	breaker.Record(failure, 10*time.Millisecond)
+
+	assert.Equal(t, StateOpen, breaker.Health().State)
+	assert.Zero(t, breaker.Health().Score)
+	assert.False(t, breaker.Allow())
+}
+
+func TestBreaker_OpensOnSlowCalls(t *testing.T) {
+	breaker, _ := testBreaker()
+
+	for _, latency := range []time.Duration{3 * time.Second, 3 * time.Second, 10 * time.Millisecond, 3 * time.Second} {
+		require.True(t, breaker.Allow())
+		breaker.Record(nil, latency)
+	}
+
+	assert.Equal(t, StateOpen, breaker.Health().State)
+}
+
+func TestBreaker_HalfOpenProbe(t *testing.T) {
+	breaker, clock := testBreaker()
+	for i := 0; i < 4; i++ {
+		breaker.Allow()
+		breaker.Record(errors.New("down"), 0)
+	}
+	require.Equal(t, StateOpen, breaker.Health().State)
+
+	// A failed probe reopens it for another timeout
+	clock.now = clock.now.Add(31 * time.Second)
+	require.True(t, breaker.Allow())
+	assert.False(t, breaker.Allow(), "only one probe at a time")
+	breaker.Record(errors.New("still down"), 0)
+	assert.False(t, breaker.Allow())
+
+	// A successful probe closes it
+	clock.now = clock.now.Add(31 * time.Second)
+	assert.Equal(t, StateHalfOpen, breaker.Health().State)
+	require.True(t, breaker.Allow())
+	breaker.Record(nil, 10*time.Millisecond)
+
+	health := breaker.Health()
+	assert.Equal(t, StateClosed, health.State)
+	assert.Equal(t, 0, health.Calls)
+	assert.True(t, breaker.Allow())
+}
+
+// cancellingProvider cancels its caller's context mid-call, like a client
+// hanging up while the venue has yet to answer.
+type cancellingProvider struct {
+	stubProvider
+	cancel context.CancelFunc
+}
+
+func (p *cancellingProvider) GetTicker(ctx context.Context, pair symbols.Pair) (*Ticker, error) {
+	p.cancel()
+	return nil, ctx.Err()
+}
+
+func TestGuard_CancelledProbeLeavesBreakerHalfOpen(t *testing.T) {
+	breaker, clock := testBreaker()
+	for i := 0; i < 4; i++ {
+		breaker.Allow()
+		breaker.Record(errors.New("down"), 0)
+	}
+	clock.now = clock.now.Add(31 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := guard(&cancellingProvider{stubProvider: stubProvider{name: "venue", capabilities: CapTicker}, cancel: cancel}, breaker)
+	_, err := p.GetTicker(ctx, symbols.Pair{Base: "BTC", Quote: "USDT"})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, StateHalfOpen, breaker.Health().State)
+	assert.True(t, breaker.Allow(), "the probe slot is free for the next call")
+}
+
+// flakyProvider fails every ticker call until healed.
+type flakyProvider struct {
+	stubProvider
+	calls  int
+	failed bool
+}
+
+func (p *flakyProvider) GetTicker(ctx context.Context, pair symbols.Pair) (*Ticker, error) {
+	p.calls++
+	if p.failed {
+		return nil, errors.New("API error")
+	}
+	return &Ticker{Symbol: pair.Compact()}, nil
+}
+
+func TestRegistry_OpenBreakerFailsFastAndReorders(t *testing.T) {
+	primary := &flakyProvider{stubProvider: stubProvider{name: "primary", capabilities: CapTicker}, failed: true}
+	backup := &flakyProvider{stubProvider: stubProvider{name: "backup", capabilities: CapTicker}}
+	registry := NewRegistry(primary, backup)
+	btcusdt := symbols.Pair{Base: "BTC", Quote: "USDT"}
+
+	for i := 0; i < DefaultBreakerConfig().MinCalls; i++ {
+		_, err := registry.Providers(CapTicker)[0].GetTicker(context.Background(), btcusdt)
+		assert.Error(t, err)
+	}
+
+	// The open breaker moves the primary behind the backup and refuses calls
+	providers := registry.Providers(CapTicker)
+	assert.Equal(t, []string{"backup", "primary"}, names(providers))
+	_, err := providers[1].GetTicker(context.Background(), btcusdt)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, DefaultBreakerConfig().MinCalls, primary.calls)
+
+	assert.Equal(t, "primary", registry.Primary(CapTicker))
+	health := registry.Health()
+	assert.Equal(t, "primary", health[0].Name)
+	assert.Equal(t, StateOpen, health[0].State)
+	assert.Equal(t, StateClosed, health[1].State)
+}
+
+func TestRegistry_UnsupportedPairsDoNotTrip(t *testing.T) {
+	registry := NewRegistry(NewCoinGecko(nil))
+	p := registry.Providers(CapTicker)[0]
+
+	for i := 0; i < 10; i++ {
+		_, err := p.GetTicker(context.Background(), symbols.Pair{Base: "NOPE", Quote: "USDT"})
+		assert.ErrorIs(t, err, ErrUnknownCoin)
+	}
+
+	assert.Equal(t, StateClosed, registry.Health()[0].State)
+}
+
+func TestRegistry_RejectedRequestsDoNotTrip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+	}))
+	defer server.Close()
+	config := client.DefaultBinanceConfig()
+	config.BaseURL = server.URL
+	registry := NewRegistry(NewBinance(client.NewBinanceClient(config)))
+	p := registry.Providers(CapTicker)[0]
+
+	for i := 0; i < 10; i++ {
+		_, err := p.GetTicker(context.Background(), symbols.Pair{Base: "FOO", Quote: "USDT"})
+		assert.ErrorIs(t, err, ErrRejected)
+		var apiErr *client.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, client.BinanceInvalidSymbol, apiErr.Code)
+	}
+
+	assert.Equal(t, StateClosed, registry.Health()[0].State)
+}
@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/shopspring/decimal"
+)
+
+const CoinGeckoName = "coingecko"
+
+// CoinGeckoAPI is the subset of client.CoinGeckoClient used by the CoinGecko provider.
+type CoinGeckoAPI interface {
+	GetMarket(ctx context.Context, coinID, vsCurrency string) (*client.CoinGeckoMarket, error)
+	GetMarkets(ctx context.Context, coinIDs []string, vsCurrency string) ([]client.CoinGeckoMarket, error)
+}
+
+// coinGeckoCurrencies maps quote assets to vs_currencies. CoinGecko has no
+// stablecoin currencies, so those are quoted in the currency they track.
+var coinGeckoCurrencies = map[string]string{
+	"USDT":  "usd",
+	"USDC":  "usd",
+	"BUSD":  "usd",
+	"FDUSD": "usd",
+	"TUSD":  "usd",
+	"DAI":   "usd",
+	"USD":   "usd",
+	"EUR":   "eur",
+	"GBP":   "gbp",
+	"JPY":   "jpy",
+	"TRY":   "try",
+	"BRL":   "brl",
+	"BTC":   "btc",
+	"ETH":   "eth",
+	"BNB":   "bnb",
+}
+
+// CoinGecko only serves spot prices; it has no klines or order book.
+type CoinGecko struct {
+	api   CoinGeckoAPI
+	coins *CoinList
+}
+
+func NewCoinGecko(api CoinGeckoAPI) *CoinGecko {
+	return &CoinGecko{api: api}
+}
+
+// UseCoinList resolves base assets through CoinGecko's coin list. Without it
+// only the pinned coin IDs resolve.
+func (p *CoinGecko) UseCoinList(coins *CoinList) {
+	p.coins = coins
+}
+
+func (p *CoinGecko) Name() string {
+	return CoinGeckoName
+}
+
+func (p *CoinGecko) Capabilities() Capability {
+	return CapTicker
+}
+
+// Symbol is the coin ID and currency, e.g. bitcoin/usd.
+func (p *CoinGecko) Symbol(pair symbols.Pair) (string, error) {
+	coinID, currency, err := p.resolve(pair)
+	if err != nil {
+		return "", err
+	}
+	return coinID + "/" + currency, nil
+}
+
+func (p *CoinGecko) resolve(pair symbols.Pair) (coinID, currency string, err error) {
+	currency, ok := coinGeckoCurrencies[pair.Quote]
+	if !ok {
+		return "", "", fmt.Errorf("%w: quote asset %s", ErrNotSupported, pair.Quote)
+	}
+	if p.coins != nil {
+		coinID, err = p.coins.CoinID(pair.Base)
+	} else if coinID, ok = pinnedCoinIDs[pair.Base]; !ok {
+		err = fmt.Errorf("%w: %s", ErrUnknownCoin, pair.Base)
+	}
+	return coinID, currency, err
+}
+
+func (p *CoinGecko) GetTicker(ctx context.Context, pair symbols.Pair) (*Ticker, error) {
+	coinID, currency, err := p.resolve(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := p.api.GetMarket(ctx, coinID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return coinGeckoTicker(data, currency), nil
+}
+
+// GetTickers fetches the markets of pairs with one call per quote currency.
+func (p *CoinGecko) GetTickers(ctx context.Context, pairs []symbols.Pair) (map[symbols.Pair]TickerResult, error) {
+	result := make(map[symbols.Pair]TickerResult, len(pairs))
+
+	type request struct {
+		coinIDs []string
+		pairs   map[string][]symbols.Pair
+	}
+	byCurrency := make(map[string]*request)
+	for _, pair := range pairs {
+		coinID, currency, err := p.resolve(pair)
+		if err != nil {
+			result[pair] = TickerResult{Err: err}
+			continue
+		}
+		req, ok := byCurrency[currency]
+		if !ok {
+			req = &request{pairs: make(map[string][]symbols.Pair)}
+			byCurrency[currency] = req
+		}
+		if _, ok := req.pairs[coinID]; !ok {
+			req.coinIDs = append(req.coinIDs, coinID)
+		}
+		req.pairs[coinID] = append(req.pairs[coinID], pair)
+	}
+
+	for currency, req := range byCurrency {
+		markets, err := p.api.GetMarkets(ctx, req.coinIDs, currency)
+		if err != nil {
+			for _, coinPairs := range req.pairs {
+				for _, pair := range coinPairs {
+					result[pair] = TickerResult{Err: err}
+				}
+			}
+			continue
+		}
+		for i := range markets {
+			for _, pair := range req.pairs[markets[i].ID] {
+				result[pair] = TickerResult{Ticker: coinGeckoTicker(&markets[i], currency)}
+			}
+		}
+	}
+	return result, nil
+}
+
+func coinGeckoTicker(data *client.CoinGeckoMarket, currency string) *Ticker {
+	// CoinGecko reports volume in the quote currency, summed across the
+	// venues it tracks; the base volume is derived at the current price
+	volume := decimal.NullDecimal{}
+	if data.TotalVolume.Valid && data.CurrentPrice.IsPositive() {
+		volume = decimal.NewNullDecimal(data.TotalVolume.Decimal.DivRound(data.CurrentPrice, 8))
+	}
+
+	lastUpdate := data.LastUpdated
+	if lastUpdate.IsZero() {
+		lastUpdate = time.Now()
+	}
+
+	return &Ticker{
+		Symbol:     data.ID + "/" + currency,
+		Price:      data.CurrentPrice,
+		Change24h:  data.PriceChangePercentage24h,
+		Volume24h:  volume,
+		High24h:    data.High24h,
+		Low24h:     data.Low24h,
+		MarketCap:  data.MarketCap,
+		LastUpdate: lastUpdate,
+
+		AggregatedVolume: true,
+	}
+}
+
+func (p *CoinGecko) GetKlines(ctx context.Context, query KlineQuery) ([]Kline, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *CoinGecko) GetDepth(ctx context.Context, pair symbols.Pair, limit int) (*Depth, error) {
+	return nil, ErrNotSupported
+}
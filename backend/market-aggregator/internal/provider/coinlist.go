@@ -0,0 +1,234 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/rs/zerolog/log"
+)
+
+// Both wrap ErrNotSupported: CoinGecko cannot serve the pair, but the venue
+// itself is not failing.
+var (
+	ErrUnknownCoin   = fmt.Errorf("%w: no CoinGecko coin for asset", ErrNotSupported)
+	ErrAmbiguousCoin = fmt.Errorf("%w: several CoinGecko coins share the asset's ticker", ErrNotSupported)
+)
+
+// pinnedCoinIDs resolves tickers that many coins share to the coin markets
+// mean by them. Overrides take precedence.
+var pinnedCoinIDs = map[string]string{
+	"BTC":   "bitcoin",
+	"ETH":   "ethereum",
+	"BNB":   "binancecoin",
+	"ADA":   "cardano",
+	"DOT":   "polkadot",
+	"LINK":  "chainlink",
+	"LTC":   "litecoin",
+	"XRP":   "ripple",
+	"SOL":   "solana",
+	"MATIC": "matic-network",
+	"AVAX":  "avalanche-2",
+	"ATOM":  "cosmos",
+	"NEAR":  "near",
+	"FTM":   "fantom",
+	"ALGO":  "algorand",
+	"VET":   "vechain",
+	"ICP":   "internet-computer",
+	"FIL":   "filecoin",
+	"TRX":   "tron",
+	"XLM":   "stellar",
+	"AAVE":  "aave",
+	"UNI":   "uniswap",
+	"DOGE":  "dogecoin",
+	"SHIB":  "shiba-inu",
+	"USDT":  "tether",
+	"USDC":  "usd-coin",
+}
+
+// CoinListAPI loads CoinGecko's coin list; *client.CoinGeckoClient implements it.
+type CoinListAPI interface {
+	GetCoinsList(ctx context.Context) ([]client.CoinGeckoCoin, error)
+}
+
+type CoinListConfig struct {
+	RefreshInterval time.Duration
+	// RetryInterval replaces RefreshInterval after a failed refresh
+	RetryInterval time.Duration
+	// OverridesFile is an optional JSON object mapping assets to coin IDs,
+	// e.g. {"TON": "the-open-network"}. It is re-read on every refresh.
+	OverridesFile string
+}
+
+func DefaultCoinListConfig() CoinListConfig {
+	return CoinListConfig{
+		RefreshInterval: 24 * time.Hour,
+		RetryInterval:   10 * time.Minute,
+	}
+}
+
+// CoinList resolves assets to CoinGecko coin IDs from the /coins/list
+// mapping, refreshed periodically. A ticker shared by several coins resolves
+// through an override, a pinned ID, or the coin whose ID is the ticker
+// itself; otherwise it is ambiguous. A failed refresh keeps the previous list.
+type CoinList struct {
+	api    CoinListAPI
+	config CoinListConfig
+
+	mu        sync.RWMutex
+	byTicker  map[string][]string
+	overrides map[string]string
+	updatedAt time.Time
+
+	// Cancelled by Close, ending a refresh in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewCoinList(api CoinListAPI, config CoinListConfig) *CoinList {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CoinList{
+		api:    api,
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start refreshes the list until Close is called. The first refresh happens
+// one interval in; call Refresh beforehand to load it immediately.
+func (l *CoinList) Start() {
+	go func() {
+		defer close(l.done)
+
+		wait := l.config.RefreshInterval
+		if !l.Loaded() {
+			wait = l.config.RetryInterval
+		}
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-time.After(wait):
+			}
+
+			wait = l.config.RefreshInterval
+			if err := l.Refresh(); err != nil {
+				log.Warn().Err(err).Msg("CoinGecko coin list refresh failed")
+				wait = l.config.RetryInterval
+			}
+		}
+	}()
+}
+
+func (l *CoinList) Close() {
+	l.cancel()
+	close(l.stop)
+	<-l.done
+}
+
+// Refresh reloads the overrides file and the coin list. The overrides are
+// applied even when the coin list cannot be fetched, and an unreadable
+// overrides file keeps the previous overrides without holding up the list.
+func (l *CoinList) Refresh() error {
+	if l.config.OverridesFile != "" {
+		overrides, err := loadCoinOverrides(l.config.OverridesFile)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load CoinGecko coin overrides, keeping the previous ones")
+		} else {
+			l.mu.Lock()
+			l.overrides = overrides
+			l.mu.Unlock()
+		}
+	}
+
+	coins, err := l.api.GetCoinsList(l.ctx)
+	if err != nil {
+		return err
+	}
+	if len(coins) == 0 {
+		return fmt.Errorf("coins list is empty")
+	}
+
+	byTicker := make(map[string][]string)
+	for _, coin := range coins {
+		ticker := strings.ToUpper(coin.Symbol)
+		byTicker[ticker] = append(byTicker[ticker], coin.ID)
+	}
+
+	l.mu.Lock()
+	l.byTicker = byTicker
+	l.updatedAt = time.Now()
+	l.mu.Unlock()
+
+	log.Info().Int("coins", len(coins)).Int("tickers", len(byTicker)).Msg("CoinGecko coin list refreshed")
+	return nil
+}
+
+func loadCoinOverrides(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coin overrides: %v", err)
+	}
+
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse coin overrides %s: %v", path, err)
+	}
+
+	overrides := make(map[string]string, len(raw))
+	for asset, coinID := range raw {
+		overrides[strings.ToUpper(strings.TrimSpace(asset))] = strings.TrimSpace(coinID)
+	}
+	return overrides, nil
+}
+
+// Loaded reports whether a coin list has been loaded.
+func (l *CoinList) Loaded() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.byTicker != nil
+}
+
+// CoinID resolves asset, e.g. "BTC", to its CoinGecko coin ID. Before the
+// list loads only overrides and pinned IDs resolve.
+func (l *CoinList) CoinID(asset string) (string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if coinID, ok := l.overrides[asset]; ok {
+		return coinID, nil
+	}
+	if coinID, ok := pinnedCoinIDs[asset]; ok {
+		return coinID, nil
+	}
+
+	candidates := l.byTicker[asset]
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrUnknownCoin, asset)
+	case 1:
+		return candidates[0], nil
+	}
+
+	ticker := strings.ToLower(asset)
+	for _, coinID := range candidates {
+		if coinID == ticker {
+			return coinID, nil
+		}
+	}
+
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+	return "", fmt.Errorf("%w: %s is one of %s; add an override", ErrAmbiguousCoin, asset, strings.Join(sorted, ", "))
+}
@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixtureCoins serves testdata/coins_list.json, a trimmed /coins/list.
+type fixtureCoins struct {
+	coins []client.CoinGeckoCoin
+	err   error
+}
+
+func (f *fixtureCoins) GetCoinsList(ctx context.Context) ([]client.CoinGeckoCoin, error) {
+	return f.coins, f.err
+}
+
+func loadFixtureCoins(t *testing.T) *fixtureCoins {
+	data, err := os.ReadFile("testdata/coins_list.json")
+	require.NoError(t, err)
+	var coins []client.CoinGeckoCoin
+	require.NoError(t, json.Unmarshal(data, &coins))
+	return &fixtureCoins{coins: coins}
+}
+
+func TestCoinList_CoinID(t *testing.T) {
+	// Arrange
+	coins := NewCoinList(loadFixtureCoins(t), DefaultCoinListConfig())
+
+	// Act
+	require.NoError(t, coins.Refresh())
+
+	// Assert
+	for asset, expected := range map[string]string{
+		"BTC":  "bitcoin",            // pinned over batcoin
+		"INJ":  "injective-protocol", // only coin with the ticker
+		"PEPE": "pepe",               // the coin whose ID is the ticker
+	} {
+		coinID, err := coins.CoinID(asset)
+		require.NoError(t, err, asset)
+		assert.Equal(t, expected, coinID, asset)
+	}
+
+	_, err := coins.CoinID("TON")
+	assert.ErrorIs(t, err, ErrAmbiguousCoin)
+	assert.Contains(t, err.Error(), "the-open-network, tokamak-network")
+
+	_, err = coins.CoinID("NOPE")
+	assert.ErrorIs(t, err, ErrUnknownCoin)
+}
+
+func TestCoinList_OverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ton": "the-open-network", "BTC": "batcoin"}`), 0o644))
+	config := DefaultCoinListConfig()
+	config.OverridesFile = path
+
+	// Overrides apply even when the coin list is unavailable
+	api := &fixtureCoins{err: errors.New("API error")}
+	coins := NewCoinList(api, config)
+	assert.Error(t, coins.Refresh())
+
+	coinID, err := coins.CoinID("TON")
+	require.NoError(t, err)
+	assert.Equal(t, "the-open-network", coinID)
+	coinID, _ = coins.CoinID("BTC")
+	assert.Equal(t, "batcoin", coinID)
+
+	// A broken overrides file keeps the previous overrides and still
+	// refreshes the list
+	require.NoError(t, os.WriteFile(path, []byte(`not json`), 0o644))
+	api.coins, api.err = loadFixtureCoins(t).coins, nil
+	require.NoError(t, coins.Refresh())
+
+	assert.True(t, coins.Loaded())
+	coinID, _ = coins.CoinID("BTC")
+	assert.Equal(t, "batcoin", coinID)
+	coinID, err = coins.CoinID("INJ")
+	require.NoError(t, err)
+	assert.Equal(t, "injective-protocol", coinID)
+}
+
+func TestCoinList_MissingOverridesFileStillLoadsList(t *testing.T) {
+	config := DefaultCoinListConfig()
+	config.OverridesFile = filepath.Join(t.TempDir(), "missing.json")
+	coins := NewCoinList(loadFixtureCoins(t), config)
+
+	require.NoError(t, coins.Refresh())
+
+	coinID, err := coins.CoinID("BTC")
+	require.NoError(t, err)
+	assert.Equal(t, "bitcoin", coinID)
+}
+
+func TestCoinList_FailedRefreshKeepsList(t *testing.T) {
+	api := loadFixtureCoins(t)
+	coins := NewCoinList(api, DefaultCoinListConfig())
+
+	// Before the first load nothing is guessed
+	_, err := coins.CoinID("INJ")
+	assert.ErrorIs(t, err, ErrUnknownCoin)
+
+	require.NoError(t, coins.Refresh())
+	api.coins, api.err = nil, errors.New("API error")
+	assert.Error(t, coins.Refresh())
+	api.err = nil
+	assert.Error(t, coins.Refresh())
+
+	assert.True(t, coins.Loaded())
+	coinID, err := coins.CoinID("INJ")
+	require.NoError(t, err)
+	assert.Equal(t, "injective-protocol", coinID)
+}
+
+func TestCoinGecko_Symbol(t *testing.T) {
+	p := NewCoinGecko(nil)
+
+	symbol, err := p.Symbol(symbols.Pair{Base: "BTC", Quote: "USDT"})
+	require.NoError(t, err)
+	assert.Equal(t, "bitcoin/usd", symbol)
+
+	_, err = p.Symbol(symbols.Pair{Base: "INJ", Quote: "USDT"})
+	assert.ErrorIs(t, err, ErrUnknownCoin)
+
+	coins := NewCoinList(loadFixtureCoins(t), DefaultCoinListConfig())
+	require.NoError(t, coins.Refresh())
+	p.UseCoinList(coins)
+
+	symbol, err = p.Symbol(symbols.Pair{Base: "INJ", Quote: "EUR"})
+	require.NoError(t, err)
+	assert.Equal(t, "injective-protocol/eur", symbol)
+}
@@ -0,0 +1,87 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+)
+
+// guarded routes a provider's upstream calls through its circuit breaker.
+type guarded struct {
+	Provider
+	breaker *Breaker
+}
+
+// guardedBatch also passes batch ticker calls through the breaker.
+type guardedBatch struct {
+	*guarded
+	batch BatchTickerProvider
+}
+
+func guard(p Provider, breaker *Breaker) Provider {
+	g := &guarded{Provider: p, breaker: breaker}
+	if batch, ok := p.(BatchTickerProvider); ok {
+		return &guardedBatch{guarded: g, batch: batch}
+	}
+	return g
+}
+
+func (g *guarded) call(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !g.breaker.Allow() {
+		return ErrCircuitOpen
+	}
+
+	start := time.Now()
+	err := fn()
+	if errors.Is(err, context.Canceled) {
+		// Giving up on the answer says nothing about the venue's health,
+		// not even that it is healthy enough to close a half-open breaker
+		g.breaker.Release()
+		return err
+	}
+	outcome := err
+	if errors.Is(err, ErrNotSupported) || errors.Is(err, ErrRejected) {
+		// Asking for unsupported data or pairs or being refused as invalid
+		// says nothing about the venue's health; slow calls still count
+		outcome = nil
+	}
+	g.breaker.Record(outcome, time.Since(start))
+	return err
+}
+
+func (g *guarded) GetTicker(ctx context.Context, pair symbols.Pair) (ticker *Ticker, err error) {
+	err = g.call(ctx, func() error {
+		ticker, err = g.Provider.GetTicker(ctx, pair)
+		return err
+	})
+	return ticker, err
+}
+
+func (g *guarded) GetKlines(ctx context.Context, query KlineQuery) (klines []Kline, err error) {
+	err = g.call(ctx, func() error {
+		klines, err = g.Provider.GetKlines(ctx, query)
+		return err
+	})
+	return klines, err
+}
+
+func (g *guarded) GetDepth(ctx context.Context, pair symbols.Pair, limit int) (depth *Depth, err error) {
+	err = g.call(ctx, func() error {
+		depth, err = g.Provider.GetDepth(ctx, pair, limit)
+		return err
+	})
+	return depth, err
+}
+
+func (g *guardedBatch) GetTickers(ctx context.Context, pairs []symbols.Pair) (result map[symbols.Pair]TickerResult, err error) {
+	err = g.call(ctx, func() error {
+		result, err = g.batch.GetTickers(ctx, pairs)
+		return err
+	})
+	return result, err
+}
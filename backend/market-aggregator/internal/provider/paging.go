@@ -0,0 +1,51 @@
+package provider
+
+import "context"
+
+// PageKlines fetches every candle in query's range, pageSize candles per
+// call, starting each page just after the previous page's last open time.
+// Without a StartTime the query is open-ended and a single page is fetched.
+// It returns the candles and the number of calls made.
+func PageKlines(ctx context.Context, p Provider, query KlineQuery, pageSize int) ([]Kline, int, error) {
+	if query.StartTime == 0 {
+		klines, err := p.GetKlines(ctx, query)
+		return klines, 1, err
+	}
+
+	var result []Kline
+	cursor := query.StartTime
+	pages := 0
+
+	for cursor <= query.EndTime {
+		size := pageSize
+		if query.Limit > 0 {
+			size = min(size, query.Limit-len(result))
+		}
+
+		page, err := p.GetKlines(ctx, KlineQuery{
+			Pair:      query.Pair,
+			Interval:  query.Interval,
+			StartTime: cursor,
+			EndTime:   query.EndTime,
+			Limit:     size,
+		})
+		if err != nil {
+			return nil, pages, err
+		}
+		pages++
+		result = append(result, page...)
+
+		if len(page) < size || (query.Limit > 0 && len(result) >= query.Limit) {
+			break
+		}
+
+		// Guard against a provider that ignores StartTime
+		last := page[len(page)-1].OpenTime
+		if last < cursor {
+			break
+		}
+		cursor = last + 1
+	}
+
+	return result, pages, nil
+}
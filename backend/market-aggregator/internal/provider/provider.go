@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/shopspring/decimal"
+)
+
+// Capability is a bit set describing which market data a provider can serve.
+type Capability uint8
+
+const (
+	CapTicker Capability = 1 << iota
+	CapKlines
+	CapDepth
+)
+
+// Has reports whether c includes every capability in other.
+func (c Capability) Has(other Capability) bool {
+	return c&other == other
+}
+
+// ErrNotSupported is returned when a provider is asked for data it does not serve.
+var ErrNotSupported = errors.New("operation not supported by provider")
+
+// ErrRejected is returned when a venue refuses a request as invalid, e.g. for
+// a symbol it does not list. The venue answered, so it says nothing about its
+// health.
+var ErrRejected = errors.New("request rejected by provider")
+
+// Provider is a source of market data. Implementations translate canonical
+// pairs into their venue's symbols and normalize upstream responses into the
+// types below, so the service layer does not need to know which venue it is
+// talking to.
+type Provider interface {
+	Name() string
+	Capabilities() Capability
+	// Symbol spells pair the way the venue does; it fails for pairs the
+	// venue cannot serve.
+	Symbol(pair symbols.Pair) (string, error)
+	GetTicker(ctx context.Context, pair symbols.Pair) (*Ticker, error)
+	GetKlines(ctx context.Context, query KlineQuery) ([]Kline, error)
+	GetDepth(ctx context.Context, pair symbols.Pair, limit int) (*Depth, error)
+}
+
+// Ticker is a venue-neutral 24h ticker. Statistics a provider cannot supply
+// are left invalid. Symbol is the venue's symbol.
+type Ticker struct {
+	Symbol     string
+	Price      decimal.Decimal
+	Change24h  decimal.NullDecimal
+	Volume24h  decimal.NullDecimal
+	High24h    decimal.NullDecimal
+	Low24h     decimal.NullDecimal
+	MarketCap  decimal.NullDecimal
+	LastUpdate time.Time
+	// AggregatedVolume is set when Volume24h sums many venues, as an
+	// aggregator's does, rather than being traded on the provider itself
+	AggregatedVolume bool
+}
+
+// TickerResult is one pair's outcome in a batch; Err is set when Ticker is nil.
+type TickerResult struct {
+	Ticker *Ticker
+	Err    error
+}
+
+// BatchTickerProvider is implemented by providers that can fetch many
+// tickers in one upstream call. Pairs missing from the result were not served.
+type BatchTickerProvider interface {
+	GetTickers(ctx context.Context, pairs []symbols.Pair) (map[symbols.Pair]TickerResult, error)
+}
+
+// KlineQuery selects candles. StartTime and EndTime are inclusive Unix
+// milliseconds; zero leaves the bound open, returning the most recent candles.
+type KlineQuery struct {
+	Pair      symbols.Pair
+	Interval  string
+	StartTime int64
+	EndTime   int64
+	Limit     int
+}
+
+// Kline is a venue-neutral candle. Times are Unix milliseconds.
+type Kline struct {
+	OpenTime            int64           `json:"openTime"`
+	Open                decimal.Decimal `json:"open"`
+	High                decimal.Decimal `json:"high"`
+	Low                 decimal.Decimal `json:"low"`
+	Close               decimal.Decimal `json:"close"`
+	Volume              decimal.Decimal `json:"volume"`
+	CloseTime           int64           `json:"closeTime"`
+	QuoteVolume         decimal.Decimal `json:"quoteVolume"`
+	Trades              int64           `json:"trades"`
+	TakerBuyBaseVolume  decimal.Decimal `json:"takerBuyBaseVolume"`
+	TakerBuyQuoteVolume decimal.Decimal `json:"takerBuyQuoteVolume"`
+}
+
+// Equal reports whether two candles carry the same values; decimals with
+// different trailing zeros are equal.
+func (k Kline) Equal(other Kline) bool {
+	return k.OpenTime == other.OpenTime && k.CloseTime == other.CloseTime && k.Trades == other.Trades &&
+		k.Open.Equal(other.Open) && k.High.Equal(other.High) && k.Low.Equal(other.Low) &&
+		k.Close.Equal(other.Close) && k.Volume.Equal(other.Volume) && k.QuoteVolume.Equal(other.QuoteVolume) &&
+		k.TakerBuyBaseVolume.Equal(other.TakerBuyBaseVolume) && k.TakerBuyQuoteVolume.Equal(other.TakerBuyQuoteVolume)
+}
+
+// Level is a [price, quantity] order book level; it marshals as a
+// two-element array of strings.
+type Level [2]decimal.Decimal
+
+func (l Level) Price() decimal.Decimal {
+	return l[0]
+}
+
+func (l Level) Quantity() decimal.Decimal {
+	return l[1]
+}
+
+// Depth is a venue-neutral order book snapshot. Symbol is the venue's symbol.
+type Depth struct {
+	Symbol string
+	Bids   []Level
+	Asks   []Level
+	// Quote is the asset prices are quoted in when the venue serves the pair
+	// against another quote, e.g. USD for USDT; empty means the pair's quote
+	Quote string
+	// LotSize is the base-asset quantity of one unit of a level's quantity
+	// on venues that count in lots or contracts; zero means one
+	LotSize decimal.Decimal
+	// UpdatedAt is when a locally maintained book last changed; it is zero
+	// for snapshots fetched on request
+	UpdatedAt time.Time
+}
@@ -0,0 +1,149 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry holds the configured providers in priority order. Each provider
+// sits behind its own circuit breaker; healthy providers are tried in
+// priority order before degraded ones, and open breakers fail fast.
+type Registry struct {
+	mu            sync.RWMutex
+	providers     map[string]Provider
+	breakers      map[string]*Breaker
+	order         []string
+	breakerConfig BreakerConfig
+}
+
+// NewRegistry creates a registry; the registration order is the default priority.
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{
+		providers:     make(map[string]Provider),
+		breakers:      make(map[string]*Breaker),
+		breakerConfig: DefaultBreakerConfig(),
+	}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+// SetBreakerConfig applies config to the breakers of providers registered
+// from now on; call it before registering.
+func (r *Registry) SetBreakerConfig(config BreakerConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakerConfig = config
+}
+
+// Register adds a provider at the lowest priority, replacing any provider
+// already registered under the same name.
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.providers[p.Name()]; !exists {
+		r.order = append(r.order, p.Name())
+	}
+	breaker := NewBreaker(r.breakerConfig)
+	r.providers[p.Name()] = guard(p, breaker)
+	r.breakers[p.Name()] = breaker
+}
+
+// SetOrder changes the priority order. Providers not listed keep their
+// relative order after the listed ones.
+func (r *Registry) SetOrder(names []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]bool, len(names))
+	order := make([]string, 0, len(r.order))
+	for _, name := range names {
+		if _, exists := r.providers[name]; !exists {
+			return fmt.Errorf("unknown provider: %s", name)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		order = append(order, name)
+	}
+	for _, name := range r.order {
+		if !seen[name] {
+			order = append(order, name)
+		}
+	}
+
+	r.order = order
+	return nil
+}
+
+// Get returns the provider registered under name.
+func (r *Registry) Get(name string) (Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, exists := r.providers[name]
+	return p, exists
+}
+
+// Providers returns the providers supporting capability in the order to try
+// them: healthy ones by priority, then degraded or probing ones, then those
+// whose breaker is open.
+func (r *Registry) Providers(capability Capability) []Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []Provider
+	var ranks []int
+	for _, name := range r.order {
+		if p := r.providers[name]; p.Capabilities().Has(capability) {
+			result = append(result, p)
+			ranks = append(ranks, r.breakers[name].rank())
+		}
+	}
+	sort.Stable(byRank{result, ranks})
+	return result
+}
+
+type byRank struct {
+	providers []Provider
+	ranks     []int
+}
+
+func (b byRank) Len() int           { return len(b.providers) }
+func (b byRank) Less(i, j int) bool { return b.ranks[i] < b.ranks[j] }
+func (b byRank) Swap(i, j int) {
+	b.providers[i], b.providers[j] = b.providers[j], b.providers[i]
+	b.ranks[i], b.ranks[j] = b.ranks[j], b.ranks[i]
+}
+
+// Primary returns the name of the highest priority provider supporting
+// capability, whatever its health. Data from any other provider is a fallback.
+func (r *Registry) Primary(capability Capability) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, name := range r.order {
+		if r.providers[name].Capabilities().Has(capability) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Health reports every provider's breaker, in priority order.
+func (r *Registry) Health() []Health {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]Health, 0, len(r.order))
+	for _, name := range r.order {
+		health := r.breakers[name].Health()
+		health.Name = name
+		result = append(result, health)
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubProvider struct {
+	name         string
+	capabilities Capability
+}
+
+func (p *stubProvider) Name() string             { return p.name }
+func (p *stubProvider) Capabilities() Capability { return p.capabilities }
+func (p *stubProvider) Symbol(pair symbols.Pair) (string, error) {
+	return pair.Compact(), nil
+}
+func (p *stubProvider) GetTicker(ctx context.Context, pair symbols.Pair) (*Ticker, error) {
+	return nil, ErrNotSupported
+}
+func (p *stubProvider) GetKlines(ctx context.Context, query KlineQuery) ([]Kline, error) {
+	return nil, ErrNotSupported
+}
+func (p *stubProvider) GetDepth(ctx context.Context, pair symbols.Pair, limit int) (*Depth, error) {
+	return nil, ErrNotSupported
+}
+
+func names(providers []Provider) []string {
+	var result []string
+	for _, p := range providers {
+		result = append(result, p.Name())
+	}
+	return result
+}
+
+func TestRegistry_ProvidersFilteredByCapability(t *testing.T) {
+	registry := NewRegistry(
+		&stubProvider{name: "a", capabilities: CapTicker | CapDepth},
+		&stubProvider{name: "b", capabilities: CapTicker},
+		&stubProvider{name: "c", capabilities: CapKlines},
+	)
+
+	assert.Equal(t, []string{"a", "b"}, names(registry.Providers(CapTicker)))
+	assert.Equal(t, []string{"a"}, names(registry.Providers(CapDepth)))
+	assert.Equal(t, []string{"c"}, names(registry.Providers(CapKlines)))
+}
+
+func TestRegistry_SetOrder(t *testing.T) {
+	registry := NewRegistry(
+		&stubProvider{name: "a", capabilities: CapTicker},
+		&stubProvider{name: "b", capabilities: CapTicker},
+		&stubProvider{name: "c", capabilities: CapTicker},
+	)
+
+	assert.NoError(t, registry.SetOrder([]string{"c", "a"}))
+	assert.Equal(t, []string{"c", "a", "b"}, names(registry.Providers(CapTicker)))
+
+	assert.Error(t, registry.SetOrder([]string{"unknown"}))
+	assert.Equal(t, []string{"c", "a", "b"}, names(registry.Providers(CapTicker)))
+}
@@ -0,0 +1,100 @@
+package rediscache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Codec turns cached values into bytes and back; service.CacheCodec encodes
+// the market responses.
+type Codec interface {
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+type Config struct {
+	// Namespace prefixes every key so deployments and incompatible
+	// releases sharing a Redis do not read each other's entries
+	Namespace string
+	// Timeout bounds each Redis command; a slow Redis is treated as a miss
+	Timeout time.Duration
+	// DefaultTTL applies to values set with a zero TTL, as in go-cache
+	DefaultTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Namespace:  "market-aggregator:v1",
+		Timeout:    200 * time.Millisecond,
+		DefaultTTL: 30 * time.Second,
+	}
+}
+
+// Cache stores values in Redis so replicas share them. Redis failures are
+// logged and treated as misses, leaving callers to fetch upstream.
+type Cache struct {
+	client redis.UniversalClient
+	codec  Codec
+	config Config
+}
+
+func New(client redis.UniversalClient, codec Codec, config Config) *Cache {
+	return &Cache{
+		client: client,
+		codec:  codec,
+		config: config,
+	}
+}
+
+func (c *Cache) key(key string) string {
+	return c.config.Namespace + ":" + key
+}
+
+func (c *Cache) Get(key string) (interface{}, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	data, err := c.client.Get(ctx, c.key(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Redis cache read failed")
+		return nil, false
+	}
+
+	value, err := c.codec.Decode(data)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Dropping undecodable cache entry")
+		return nil, false
+	}
+	return value, true
+}
+
+// Set stores value for ttl, or DefaultTTL when ttl is zero. A negative ttl
+// keeps it without expiry.
+func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
+	data, err := c.codec.Encode(value)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Failed to encode cache entry")
+		return
+	}
+	switch {
+	case ttl == 0:
+		ttl = c.config.DefaultTTL
+	case ttl < 0:
+		// Zero means no expiry to Redis
+		ttl = 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	if err := c.client.Set(ctx, c.key(key), data, ttl).Err(); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Redis cache write failed")
+	}
+}
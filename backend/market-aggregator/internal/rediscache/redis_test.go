@@ -0,0 +1,115 @@
+package rediscache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stringCodec caches strings as their bytes.
+type stringCodec struct{}
+
+func (stringCodec) Encode(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+	return []byte(s), nil
+}
+
+func (stringCodec) Decode(data []byte) (interface{}, error) {
+	if string(data) == "corrupt" {
+		return nil, errors.New("corrupt entry")
+	}
+	return string(data), nil
+}
+
+func newTestCache(t *testing.T) (*Cache, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, stringCodec{}, DefaultConfig()), server
+}
+
+func TestCache_SetGet(t *testing.T) {
+	// Arrange
+	c, server := newTestCache(t)
+
+	// Act
+	c.Set("ticker:BTC-USDT", "26543.21", 30*time.Second)
+	value, found := c.Get("ticker:BTC-USDT")
+
+	// Assert
+	require.True(t, found)
+	assert.Equal(t, "26543.21", value)
+	assert.True(t, server.Exists("market-aggregator:v1:ticker:BTC-USDT"))
+	assert.Equal(t, 30*time.Second, server.TTL("market-aggregator:v1:ticker:BTC-USDT"))
+}
+
+func TestCache_Expires(t *testing.T) {
+	// Arrange
+	c, server := newTestCache(t)
+	c.Set("depth:BTC-USDT:20", "book", 5*time.Second)
+
+	// Act
+	server.FastForward(6 * time.Second)
+	_, found := c.Get("depth:BTC-USDT:20")
+
+	// Assert
+	assert.False(t, found)
+}
+
+func TestCache_TTLDefaults(t *testing.T) {
+	// Arrange
+	c, server := newTestCache(t)
+
+	// Act
+	c.Set("default", "x", 0)
+	c.Set("forever", "x", -1)
+
+	// Assert
+	assert.Equal(t, 30*time.Second, server.TTL("market-aggregator:v1:default"))
+	assert.Equal(t, time.Duration(0), server.TTL("market-aggregator:v1:forever"))
+}
+
+func TestCache_NamespacesAreIsolated(t *testing.T) {
+	// Arrange
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	v1 := New(client, stringCodec{}, DefaultConfig())
+	config := DefaultConfig()
+	config.Namespace = "market-aggregator:v2"
+	v2 := New(client, stringCodec{}, config)
+
+	// Act
+	v1.Set("ticker:BTC-USDT", "old", time.Minute)
+	_, found := v2.Get("ticker:BTC-USDT")
+
+	// Assert
+	assert.False(t, found)
+}
+
+func TestCache_FailuresAreMisses(t *testing.T) {
+	// Arrange
+	c, server := newTestCache(t)
+	require.NoError(t, server.Set("market-aggregator:v1:corrupt", "corrupt"))
+
+	// Act
+	_, corruptFound := c.Get("corrupt")
+	c.Set("unencodable", 42, time.Minute)
+	unencodableStored := server.Exists("market-aggregator:v1:unencodable")
+	server.Close()
+	_, downFound := c.Get("ticker:BTC-USDT")
+
+	// Assert
+	assert.False(t, corruptFound)
+	assert.False(t, unencodableStored)
+	assert.False(t, downFound)
+}
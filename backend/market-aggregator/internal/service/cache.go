@@ -0,0 +1,97 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// Cache holds responses for MarketService. *cache.Cache from go-cache is the
+// in-process implementation; shared backends such as Redis let replicas
+// reuse each other's upstream fetches and serialize values with CacheCodec.
+type Cache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{}, ttl time.Duration)
+}
+
+var _ Cache = (*cache.Cache)(nil)
+
+// cacheTypes names the values MarketService caches in serialized form.
+var cacheTypes = map[string]func() interface{}{
+	"ticker":             func() interface{} { return &TickerResponse{} },
+	"klines":             func() interface{} { return &KlineResponse{} },
+	"depth":              func() interface{} { return &DepthResponse{} },
+	"index":              func() interface{} { return &IndexResponse{} },
+	"consolidated_depth": func() interface{} { return &ConsolidatedDepthResponse{} },
+}
+
+func cacheTypeName(value interface{}) (string, bool) {
+	switch value.(type) {
+	case *TickerResponse:
+		return "ticker", true
+	case *KlineResponse:
+		return "klines", true
+	case *DepthResponse:
+		return "depth", true
+	case *IndexResponse:
+		return "index", true
+	case *ConsolidatedDepthResponse:
+		return "consolidated_depth", true
+	}
+	return "", false
+}
+
+// cachedValue is the serialized form of a cached value, tagged with its type
+// so it decodes back into the same response.
+type cachedValue struct {
+	Type       string          `json:"type"`
+	SoftExpiry *time.Time      `json:"softExpiry,omitempty"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// CacheCodec serializes the values MarketService caches as JSON.
+type CacheCodec struct{}
+
+func (CacheCodec) Encode(value interface{}) ([]byte, error) {
+	var encoded cachedValue
+	if entry, ok := value.(*cacheEntry); ok {
+		softExpiry := entry.softExpiry
+		encoded.SoftExpiry = &softExpiry
+		value = entry.value
+	}
+
+	name, ok := cacheTypeName(value)
+	if !ok {
+		return nil, fmt.Errorf("cannot cache values of type %T", value)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %v", name, err)
+	}
+	encoded.Type = name
+	encoded.Value = data
+	return json.Marshal(encoded)
+}
+
+func (CacheCodec) Decode(data []byte) (interface{}, error) {
+	var encoded cachedValue
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, fmt.Errorf("failed to decode cached value: %v", err)
+	}
+
+	newValue, ok := cacheTypes[encoded.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown cached value type %q", encoded.Type)
+	}
+	value := newValue()
+	if err := json.Unmarshal(encoded.Value, value); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", encoded.Type, err)
+	}
+
+	if encoded.SoftExpiry != nil {
+		return &cacheEntry{value: value, softExpiry: *encoded.SoftExpiry}, nil
+	}
+	return value, nil
+}
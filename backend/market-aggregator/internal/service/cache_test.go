@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/rediscache"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheCodec_RoundTrip(t *testing.T) {
+	fetchedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ticker := &TickerResponse{
+		Symbol:       "BTC-USDT",
+		VenueSymbols: map[string]string{"binance": "BTCUSDT"},
+		Price:        dec("26543.21"),
+		Change24h:    OptionalDecimal{decimal.NewNullDecimal(dec("2.45"))},
+		Source:       "binance",
+		Timestamp:    fetchedAt,
+		Freshness:    Freshness{FetchedAt: fetchedAt},
+	}
+	values := []interface{}{
+		ticker,
+		&KlineResponse{Symbol: "BTC-USDT", Interval: "1h", Klines: []provider.Kline{{OpenTime: 1620000000000, Open: dec("50000"), Close: dec("50500")}}, Source: "binance"},
+		&DepthResponse{Symbol: "BTC-USDT", Bids: []provider.Level{{dec("50000"), dec("1.5")}}, Asks: []provider.Level{}, Source: "binance"},
+		&IndexResponse{Symbol: "BTC-USDT", Price: dec("26540"), Constituents: []IndexConstituent{{Source: "binance", Weight: dec("1")}}},
+		&ConsolidatedDepthResponse{Symbol: "BTC-USDT", Sources: []string{"binance"}},
+		&cacheEntry{value: ticker, softExpiry: fetchedAt.Add(30 * time.Second)},
+	}
+
+	codec := CacheCodec{}
+	for _, value := range values {
+		data, err := codec.Encode(value)
+		require.NoError(t, err)
+
+		decoded, err := codec.Decode(data)
+		require.NoError(t, err)
+		assert.IsType(t, value, decoded)
+		reencoded, err := codec.Encode(decoded)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(data), string(reencoded))
+	}
+
+	decoded, err := codec.Decode(mustEncode(t, values[0]))
+	require.NoError(t, err)
+	assert.True(t, decoded.(*TickerResponse).Price.Equal(ticker.Price))
+	assert.True(t, decoded.(*TickerResponse).Change24h.Equal(ticker.Change24h))
+	assert.False(t, decoded.(*TickerResponse).Volume24h.Valid)
+
+	_, err = codec.Encode("not a response")
+	assert.Error(t, err)
+	_, err = codec.Decode([]byte(`{"type":"orders","value":{}}`))
+	assert.Error(t, err)
+}
+
+func mustEncode(t *testing.T, value interface{}) []byte {
+	data, err := CacheCodec{}.Encode(value)
+	require.NoError(t, err)
+	return data
+}
+
+func TestMarketService_RedisCacheSharedBetweenReplicas(t *testing.T) {
+	// Arrange
+	server := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer redisClient.Close()
+	newReplica := func(binance *MockBinanceClient) *MarketService {
+		registry := provider.NewRegistry(provider.NewBinance(binance), provider.NewCoinGecko(new(MockCoinGeckoClient)))
+		return NewMarketService(registry, rediscache.New(redisClient, CacheCodec{}, rediscache.DefaultConfig()))
+	}
+
+	firstBinance := new(MockBinanceClient)
+	firstBinance.On("Get24hrTicker", "BTCUSDT").Return(&client.BinanceTicker{Symbol: "BTCUSDT", LastPrice: dec("26543.21")}, nil).Once()
+	secondBinance := new(MockBinanceClient)
+	first, second := newReplica(firstBinance), newReplica(secondBinance)
+
+	// Act
+	fetched, err := first.GetTicker(context.Background(), btcusdt)
+	require.NoError(t, err)
+	shared, err := second.GetTicker(context.Background(), btcusdt)
+
+	// Assert
+	require.NoError(t, err)
+	secondBinance.AssertNotCalled(t, "Get24hrTicker")
+	assert.Equal(t, "26543.21", shared.Price.String())
+	assert.False(t, shared.Stale)
+	assert.True(t, fetched.FetchedAt.Equal(shared.FetchedAt))
+	assert.Equal(t, DefaultCacheConfig().Ticker.HardTTL, server.TTL("market-aggregator:v1:ticker:BTC-USDT"))
+}
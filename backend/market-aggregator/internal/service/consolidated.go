@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+)
+
+// ConsolidatedDepthResponse is a single price ladder merged from every venue
+// that serves depth for the symbol. Each venue's book is first normalized to
+// the pair: prices converted into its quote asset and quantities into base
+// units. It spans as many venues as there are depth providers registered;
+// with Binance alone it is Binance's book.
+type ConsolidatedDepthResponse struct {
+	Symbol       string              `json:"symbol"`
+	VenueSymbols map[string]string   `json:"venueSymbols"`
+	Bids         []ConsolidatedLevel `json:"bids"`
+	Asks         []ConsolidatedLevel `json:"asks"`
+	Sources      []string            `json:"sources"`
+	Errors       map[string]string   `json:"errors,omitempty"`
+	Timestamp    time.Time           `json:"timestamp"`
+	Freshness
+}
+
+// ConsolidatedLevel is the total base-asset quantity at a price together
+// with each venue's share of it.
+type ConsolidatedLevel struct {
+	Price    decimal.Decimal            `json:"price"`
+	Quantity decimal.Decimal            `json:"quantity"`
+	Venues   map[string]decimal.Decimal `json:"venues"`
+}
+
+type venueDepth struct {
+	venue string
+	bids  []provider.Level
+	asks  []provider.Level
+	err   error
+}
+
+func (s *MarketService) GetConsolidatedDepth(ctx context.Context, pair symbols.Pair, limit int) (*ConsolidatedDepthResponse, error) {
+	ctx, span := startSpan(ctx, "MarketService.GetConsolidatedDepth", pair)
+	defer span.End()
+
+	cacheKey := fmt.Sprintf("depth:consolidated:%s:%d", pair, limit)
+
+	cached, stale, err := s.cached(ctx, cacheKey, s.bounded(s.timeoutSettings().Depth, func(ctx context.Context) (interface{}, error) {
+		return s.fetchConsolidatedDepth(ctx, pair, limit, cacheKey)
+	}))
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	depth := cached.(*ConsolidatedDepthResponse)
+	if stale {
+		staleDepth := *depth
+		staleDepth.Stale = true
+		return &staleDepth, nil
+	}
+	return depth, nil
+}
+
+func (s *MarketService) fetchConsolidatedDepth(ctx context.Context, pair symbols.Pair, limit int, cacheKey string) (*ConsolidatedDepthResponse, error) {
+	// Query every venue concurrently; one slow venue should not serialize the rest
+	providers := s.providers.Providers(provider.CapDepth)
+	results := make([]venueDepth, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p provider.Provider) {
+			defer wg.Done()
+			results[i] = s.normalizedDepth(ctx, p, pair, limit)
+		}(i, p)
+	}
+	wg.Wait()
+
+	response := &ConsolidatedDepthResponse{
+		Symbol:       pair.String(),
+		VenueSymbols: s.venueSymbols(pair, provider.CapDepth),
+		Sources:      []string{},
+		Timestamp:    time.Now(),
+	}
+	response.FetchedAt = response.Timestamp
+	bids := make(map[string]*ConsolidatedLevel)
+	asks := make(map[string]*ConsolidatedLevel)
+	var errs []string
+	for _, r := range results {
+		if r.err != nil {
+			log.Warn().Err(r.err).Stringer("symbol", pair).Str("source", r.venue).Msg("Depth provider failed, excluded from consolidated book")
+			if response.Errors == nil {
+				response.Errors = make(map[string]string)
+			}
+			response.Errors[r.venue] = r.err.Error()
+			errs = append(errs, fmt.Sprintf("%s=%v", r.venue, r.err))
+			continue
+		}
+		response.Sources = append(response.Sources, r.venue)
+		mergeLevels(bids, r.venue, r.bids)
+		mergeLevels(asks, r.venue, r.asks)
+	}
+
+	if len(response.Sources) == 0 {
+		log.Error().Stringer("symbol", pair).Msg("Failed to fetch consolidated depth")
+		return nil, fmt.Errorf("failed to fetch consolidated depth: %s", joinErrors(errs))
+	}
+
+	precision := s.precision(pair)
+	response.Bids = ladder(bids, limit, true, precision)
+	response.Asks = ladder(asks, limit, false, precision)
+
+	s.store(cacheKey, response, response.FetchedAt, s.cacheSettings().Depth)
+	log.Info().Stringer("symbol", pair).Strs("sources", response.Sources).Msg("Consolidated depth built successfully")
+	return response, nil
+}
+
+// venueDepth prefers the locally maintained Binance book over a REST snapshot.
+func (s *MarketService) venueDepth(ctx context.Context, p provider.Provider, pair symbols.Pair, limit int) (*provider.Depth, error) {
+	if s.books != nil && p.Name() == provider.BinanceName {
+		if depth, ok := s.books.Depth(pair, limit); ok {
+			return depth, nil
+		}
+	}
+	return p.GetDepth(ctx, pair, limit)
+}
+
+// normalizedDepth fetches a venue's book and normalizes it to pair. Converted
+// prices are rounded to the pair's price precision, bids down and asks up, so
+// that levels from different venues can meet and none looks better than it is.
+func (s *MarketService) normalizedDepth(ctx context.Context, p provider.Provider, pair symbols.Pair, limit int) venueDepth {
+	result := venueDepth{venue: p.Name()}
+
+	depth, err := s.venueDepth(ctx, p, pair, limit)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	rate := decimal.NewFromInt(1)
+	if depth.Quote != "" && depth.Quote != pair.Quote {
+		rate, err = s.quoteRate(ctx, depth.Quote, pair.Quote)
+		if err != nil {
+			result.err = err
+			return result
+		}
+	}
+	lotSize := depth.LotSize
+	if !lotSize.IsPositive() {
+		lotSize = decimal.NewFromInt(1)
+	}
+
+	places := s.precision(pair).Price
+	result.bids = normalizeLevels(depth.Bids, rate, lotSize, func(d decimal.Decimal) decimal.Decimal { return d.RoundFloor(places) })
+	result.asks = normalizeLevels(depth.Asks, rate, lotSize, func(d decimal.Decimal) decimal.Decimal { return d.RoundCeil(places) })
+	return result
+}
+
+func normalizeLevels(levels []provider.Level, rate, lotSize decimal.Decimal, round func(decimal.Decimal) decimal.Decimal) []provider.Level {
+	one := decimal.NewFromInt(1)
+	if rate.Equal(one) && lotSize.Equal(one) {
+		return levels
+	}
+
+	result := make([]provider.Level, len(levels))
+	for i, l := range levels {
+		price := l.Price()
+		if !rate.Equal(one) {
+			price = round(price.Mul(rate))
+		}
+		result[i] = provider.Level{price, l.Quantity().Mul(lotSize)}
+	}
+	return result
+}
+
+// quoteRate is the price of one unit of from in to, read from the from/to
+// ticker or else inverted from the to/from one.
+func (s *MarketService) quoteRate(ctx context.Context, from, to string) (decimal.Decimal, error) {
+	ticker, err := s.GetTicker(ctx, symbols.Pair{Base: from, Quote: to})
+	if err == nil && ticker.Price.IsPositive() {
+		return ticker.Price, nil
+	}
+	inverse, inverseErr := s.GetTicker(ctx, symbols.Pair{Base: to, Quote: from})
+	if inverseErr == nil && inverse.Price.IsPositive() {
+		return decimal.NewFromInt(1).DivRound(inverse.Price, 16), nil
+	}
+	if err == nil {
+		err = inverseErr
+	}
+	if err == nil {
+		err = errors.New("no positive price")
+	}
+	return decimal.Zero, fmt.Errorf("failed to convert %s prices to %s: %v", from, to, err)
+}
+
+// mergeLevels adds a venue's levels to the ladder. Prices are keyed by
+// canonical value so "100.0" and "100.00" from different venues land on the
+// same level, and quantities are summed exactly.
+func mergeLevels(ladder map[string]*ConsolidatedLevel, venue string, levels []provider.Level) {
+	for _, l := range levels {
+		if !l.Quantity().IsPositive() {
+			continue
+		}
+
+		key := l.Price().String()
+		level, exists := ladder[key]
+		if !exists {
+			level = &ConsolidatedLevel{
+				Price:  l.Price(),
+				Venues: make(map[string]decimal.Decimal),
+			}
+			ladder[key] = level
+		}
+		level.Quantity = level.Quantity.Add(l.Quantity())
+		level.Venues[venue] = level.Venues[venue].Add(l.Quantity())
+	}
+}
+
+// ladder sorts the best limit levels and rounds them for output.
+func ladder(levels map[string]*ConsolidatedLevel, limit int, descending bool, precision Precision) []ConsolidatedLevel {
+	sorted := make([]*ConsolidatedLevel, 0, len(levels))
+	for _, level := range levels {
+		sorted = append(sorted, level)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if descending {
+			return sorted[i].Price.GreaterThan(sorted[j].Price)
+		}
+		return sorted[i].Price.LessThan(sorted[j].Price)
+	})
+
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	result := make([]ConsolidatedLevel, len(sorted))
+	for i, level := range sorted {
+		venues := make(map[string]decimal.Decimal, len(level.Venues))
+		for venue, qty := range level.Venues {
+			venues[venue] = precision.quantity(qty)
+		}
+		result[i] = ConsolidatedLevel{
+			Price:    precision.price(level.Price),
+			Quantity: precision.quantity(level.Quantity),
+			Venues:   venues,
+		}
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProvider serves canned data for whichever capabilities it declares.
+type stubProvider struct {
+	name         string
+	capabilities provider.Capability
+	ticker       *provider.Ticker
+	depth        *provider.Depth
+	err          error
+}
+
+func (p *stubProvider) Name() string                      { return p.name }
+func (p *stubProvider) Capabilities() provider.Capability { return p.capabilities }
+func (p *stubProvider) Symbol(pair symbols.Pair) (string, error) {
+	return pair.Compact(), nil
+}
+func (p *stubProvider) GetTicker(ctx context.Context, pair symbols.Pair) (*provider.Ticker, error) {
+	return p.ticker, p.err
+}
+func (p *stubProvider) GetKlines(ctx context.Context, query provider.KlineQuery) ([]provider.Kline, error) {
+	return nil, provider.ErrNotSupported
+}
+func (p *stubProvider) GetDepth(ctx context.Context, pair symbols.Pair, limit int) (*provider.Depth, error) {
+	return p.depth, p.err
+}
+
+func levels(rows [][]string) []provider.Level {
+	result := make([]provider.Level, len(rows))
+	for i, row := range rows {
+		result[i] = provider.Level{dec(row[0]), dec(row[1])}
+	}
+	return result
+}
+
+func TestMarketService_GetConsolidatedDepth_MergesVenues(t *testing.T) {
+	// Arrange
+	registry := provider.NewRegistry(
+		&stubProvider{name: "alpha", capabilities: provider.CapDepth, depth: &provider.Depth{
+			Bids: levels([][]string{{"100.00", "1.5"}, {"99.00", "2"}}),
+			Asks: levels([][]string{{"101.00", "1"}}),
+		}},
+		&stubProvider{name: "beta", capabilities: provider.CapDepth, depth: &provider.Depth{
+			Bids: levels([][]string{{"100.0", "0.5"}, {"100.50", "1"}}),
+			Asks: levels([][]string{{"100.90", "3"}, {"101", "2"}}),
+		}},
+		&stubProvider{name: "gamma", capabilities: provider.CapDepth, err: errors.New("API error")},
+	)
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+
+	// Act
+	result, err := service.GetConsolidatedDepth(context.Background(), btcusdt, 2)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha", "beta"}, result.Sources)
+	assert.Contains(t, result.Errors, "gamma")
+
+	require.Len(t, result.Bids, 2)
+	bids, err := json.Marshal(result.Bids)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"price": "100.5", "quantity": "1", "venues": {"beta": "1"}},
+		{"price": "100", "quantity": "2", "venues": {"alpha": "1.5", "beta": "0.5"}}
+	]`, string(bids))
+
+	require.Len(t, result.Asks, 2)
+	assert.Equal(t, "100.9", result.Asks[0].Price.String())
+	assert.Equal(t, "3", result.Asks[1].Quantity.String())
+}
+
+func TestMarketService_GetConsolidatedDepth_NormalizesVenues(t *testing.T) {
+	// Arrange: beta quotes BTC in USD and counts in lots of 0.01 BTC
+	registry := provider.NewRegistry(
+		&stubProvider{name: "alpha", capabilities: provider.CapDepth, depth: &provider.Depth{
+			Bids: levels([][]string{{"99.99", "1"}}),
+			Asks: levels([][]string{{"100.10", "2"}}),
+		}},
+		&stubProvider{name: "beta", capabilities: provider.CapDepth, depth: &provider.Depth{
+			Bids:    levels([][]string{{"100.20", "50"}}),
+			Asks:    levels([][]string{{"100.30", "30"}}),
+			Quote:   "USD",
+			LotSize: dec("0.01"),
+		}},
+		// Prices USD/USDT
+		tickerStub("rates", "0.998", "", time.Now()),
+	)
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+	service.SetPrecision(btcusdt, Precision{Price: 2, Quantity: 8})
+
+	// Act
+	result, err := service.GetConsolidatedDepth(context.Background(), btcusdt, 10)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha", "beta"}, result.Sources)
+	levels, err := json.Marshal(map[string]interface{}{"bids": result.Bids, "asks": result.Asks})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"bids": [{"price": "99.99", "quantity": "1.5", "venues": {"alpha": "1", "beta": "0.5"}}],
+		"asks": [{"price": "100.1", "quantity": "2.3", "venues": {"alpha": "2", "beta": "0.3"}}]
+	}`, string(levels))
+}
+
+func TestMarketService_GetConsolidatedDepth_ExcludesUnconvertibleVenue(t *testing.T) {
+	registry := provider.NewRegistry(
+		&stubProvider{name: "alpha", capabilities: provider.CapDepth, depth: &provider.Depth{Bids: levels([][]string{{"100", "1"}})}},
+		&stubProvider{name: "beta", capabilities: provider.CapDepth, depth: &provider.Depth{Bids: levels([][]string{{"100", "1"}}), Quote: "EUR"}},
+	)
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+
+	result, err := service.GetConsolidatedDepth(context.Background(), btcusdt, 10)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha"}, result.Sources)
+	assert.Contains(t, result.Errors["beta"], "failed to convert EUR prices to USDT")
+}
+
+func TestMarketService_GetConsolidatedDepth_AllVenuesFail(t *testing.T) {
+	registry := provider.NewRegistry(&stubProvider{name: "alpha", capabilities: provider.CapDepth, err: errors.New("API error")})
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+
+	result, err := service.GetConsolidatedDepth(context.Background(), btcusdt, 20)
+
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), "failed to fetch consolidated depth")
+}
+
+func TestMarketService_GetConsolidatedDepth_ServesStaleWhileRefreshing(t *testing.T) {
+	// Arrange
+	registry := provider.NewRegistry(
+		&stubProvider{name: "alpha", capabilities: provider.CapDepth, depth: &provider.Depth{
+			Bids: levels([][]string{{"100", "1"}}),
+			Asks: levels([][]string{{"101", "1"}}),
+		}},
+	)
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+	service.cacheConfig.Depth = CachePolicy{SoftTTL: time.Millisecond, HardTTL: time.Minute}
+	defer service.Close()
+
+	first, err := service.GetConsolidatedDepth(context.Background(), btcusdt, 10)
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	// Act
+	second, err := service.GetConsolidatedDepth(context.Background(), btcusdt, 10)
+
+	// Assert
+	require.NoError(t, err)
+	assert.False(t, first.Stale)
+	assert.True(t, second.Stale)
+	assert.Equal(t, first.FetchedAt, second.FetchedAt)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// TimeoutConfig bounds the upstream work of each operation, fallbacks and
+// paging included. The HTTP clients' own timeouts still bound every single
+// call. Zero leaves an operation bounded by its caller only.
+type TimeoutConfig struct {
+	Ticker time.Duration
+	// Tickers bounds the batch calls of a multi-symbol request
+	Tickers time.Duration
+	Klines  time.Duration
+	// KlineRange bounds paged range and resampled kline fetches
+	KlineRange time.Duration
+	Depth      time.Duration
+	Index      time.Duration
+}
+
+func DefaultTimeoutConfig() TimeoutConfig {
+	return TimeoutConfig{
+		Ticker:     8 * time.Second,
+		Tickers:    10 * time.Second,
+		Klines:     8 * time.Second,
+		KlineRange: 30 * time.Second,
+		Depth:      5 * time.Second,
+		Index:      8 * time.Second,
+	}
+}
+
+// SetTimeoutConfig replaces the operation deadlines. It is safe to call
+// while serving; operations already running keep their deadline.
+func (s *MarketService) SetTimeoutConfig(config TimeoutConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeouts = config
+}
+
+func (s *MarketService) timeoutSettings() TimeoutConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.timeouts
+}
+
+// withDeadline bounds an operation by timeout and by the service's lifetime,
+// so Close cancels upstream calls still in flight.
+func (s *MarketService) withDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	stop := context.AfterFunc(s.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// bounded applies an operation's deadline to each run of fetch.
+func (s *MarketService) bounded(timeout time.Duration, fetch fetchFunc) fetchFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := s.withDeadline(ctx, timeout)
+		defer cancel()
+		return fetch(ctx)
+	}
+}
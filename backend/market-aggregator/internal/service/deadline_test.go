@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingProvider holds ticker calls until their context is done.
+type blockingProvider struct {
+	stubProvider
+	started chan struct{}
+}
+
+func newBlockingProvider(name string) *blockingProvider {
+	return &blockingProvider{
+		stubProvider: stubProvider{name: name, capabilities: provider.CapTicker},
+		started:      make(chan struct{}, 1),
+	}
+}
+
+func (p *blockingProvider) GetTicker(ctx context.Context, pair symbols.Pair) (*provider.Ticker, error) {
+	p.started <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestMarketService_GetTicker_StopsAtDeadline(t *testing.T) {
+	// Arrange
+	backup := &stubProvider{name: "backup", capabilities: provider.CapTicker, ticker: &provider.Ticker{Price: dec("1")}}
+	service := NewMarketService(provider.NewRegistry(newBlockingProvider("slow"), backup), cache.New(time.Minute, time.Minute))
+	timeouts := DefaultTimeoutConfig()
+	timeouts.Ticker = 20 * time.Millisecond
+	service.SetTimeoutConfig(timeouts)
+
+	// Act
+	start := time.Now()
+	_, err := service.GetTicker(context.Background(), btcusdt)
+
+	// Assert
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "slow=context deadline exceeded")
+	assert.NotContains(t, err.Error(), "backup")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestMarketService_GetTicker_CancelledWithLastCaller(t *testing.T) {
+	// Arrange
+	slow := newBlockingProvider("slow")
+	service := NewMarketService(provider.NewRegistry(slow), cache.New(time.Minute, time.Minute))
+	service.SetTimeoutConfig(TimeoutConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Act
+	go func() {
+		<-slow.started
+		cancel()
+	}()
+	_, err := service.GetTicker(ctx, btcusdt)
+
+	// Assert
+	assert.ErrorIs(t, err, context.Canceled)
+	require.Eventually(t, func() bool {
+		service.flights.mu.Lock()
+		defer service.flights.mu.Unlock()
+		return len(service.flights.calls) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestMarketService_Close_CancelsUpstreamCalls(t *testing.T) {
+	// Arrange
+	slow := newBlockingProvider("slow")
+	service := NewMarketService(provider.NewRegistry(slow), cache.New(time.Minute, time.Minute))
+	service.SetTimeoutConfig(TimeoutConfig{})
+	done := make(chan error, 1)
+
+	// Act
+	go func() {
+		_, err := service.GetTicker(context.Background(), btcusdt)
+		done <- err
+	}()
+	<-slow.started
+	service.Close()
+
+	// Assert
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "context canceled")
+	case <-time.After(time.Second):
+		t.Fatal("GetTicker still waiting after Close")
+	}
+}
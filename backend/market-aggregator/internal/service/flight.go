@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// call is an upstream fetch in flight that later callers wait on.
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+	// Callers sharing the result besides the one fetching it
+	waiters int
+	// Callers still wanting the result; the fetch is cancelled once all of
+	// them have given up
+	interested int
+	cancel     context.CancelFunc
+}
+
+// flightGroup coalesces concurrent fetches for the same cache key so a miss
+// on a popular key costs one upstream call rather than one per request.
+// Every caller of a fetch receives the same result and error.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Do runs fn for key unless a call for key is already in flight, in which
+// case it waits for that call and returns its result. shared reports whether
+// the result went to more than one caller.
+//
+// fn runs without ctx's cancellation, so one caller going away does not fail
+// the others; it is cancelled once every caller has. A waiting caller whose
+// ctx is done stops waiting and gets ctx's error.
+func (g *flightGroup) Do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (value interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		c.waiters++
+		c.interested++
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.value, c.err, true
+		case <-ctx.Done():
+			g.mu.Lock()
+			c.waiters--
+			g.mu.Unlock()
+			g.abandon(c)
+			return nil, ctx.Err(), false
+		}
+	}
+	fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	c := &call{done: make(chan struct{}), interested: 1, cancel: cancel}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	// The caller running fn cannot leave early, but stops keeping it going
+	stop := context.AfterFunc(ctx, func() { g.abandon(c) })
+	defer stop()
+
+	defer func() {
+		// Release waiters even when fn panics; they see an error instead
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("fetch for %s panicked: %v", key, r)
+			g.finish(key, c)
+			panic(r)
+		}
+	}()
+	c.value, c.err = fn(fetchCtx)
+
+	waiters := g.finish(key, c)
+	return c.value, c.err, waiters > 0
+}
+
+// abandon drops a caller's interest in c, cancelling the fetch when it was
+// the last one.
+func (g *flightGroup) abandon(c *call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.interested--
+	if c.interested == 0 {
+		c.cancel()
+	}
+}
+
+// finish hands the result to the call's waiters, returning how many there
+// were. Later callers for key start a new call.
+func (g *flightGroup) finish(key string, c *call) int {
+	g.mu.Lock()
+	delete(g.calls, key)
+	waiters := c.waiters
+	g.mu.Unlock()
+	close(c.done)
+	return waiters
+}
+
+// Go starts fn for key in the background unless a call for key is already in
+// flight, reporting whether it started one. Callers of Do in the meantime
+// wait for its result. fn runs without ctx's cancellation, as nobody waits
+// for it to finish.
+func (g *flightGroup) Go(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) bool {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if _, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+	fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &call{done: make(chan struct{}), interested: 1, cancel: cancel}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		// Nobody would recover a panic here, so it fails the call instead
+		defer func() {
+			if r := recover(); r != nil {
+				c.err = fmt.Errorf("fetch for %s panicked: %v", key, r)
+				log.Error().Str("key", key).Interface("panic", r).Msg("Background fetch panicked")
+			}
+			g.finish(key, c)
+		}()
+		c.value, c.err = fn(fetchCtx)
+	}()
+	return true
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const concurrentCallers = 20
+
+// waitForWaiters blocks until n callers are waiting on the flight for key.
+func waitForWaiters(t *testing.T, g *flightGroup, key string, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		c, ok := g.calls[key]
+		return ok && c.waiters == n
+	}, time.Second, time.Millisecond)
+}
+
+// runConcurrently calls fn from n goroutines and waits for them all.
+func runConcurrently(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestFlightGroup_SharesResultAndError(t *testing.T) {
+	// Arrange
+	var g flightGroup
+	release := make(chan struct{})
+	calls := 0
+	fetchErr := errors.New("upstream down")
+
+	values := make([]interface{}, concurrentCallers)
+	errs := make([]error, concurrentCallers)
+	shared := make([]bool, concurrentCallers)
+
+	// Act
+	go func() {
+		waitForWaiters(t, &g, "key", concurrentCallers-1)
+		close(release)
+	}()
+	runConcurrently(concurrentCallers, func(i int) {
+		values[i], errs[i], shared[i] = g.Do(context.Background(), "key", func(context.Context) (interface{}, error) {
+			calls++
+			<-release
+			return "value", fetchErr
+		})
+	})
+
+	// Assert
+	assert.Equal(t, 1, calls)
+	for i := 0; i < concurrentCallers; i++ {
+		assert.Equal(t, "value", values[i])
+		assert.Same(t, fetchErr, errs[i])
+		assert.True(t, shared[i])
+	}
+
+	// The finished call is forgotten, so the next miss fetches again
+	_, _, again := g.Do(context.Background(), "key", func(context.Context) (interface{}, error) {
+		calls++
+		return nil, nil
+	})
+	assert.Equal(t, 2, calls)
+	assert.False(t, again)
+}
+
+func TestFlightGroup_ReleasesWaitersOnPanic(t *testing.T) {
+	// Arrange
+	var g flightGroup
+	release := make(chan struct{})
+	var waiterErr error
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		waitForWaiters(t, &g, "key", 0)
+		_, waiterErr, _ = g.Do(context.Background(), "key", func(context.Context) (interface{}, error) {
+			t.Error("waiter must not fetch")
+			return nil, nil
+		})
+	}()
+
+	// Act
+	assert.Panics(t, func() {
+		g.Do(context.Background(), "key", func(context.Context) (interface{}, error) {
+			go func() {
+				waitForWaiters(t, &g, "key", 1)
+				close(release)
+			}()
+			<-release
+			panic("boom")
+		})
+	})
+	<-done
+
+	// Assert
+	assert.ErrorContains(t, waiterErr, "panicked: boom")
+}
+
+func TestMarketService_GetTicker_CoalescesConcurrentMisses(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	release := make(chan struct{})
+	mockBinance.On("Get24hrTicker", "BTCUSDT").
+		Run(func(mock.Arguments) { <-release }).
+		Return(&client.BinanceTicker{Symbol: "BTCUSDT", LastPrice: dec("26543.21")}, nil).
+		Once()
+
+	results := make([]*TickerResponse, concurrentCallers)
+	errs := make([]error, concurrentCallers)
+
+	// Act
+	go func() {
+		waitForWaiters(t, &service.flights, "ticker:BTC-USDT", concurrentCallers-1)
+		close(release)
+	}()
+	runConcurrently(concurrentCallers, func(i int) {
+		results[i], errs[i] = service.GetTicker(context.Background(), btcusdt)
+	})
+
+	// Assert
+	mockBinance.AssertNumberOfCalls(t, "Get24hrTicker", 1)
+	for i := 0; i < concurrentCallers; i++ {
+		assert.NoError(t, errs[i])
+		assert.Same(t, results[0], results[i])
+	}
+	assert.Equal(t, "26543.21", results[0].Price.String())
+}
+
+func TestMarketService_GetKlines_CoalescesConcurrentFailures(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	release := make(chan struct{})
+	mockBinance.On("GetKlines", "BTCUSDT", "1h", 100).
+		Run(func(mock.Arguments) { <-release }).
+		Return(nil, errors.New("API error")).
+		Once()
+
+	errs := make([]error, concurrentCallers)
+
+	// Act
+	go func() {
+		waitForWaiters(t, &service.flights, "klines:BTC-USDT:1h:100", concurrentCallers-1)
+		close(release)
+	}()
+	runConcurrently(concurrentCallers, func(i int) {
+		_, errs[i] = service.GetKlines(context.Background(), btcusdt, "1h", 100)
+	})
+
+	// Assert
+	mockBinance.AssertNumberOfCalls(t, "GetKlines", 1)
+	for i := 0; i < concurrentCallers; i++ {
+		assert.ErrorContains(t, errs[i], "failed to fetch klines")
+		assert.Same(t, errs[0], errs[i])
+	}
+}
+
+func TestMarketService_GetDepth_CoalescesConcurrentMisses(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	release := make(chan struct{})
+	mockBinance.On("GetDepth", "BTCUSDT", 20).
+		Run(func(mock.Arguments) { <-release }).
+		Return(&client.BinanceDepth{
+			Bids: []client.BinanceLevel{{dec("50000"), dec("1.5")}},
+			Asks: []client.BinanceLevel{{dec("50001"), dec("1.2")}},
+		}, nil).
+		Once()
+
+	results := make([]*DepthResponse, concurrentCallers)
+	errs := make([]error, concurrentCallers)
+
+	// Act
+	go func() {
+		waitForWaiters(t, &service.flights, "depth:BTC-USDT:20", concurrentCallers-1)
+		close(release)
+	}()
+	runConcurrently(concurrentCallers, func(i int) {
+		results[i], errs[i] = service.GetDepth(context.Background(), btcusdt, 20)
+	})
+
+	// Assert
+	mockBinance.AssertNumberOfCalls(t, "GetDepth", 1)
+	for i := 0; i < concurrentCallers; i++ {
+		assert.NoError(t, errs[i])
+		assert.Same(t, results[0], results[i])
+	}
+	assert.Len(t, results[0].Bids, 1)
+}
+
+func TestFlightGroup_WaiterStopsWaitingWhenCancelled(t *testing.T) {
+	// Arrange
+	var g flightGroup
+	release := make(chan struct{})
+	var fetchErr error
+	leaderDone := make(chan struct{})
+
+	go func() {
+		defer close(leaderDone)
+		_, _, _ = g.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+			<-release
+			fetchErr = ctx.Err()
+			return "value", nil
+		})
+	}()
+	waitForWaiters(t, &g, "key", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Act
+	go func() {
+		waitForWaiters(t, &g, "key", 1)
+		cancel()
+	}()
+	_, err, shared := g.Do(ctx, "key", func(context.Context) (interface{}, error) {
+		t.Error("waiter must not fetch")
+		return nil, nil
+	})
+	close(release)
+	<-leaderDone
+
+	// Assert
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, shared)
+	assert.NoError(t, fetchErr, "the fetch goes on for the caller still waiting")
+}
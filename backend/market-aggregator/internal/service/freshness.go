@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CachePolicy bounds how long a cached response is served. Until SoftTTL it
+// is fresh; until HardTTL it is still served, marked stale, while a
+// background fetch replaces it; after that it is gone and callers wait for
+// the upstream.
+type CachePolicy struct {
+	SoftTTL time.Duration
+	HardTTL time.Duration
+}
+
+type CacheConfig struct {
+	Ticker CachePolicy
+	// FallbackTicker applies to tickers served by a fallback provider
+	FallbackTicker CachePolicy
+	Klines         CachePolicy
+	// KlineHistory applies to kline ranges that ended over an hour ago,
+	// whose candles no longer change
+	KlineHistory CachePolicy
+	Depth        CachePolicy
+	Index        CachePolicy
+	// RefreshInterval is how often the most requested keys are refreshed
+	// ahead of their soft expiry
+	RefreshInterval time.Duration
+	// HotKeys is how many of the most requested keys are kept refreshed
+	HotKeys int
+}
+
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		Ticker:          CachePolicy{SoftTTL: 30 * time.Second, HardTTL: 2 * time.Minute},
+		FallbackTicker:  CachePolicy{SoftTTL: 10 * time.Second, HardTTL: 30 * time.Second},
+		Klines:          CachePolicy{SoftTTL: 1 * time.Minute, HardTTL: 5 * time.Minute},
+		KlineHistory:    CachePolicy{SoftTTL: 10 * time.Minute, HardTTL: 1 * time.Hour},
+		Depth:           CachePolicy{SoftTTL: 5 * time.Second, HardTTL: 15 * time.Second},
+		Index:           CachePolicy{SoftTTL: 5 * time.Second, HardTTL: 15 * time.Second},
+		RefreshInterval: 1 * time.Second,
+		HotKeys:         50,
+	}
+}
+
+// SetCacheConfig replaces the cache policies. It is safe to call while
+// serving; entries already cached keep their expiry, and RefreshInterval
+// takes effect on StartRefresh.
+func (s *MarketService) SetCacheConfig(config CacheConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheConfig = config
+}
+
+func (s *MarketService) cacheSettings() CacheConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cacheConfig
+}
+
+// Freshness tells clients how old a response is. Stale responses are past
+// their soft TTL and are being refreshed.
+type Freshness struct {
+	FetchedAt time.Time `json:"fetchedAt"`
+	Stale     bool      `json:"stale"`
+}
+
+// Age is the time since the data was fetched upstream.
+func (f Freshness) Age() time.Duration {
+	return time.Since(f.FetchedAt)
+}
+
+// cacheEntry is what the stale-while-revalidate paths keep in the cache; the
+// cache itself evicts it at the hard TTL.
+type cacheEntry struct {
+	value      interface{}
+	softExpiry time.Time
+}
+
+func (s *MarketService) store(key string, value interface{}, fetchedAt time.Time, policy CachePolicy) {
+	s.cache.Set(key, &cacheEntry{value: value, softExpiry: fetchedAt.Add(policy.SoftTTL)}, policy.HardTTL)
+}
+
+func (s *MarketService) load(key string) (*cacheEntry, bool) {
+	cached, found := s.cache.Get(key)
+	if !found {
+		return nil, false
+	}
+	entry, ok := cached.(*cacheEntry)
+	return entry, ok
+}
+
+// lookup loads key and classifies it as a hit, stale or miss, recording the
+// lookup in a span and the cache metrics.
+func (s *MarketService) lookup(ctx context.Context, key string) (*cacheEntry, string) {
+	_, span := startCacheSpan(ctx, key)
+	entry, found := s.load(key)
+	result := "miss"
+	if found {
+		result = "hit"
+		if !time.Now().Before(entry.softExpiry) {
+			result = "stale"
+		}
+	}
+	endCacheSpan(span, key, result)
+	return entry, result
+}
+
+// fetchFunc fetches a cache key upstream and stores the result.
+type fetchFunc func(ctx context.Context) (interface{}, error)
+
+// cached serves key from the cache, refreshing it in the background once it
+// is stale, and calls fetch on a miss. fetch must store what it returns.
+// Concurrent fetches of a key share one upstream call, which is cancelled
+// only when every caller waiting on it is.
+func (s *MarketService) cached(ctx context.Context, key string, fetch fetchFunc) (value interface{}, stale bool, err error) {
+	s.hotKeys.hit(key, fetch)
+
+	entry, result := s.lookup(ctx, key)
+	switch result {
+	case "hit":
+		return entry.value, false, nil
+	case "stale":
+		if s.flights.Go(ctx, key, fetch) {
+			log.Debug().Str("key", key).Msg("Serving stale cache entry while refreshing")
+		}
+		return entry.value, true, nil
+	}
+
+	value, err, shared := s.flights.Do(ctx, key, fetch)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up; the fetch failing is a consequence
+		err = ctx.Err()
+	}
+	if shared {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.shared", true))
+		log.Debug().Str("key", key).Msg("Fetch shared with concurrent requests")
+	}
+	return value, false, err
+}
+
+// StartRefresh keeps the most requested keys refreshed ahead of their soft
+// expiry until Close is called.
+func (s *MarketService) StartRefresh() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.cacheSettings().RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case now := <-ticker.C:
+				s.refreshHotKeys(now)
+			}
+		}
+	}()
+}
+
+// Close stops the refresh loop and cancels upstream calls still in flight.
+func (s *MarketService) Close() {
+	s.cancel()
+	s.writes.Wait()
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+}
+
+// refreshHotKeys refreshes cached hot keys that go stale before the next
+// pass. Keys that dropped out of the cache are left to the next request.
+func (s *MarketService) refreshHotKeys(now time.Time) {
+	config := s.cacheSettings()
+	refreshed := 0
+	for _, key := range s.hotKeys.top(config.HotKeys) {
+		entry, ok := s.load(key.name)
+		if !ok || entry.softExpiry.Sub(now) > config.RefreshInterval {
+			continue
+		}
+		if s.flights.Go(context.Background(), key.name, refresh(key.name, key.fetch)) {
+			refreshed++
+		}
+	}
+	s.hotKeys.decay()
+
+	if refreshed > 0 {
+		log.Debug().Int("keys", refreshed).Msg("Refreshed hot cache keys")
+	}
+}
+
+// refresh runs a hot key's fetch in a trace of its own, as no request is
+// waiting for it.
+func refresh(key string, fetch fetchFunc) fetchFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		ctx, span := tracer.Start(ctx, "MarketService.refresh",
+			trace.WithAttributes(attribute.String("cache.key", key)))
+		defer span.End()
+
+		value, err := fetch(ctx)
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+		return value, nil
+	}
+}
+
+// hotKeys counts requests per cache key. Counts halve on every refresh pass
+// so keys cool down once requests stop.
+type hotKeys struct {
+	mu   sync.Mutex
+	keys map[string]*hotKey
+}
+
+type hotKey struct {
+	name  string
+	hits  int
+	fetch fetchFunc
+}
+
+func (h *hotKeys) hit(key string, fetch fetchFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.keys == nil {
+		h.keys = make(map[string]*hotKey)
+	}
+	k, ok := h.keys[key]
+	if !ok {
+		k = &hotKey{name: key}
+		h.keys[key] = k
+	}
+	k.hits++
+	k.fetch = fetch
+}
+
+// top returns up to n keys, most requested first.
+func (h *hotKeys) top(n int) []hotKey {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]hotKey, 0, len(h.keys))
+	for _, k := range h.keys {
+		keys = append(keys, *k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].hits != keys[j].hits {
+			return keys[i].hits > keys[j].hits
+		}
+		return keys[i].name < keys[j].name
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+func (h *hotKeys) decay() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, k := range h.keys {
+		k.hits /= 2
+		if k.hits == 0 {
+			delete(h.keys, name)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarketService_GetTicker_ServesStaleWhileRefreshing(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	fetchedAt := time.Now().Add(-45 * time.Second)
+	old := &TickerResponse{Symbol: "BTC-USDT", Price: dec("26000"), Source: "binance", Freshness: Freshness{FetchedAt: fetchedAt}}
+	service.store("ticker:BTC-USDT", old, fetchedAt, DefaultCacheConfig().Ticker)
+
+	release := make(chan struct{})
+	mockBinance.On("Get24hrTicker", "BTCUSDT").
+		Run(func(mock.Arguments) { <-release }).
+		Return(&client.BinanceTicker{Symbol: "BTCUSDT", LastPrice: dec("26543.21")}, nil).
+		Once()
+
+	// Act
+	stale, err := service.GetTicker(context.Background(), btcusdt)
+	again, _ := service.GetTicker(context.Background(), btcusdt)
+	close(release)
+
+	// Assert
+	require.NoError(t, err)
+	assert.True(t, stale.Stale)
+	assert.Equal(t, "26000", stale.Price.String())
+	assert.Equal(t, fetchedAt, stale.FetchedAt)
+	assert.True(t, again.Stale)
+	assert.False(t, old.Stale, "the cached response is not modified")
+
+	require.Eventually(t, func() bool {
+		ticker, err := service.GetTicker(context.Background(), btcusdt)
+		return err == nil && !ticker.Stale
+	}, time.Second, time.Millisecond)
+	fresh, _ := service.GetTicker(context.Background(), btcusdt)
+	assert.Equal(t, "26543.21", fresh.Price.String())
+	assert.WithinDuration(t, time.Now(), fresh.FetchedAt, time.Second)
+	mockBinance.AssertNumberOfCalls(t, "Get24hrTicker", 1)
+}
+
+func TestMarketService_RefreshHotKeys(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	config := DefaultCacheConfig()
+	config.HotKeys = 1
+	service.SetCacheConfig(config)
+
+	ethusdt := symbols.Pair{Base: "ETH", Quote: "USDT"}
+	seed := func(pair symbols.Pair, fetchedAt time.Time) {
+		ticker := &TickerResponse{Symbol: pair.String(), Price: dec("1"), Source: "binance"}
+		service.store(fmt.Sprintf("ticker:%s", pair), ticker, fetchedAt, config.Ticker)
+	}
+
+	// BTC is requested most; both go stale within the next refresh pass
+	seed(btcusdt, time.Now())
+	seed(ethusdt, time.Now())
+	for i := 0; i < 3; i++ {
+		service.GetTicker(context.Background(), btcusdt)
+	}
+	service.GetTicker(context.Background(), ethusdt)
+	almostStale := time.Now().Add(-config.Ticker.SoftTTL + config.RefreshInterval/2)
+	seed(btcusdt, almostStale)
+	seed(ethusdt, almostStale)
+
+	mockBinance.On("Get24hrTicker", "BTCUSDT").
+		Return(&client.BinanceTicker{Symbol: "BTCUSDT", LastPrice: dec("26543.21")}, nil).
+		Once()
+
+	// Act
+	service.refreshHotKeys(time.Now())
+
+	// Assert
+	require.Eventually(t, func() bool {
+		entry, ok := service.load("ticker:BTC-USDT")
+		return ok && entry.value.(*TickerResponse).Price.Equal(dec("26543.21"))
+	}, time.Second, time.Millisecond)
+	mockBinance.AssertNotCalled(t, "Get24hrTicker", "ETHUSDT")
+
+	// Counts halve each pass, so ETH's single request has cooled off
+	keys := service.hotKeys.top(10)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "ticker:BTC-USDT", keys[0].name)
+	assert.Equal(t, 1, keys[0].hits)
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ExclusionError   = "error"
+	ExclusionStale   = "stale"
+	ExclusionOutlier = "outlier"
+	ExclusionInvalid = "invalid"
+)
+
+type IndexConfig struct {
+	// MaxAge drops constituents whose last update is older than this
+	MaxAge time.Duration
+	// MaxDeviation drops constituents further than this fraction from the median
+	MaxDeviation decimal.Decimal
+	// MinSources is the number of constituents needed to publish a price
+	MinSources int
+}
+
+func DefaultIndexConfig() IndexConfig {
+	return IndexConfig{
+		MaxAge:       1 * time.Minute,
+		MaxDeviation: decimal.RequireFromString("0.05"),
+		MinSources:   1,
+	}
+}
+
+// IndexResponse is a composite reference price built from every ticker source.
+type IndexResponse struct {
+	Symbol       string             `json:"symbol"`
+	VenueSymbols map[string]string  `json:"venueSymbols"`
+	Price        decimal.Decimal    `json:"price"`
+	Constituents []IndexConstituent `json:"constituents"`
+	Timestamp    time.Time          `json:"timestamp"`
+	Freshness
+}
+
+// IndexConstituent is one source's contribution. Excluded constituents carry
+// a zero weight and the reason they were dropped.
+type IndexConstituent struct {
+	Source     string           `json:"source"`
+	Price      *decimal.Decimal `json:"price,omitempty"`
+	Volume     *decimal.Decimal `json:"volume,omitempty"`
+	Weight     decimal.Decimal  `json:"weight"`
+	Included   bool             `json:"included"`
+	Excluded   string           `json:"excluded,omitempty"`
+	LastUpdate time.Time        `json:"last_update"`
+
+	// volume is the weighting volume, after filling in missing volumes
+	volume decimal.Decimal
+}
+
+// GetIndex computes the volume-weighted median of all fresh, non-outlier
+// source prices. Outliers are judged against the unweighted median so that a
+// single high-volume venue cannot drag the reference toward itself; with
+// fewer than three fresh sources there is no majority to judge against, and
+// none are rejected.
+func (s *MarketService) GetIndex(ctx context.Context, pair symbols.Pair) (*IndexResponse, error) {
+	ctx, span := startSpan(ctx, "MarketService.GetIndex", pair)
+	defer span.End()
+
+	cacheKey := fmt.Sprintf("index:%s", pair)
+
+	cached, stale, err := s.cached(ctx, cacheKey, s.bounded(s.timeoutSettings().Index, func(ctx context.Context) (interface{}, error) {
+		return s.computeIndex(ctx, pair, cacheKey)
+	}))
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	index := cached.(*IndexResponse)
+	if stale {
+		staleIndex := *index
+		staleIndex.Stale = true
+		return &staleIndex, nil
+	}
+	return index, nil
+}
+
+func (s *MarketService) computeIndex(ctx context.Context, pair symbols.Pair, cacheKey string) (*IndexResponse, error) {
+	constituents := s.indexConstituents(ctx, pair)
+	config := s.indexConfig
+	now := time.Now()
+
+	var fresh []*IndexConstituent
+	for i := range constituents {
+		c := &constituents[i]
+		if c.Excluded != "" {
+			continue
+		}
+		if config.MaxAge > 0 && now.Sub(c.LastUpdate) > config.MaxAge {
+			c.Excluded = ExclusionStale
+			continue
+		}
+		fresh = append(fresh, c)
+	}
+
+	// Two sources apart by more than twice MaxDeviation would both be
+	// outliers from their midpoint
+	if len(fresh) >= 3 && config.MaxDeviation.IsPositive() {
+		prices := make([]decimal.Decimal, len(fresh))
+		for i, c := range fresh {
+			prices[i] = *c.Price
+		}
+		median := medianOf(prices)
+		maxDistance := median.Mul(config.MaxDeviation)
+
+		kept := fresh[:0]
+		for _, c := range fresh {
+			if c.Price.Sub(median).Abs().GreaterThan(maxDistance) {
+				c.Excluded = ExclusionOutlier
+				continue
+			}
+			kept = append(kept, c)
+		}
+		fresh = kept
+	}
+
+	if len(fresh) < max(config.MinSources, 1) {
+		log.Error().Stringer("symbol", pair).Int("sources", len(fresh)).Msg("Not enough index constituents")
+		return nil, fmt.Errorf("failed to compute index: %d usable sources, %d required", len(fresh), max(config.MinSources, 1))
+	}
+
+	assignWeights(fresh)
+	for _, c := range fresh {
+		c.Included = true
+	}
+
+	price := weightedMedian(fresh)
+
+	// Round for output only once the median is computed
+	precision := s.precision(pair)
+	for i := range constituents {
+		c := &constituents[i]
+		if c.Price != nil {
+			rounded := precision.price(*c.Price)
+			c.Price = &rounded
+		}
+		if c.Volume != nil {
+			rounded := precision.quantity(*c.Volume)
+			c.Volume = &rounded
+		}
+	}
+
+	response := &IndexResponse{
+		Symbol:       pair.String(),
+		VenueSymbols: s.venueSymbols(pair, provider.CapTicker),
+		Price:        precision.price(price),
+		Constituents: constituents,
+		Timestamp:    now,
+		Freshness:    Freshness{FetchedAt: now},
+	}
+
+	s.store(cacheKey, response, response.FetchedAt, s.cacheSettings().Index)
+	log.Info().Stringer("symbol", pair).Stringer("price", response.Price).Int("sources", len(fresh)).Msg("Index computed successfully")
+	return response, nil
+}
+
+func (s *MarketService) indexConstituents(ctx context.Context, pair symbols.Pair) []IndexConstituent {
+	providers := s.providers.Providers(provider.CapTicker)
+	constituents := make([]IndexConstituent, len(providers))
+
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p provider.Provider) {
+			defer wg.Done()
+			constituents[i] = newConstituent(ctx, p, pair)
+		}(i, p)
+	}
+	wg.Wait()
+
+	return constituents
+}
+
+func newConstituent(ctx context.Context, p provider.Provider, pair symbols.Pair) IndexConstituent {
+	c := IndexConstituent{Source: p.Name()}
+
+	ticker, err := p.GetTicker(ctx, pair)
+	if err != nil {
+		log.Warn().Err(err).Stringer("symbol", pair).Str("source", p.Name()).Msg("Index constituent unavailable")
+		c.Excluded = ExclusionError
+		return c
+	}
+
+	c.Price = &ticker.Price
+	// An aggregator's volume includes the other constituents' venues, so
+	// counting it would hand the aggregator most of the weight; it is
+	// weighted like a source without volume instead
+	if ticker.Volume24h.Valid && !ticker.AggregatedVolume {
+		c.Volume = &ticker.Volume24h.Decimal
+	}
+	c.LastUpdate = ticker.LastUpdate
+
+	if !ticker.Price.IsPositive() {
+		c.Excluded = ExclusionInvalid
+	}
+	return c
+}
+
+// assignWeights normalizes volumes into weights. Sources that report no
+// volume are weighted like the smallest reporting source, and if none report
+// volume every source counts equally.
+func assignWeights(constituents []*IndexConstituent) {
+	var minVolume decimal.Decimal
+	for _, c := range constituents {
+		if c.Volume != nil && c.Volume.IsPositive() && (minVolume.IsZero() || c.Volume.LessThan(minVolume)) {
+			minVolume = *c.Volume
+		}
+	}
+	if minVolume.IsZero() {
+		minVolume = decimal.NewFromInt(1)
+	}
+
+	var total decimal.Decimal
+	for _, c := range constituents {
+		c.volume = minVolume
+		if c.Volume != nil && c.Volume.IsPositive() {
+			c.volume = *c.Volume
+		}
+		total = total.Add(c.volume)
+	}
+	// Weights are for display; the median itself compares volumes exactly
+	for _, c := range constituents {
+		c.Weight = c.volume.DivRound(total, 8)
+	}
+}
+
+// weightedMedian returns the lowest price at which the cumulative volume
+// reaches half the total.
+func weightedMedian(constituents []*IndexConstituent) decimal.Decimal {
+	sorted := make([]*IndexConstituent, len(constituents))
+	copy(sorted, constituents)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Price.LessThan(*sorted[j].Price) })
+
+	var total decimal.Decimal
+	for _, c := range sorted {
+		total = total.Add(c.volume)
+	}
+
+	var cumulative decimal.Decimal
+	for _, c := range sorted {
+		cumulative = cumulative.Add(c.volume)
+		if cumulative.Add(cumulative).GreaterThanOrEqual(total) {
+			return *c.Price
+		}
+	}
+	return *sorted[len(sorted)-1].Price
+}
+
+func medianOf(values []decimal.Decimal) decimal.Decimal {
+	sorted := make([]decimal.Decimal, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].LessThan(sorted[j]) })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		// Halving a finite decimal is exact
+		return sorted[mid-1].Add(sorted[mid]).Mul(decimal.RequireFromString("0.5"))
+	}
+	return sorted[mid]
+}
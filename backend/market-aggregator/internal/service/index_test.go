@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/patrickmn/go-cache"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tickerStub(name, price, volume string, lastUpdate time.Time) *stubProvider {
+	ticker := &provider.Ticker{Symbol: "BTCUSDT", Price: dec(price), LastUpdate: lastUpdate}
+	if volume != "" {
+		ticker.Volume24h = decimal.NewNullDecimal(dec(volume))
+	}
+	return &stubProvider{name: name, capabilities: provider.CapTicker, ticker: ticker}
+}
+
+func constituent(t *testing.T, index *IndexResponse, source string) IndexConstituent {
+	for _, c := range index.Constituents {
+		if c.Source == source {
+			return c
+		}
+	}
+	t.Fatalf("constituent %s not found", source)
+	return IndexConstituent{}
+}
+
+func TestMarketService_GetIndex_VolumeWeightedMedian(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	registry := provider.NewRegistry(
+		tickerStub("alpha", "100", "10", now),
+		tickerStub("beta", "101", "60", now),
+		tickerStub("gamma", "102", "30", now),
+	)
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+
+	// Act
+	result, err := service.GetIndex(context.Background(), btcusdt)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "101", result.Price.String())
+	assert.InDelta(t, 0.6, constituent(t, result, "beta").Weight.InexactFloat64(), 1e-9)
+	assert.InDelta(t, 0.1, constituent(t, result, "alpha").Weight.InexactFloat64(), 1e-9)
+}
+
+func TestMarketService_GetIndex_RejectsOutliersAndStaleSources(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	registry := provider.NewRegistry(
+		tickerStub("alpha", "100", "10", now),
+		tickerStub("beta", "100.5", "10", now),
+		tickerStub("manipulated", "150", "1000", now),
+		tickerStub("stale", "100.2", "10", now.Add(-10*time.Minute)),
+		&stubProvider{name: "down", capabilities: provider.CapTicker, err: errors.New("API error")},
+	)
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+
+	// Act
+	result, err := service.GetIndex(context.Background(), btcusdt)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "100", result.Price.String())
+	assert.Equal(t, ExclusionOutlier, constituent(t, result, "manipulated").Excluded)
+	assert.Equal(t, ExclusionStale, constituent(t, result, "stale").Excluded)
+	assert.Equal(t, ExclusionError, constituent(t, result, "down").Excluded)
+	assert.True(t, constituent(t, result, "manipulated").Weight.IsZero())
+	assert.True(t, constituent(t, result, "alpha").Included)
+}
+
+func TestMarketService_GetIndex_KeepsTwoDivergentSources(t *testing.T) {
+	// Arrange: 20% apart, so both are over 5% from their midpoint
+	now := time.Now()
+	registry := provider.NewRegistry(
+		tickerStub("alpha", "100", "10", now),
+		tickerStub("beta", "120", "30", now),
+	)
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+
+	// Act
+	result, err := service.GetIndex(context.Background(), btcusdt)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "120", result.Price.String())
+	assert.True(t, constituent(t, result, "alpha").Included)
+	assert.True(t, constituent(t, result, "beta").Included)
+}
+
+func TestMarketService_GetIndex_MissingVolumeUsesSmallestWeight(t *testing.T) {
+	now := time.Now()
+	registry := provider.NewRegistry(
+		tickerStub("alpha", "100", "30", now),
+		tickerStub("beta", "100.1", "", now),
+	)
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+
+	result, err := service.GetIndex(context.Background(), btcusdt)
+
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, constituent(t, result, "beta").Weight.InexactFloat64(), 1e-9)
+}
+
+func TestMarketService_GetIndex_IgnoresAggregatedVolume(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	aggregator := tickerStub("aggregator", "102", "1000", now)
+	aggregator.ticker.AggregatedVolume = true
+	registry := provider.NewRegistry(
+		tickerStub("alpha", "100", "30", now),
+		tickerStub("beta", "101", "60", now),
+		aggregator,
+	)
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+
+	// Act
+	result, err := service.GetIndex(context.Background(), btcusdt)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "101", result.Price.String())
+	assert.Nil(t, constituent(t, result, "aggregator").Volume)
+	assert.InDelta(t, 0.25, constituent(t, result, "aggregator").Weight.InexactFloat64(), 1e-9)
+}
+
+func TestMarketService_GetIndex_NoUsableSources(t *testing.T) {
+	registry := provider.NewRegistry(&stubProvider{name: "down", capabilities: provider.CapTicker, err: errors.New("API error")})
+	service := NewMarketService(registry, cache.New(5*time.Minute, 10*time.Minute))
+
+	result, err := service.GetIndex(context.Background(), btcusdt)
+
+	assert.Error(t, err)
+	assert.Nil(t, result)
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/candles"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/rs/zerolog/log"
+)
+
+// SourceStore marks klines served from the local candle store.
+const SourceStore = "store"
+
+// ErrRangeTooLarge is returned when a kline range exceeds the configured span
+// or would resample too many base candles.
+var ErrRangeTooLarge = errors.New("kline range exceeds maximum span")
+
+type KlineRangeConfig struct {
+	// MaxSpan bounds endTime - startTime for a single request
+	MaxSpan time.Duration
+	// PageSize is the most candles requested from a provider per call
+	PageSize int
+	// MaxResampleCandles bounds the base candles aggregated for one
+	// resampled request
+	MaxResampleCandles int
+}
+
+func DefaultKlineRangeConfig() KlineRangeConfig {
+	return KlineRangeConfig{
+		MaxSpan:            30 * 24 * time.Hour,
+		PageSize:           1000,
+		MaxResampleCandles: 50000,
+	}
+}
+
+// SetKlineRangeConfig replaces the kline range limits. It is safe to call
+// while serving.
+func (s *MarketService) SetKlineRangeConfig(config KlineRangeConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.klineConfig = config
+}
+
+func (s *MarketService) klineSettings() KlineRangeConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.klineConfig
+}
+
+// GetKlineRange returns the candles opening between startTime and endTime
+// (inclusive Unix ms), paging through the provider's per-call limit as
+// needed. An endTime of zero means now; a limit of zero means no limit.
+// Without a startTime it returns the latest limit candles up to endTime.
+func (s *MarketService) GetKlineRange(ctx context.Context, pair symbols.Pair, interval string, startTime, endTime int64, limit int) (*KlineResponse, error) {
+	if !IsNativeInterval(interval) {
+		return s.GetResampledKlines(ctx, pair, interval, time.UTC, startTime, endTime, limit)
+	}
+
+	ctx, span := startSpan(ctx, "MarketService.GetKlineRange", pair)
+	defer span.End()
+
+	// Key on the requested bounds so open-ended ranges can hit the cache
+	cacheKey := fmt.Sprintf("klines:%s:%s:%d:%d:%d", pair, interval, startTime, endTime, limit)
+
+	limits := s.klineSettings()
+	if startTime == 0 {
+		if limit <= 0 || limit > limits.PageSize {
+			limit = limits.PageSize
+		}
+	} else if err := checkKlineRange(startTime, endTime, limits); err != nil {
+		return nil, err
+	}
+
+	cached, stale, err := s.cached(ctx, cacheKey, s.bounded(s.timeoutSettings().KlineRange, func(ctx context.Context) (interface{}, error) {
+		// An open end moves with the clock, background refreshes included
+		end := endTime
+		if end == 0 {
+			end = time.Now().UnixMilli()
+		}
+		response, err := s.fetchKlineRange(ctx, pair, interval, startTime, end, limit)
+		if err != nil {
+			return nil, err
+		}
+		response.Klines = s.precision(pair).klines(response.Klines)
+		s.store(cacheKey, response, response.FetchedAt, s.klineRangePolicy(endTime))
+		return response, nil
+	}))
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	klines := cached.(*KlineResponse)
+	if stale {
+		staleKlines := *klines
+		staleKlines.Stale = true
+		return &staleKlines, nil
+	}
+	return klines, nil
+}
+
+// checkKlineRange validates a range with a startTime against limits. An
+// endTime of zero means now.
+func checkKlineRange(startTime, endTime int64, limits KlineRangeConfig) error {
+	if endTime == 0 {
+		endTime = time.Now().UnixMilli()
+	}
+	if startTime > endTime {
+		return fmt.Errorf("startTime %d is after endTime %d", startTime, endTime)
+	}
+	if span := time.Duration(endTime-startTime) * time.Millisecond; span > limits.MaxSpan {
+		return fmt.Errorf("%w: %s > %s", ErrRangeTooLarge, span, limits.MaxSpan)
+	}
+	return nil
+}
+
+// klineRangePolicy is the cache policy of a range ending at endTime, zero
+// meaning now. A range that ended in the past will not change any more.
+func (s *MarketService) klineRangePolicy(endTime int64) CachePolicy {
+	config := s.cacheSettings()
+	if endTime > 0 && endTime < time.Now().Add(-1*time.Hour).UnixMilli() {
+		return config.KlineHistory
+	}
+	return config.Klines
+}
+
+// fetchKlineRange serves an already validated range of a native interval
+// from the candle store or the providers, with candles exactly as stored.
+func (s *MarketService) fetchKlineRange(ctx context.Context, pair symbols.Pair, interval string, startTime, endTime int64, limit int) (*KlineResponse, error) {
+	if startTime > 0 && s.candles != nil {
+		if klines, base, ok := s.storedKlines(pair, interval, startTime, min(endTime, time.Now().UnixMilli())); ok {
+			if limit > 0 && len(klines) > limit {
+				klines = klines[:limit]
+			}
+			log.Debug().Stringer("symbol", pair).Str("interval", interval).Str("base", base).Msg("Kline range served from candle store")
+			return s.storedKlineResponse(pair, interval, base, klines), nil
+		}
+	}
+
+	query := provider.KlineQuery{
+		Pair:      pair,
+		Interval:  interval,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Limit:     limit,
+	}
+
+	var errs []string
+	for _, p := range s.providers.Providers(provider.CapKlines) {
+		klines, pages, err := provider.PageKlines(ctx, p, query, s.klineSettings().PageSize)
+		if err != nil {
+			log.Warn().Err(err).Stringer("symbol", pair).Str("interval", interval).Str("source", p.Name()).Msg("Klines provider failed")
+			errs = append(errs, fmt.Sprintf("%s=%v", p.Name(), err))
+			if ctx.Err() != nil {
+				// Out of time; later providers would fail the same way
+				break
+			}
+			continue
+		}
+
+		s.storeKlines(pair, interval, klines)
+
+		response := &KlineResponse{
+			Symbol:       pair.String(),
+			VenueSymbols: s.venueSymbols(pair, provider.CapKlines),
+			Interval:     interval,
+			Klines:       klines,
+			Source:       p.Name(),
+			Freshness:    Freshness{FetchedAt: time.Now()},
+		}
+		log.Info().Stringer("symbol", pair).Str("interval", interval).Int("count", len(klines)).Int("pages", pages).Msg("Kline range fetched successfully")
+		return response, nil
+	}
+
+	log.Error().Stringer("symbol", pair).Str("interval", interval).Msg("Failed to fetch kline range")
+	return nil, fmt.Errorf("failed to fetch klines: %s", joinErrors(errs))
+}
+
+// latestStoredKlines serves the most recent limit candles from the store when
+// it has all of them, up to and including the currently open candle. That
+// candle is only as fresh as the last backfill pass.
+func (s *MarketService) latestStoredKlines(pair symbols.Pair, interval string, limit int) (*KlineResponse, bool) {
+	if s.candles == nil {
+		return nil, false
+	}
+
+	now := time.Now().UnixMilli()
+	current, err := candles.OpenTime(interval, now)
+	if err != nil {
+		return nil, false
+	}
+	start, err := candles.ShiftOpenTime(interval, current, -(limit - 1))
+	if err != nil {
+		return nil, false
+	}
+
+	klines, base, ok := s.storedKlines(pair, interval, start, now)
+	if !ok {
+		return nil, false
+	}
+	return s.storedKlineResponse(pair, interval, base, klines), true
+}
+
+// storedKlines returns the candles of a native interval opening in
+// [start, end] when the store covers them, end being at most now. Without
+// the interval itself it aggregates the largest lower interval the store
+// covers, so that e.g. 4h candles come from backfilled 1h ones; base names
+// that interval, and is empty when none was needed.
+func (s *MarketService) storedKlines(pair symbols.Pair, interval string, start, end int64) (klines []provider.Kline, base string, ok bool) {
+	if klines, ok := s.candles.Covered(pair, interval, start, end); ok {
+		return klines, "", true
+	}
+
+	target, err := candles.ParseInterval(interval)
+	if err != nil {
+		return nil, "", false
+	}
+	first := target.Open(start, time.UTC)
+	if first < start {
+		first = target.Shift(first, 1, time.UTC)
+	}
+	if first > end {
+		return nil, "", false
+	}
+	// The last candle needs its base candles up to its close, or up to now
+	// while it is still open
+	last := target.Open(end, time.UTC)
+	baseEnd := min(target.Shift(last, 1, time.UTC)-1, time.Now().UnixMilli())
+
+	targetStep, fixed := target.Step()
+	for _, name := range resampleBases {
+		step, _ := candles.Step(name)
+		if fixed && (step >= targetStep || targetStep%step != 0) {
+			continue
+		}
+		baseKlines, ok := s.candles.Covered(pair, name, first, baseEnd)
+		if !ok {
+			continue
+		}
+		return candles.Resample(baseKlines, target, time.UTC), name, true
+	}
+	return nil, "", false
+}
+
+func (s *MarketService) storedKlineResponse(pair symbols.Pair, interval, base string, klines []provider.Kline) *KlineResponse {
+	return &KlineResponse{
+		Symbol:       pair.String(),
+		VenueSymbols: s.venueSymbols(pair, provider.CapKlines),
+		Interval:     interval,
+		Klines:       klines,
+		Source:       SourceStore,
+		BaseInterval: base,
+		Freshness:    Freshness{FetchedAt: time.Now()},
+	}
+}
+
+// storeKlines writes closed candles through to the store in the background,
+// so the response does not wait for the disk. The open candle is left to the
+// backfill worker, which keeps refreshing it; a write-through copy would
+// otherwise be served stale for series nobody backfills.
+func (s *MarketService) storeKlines(pair symbols.Pair, interval string, klines []provider.Kline) {
+	if s.candles == nil {
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	closed := make([]provider.Kline, 0, len(klines))
+	for _, k := range klines {
+		if k.CloseTime < now {
+			closed = append(closed, k)
+		}
+	}
+	if len(closed) == 0 {
+		return
+	}
+
+	s.writes.Add(1)
+	go func() {
+		defer s.writes.Done()
+		if err := s.candles.Put(pair, interval, closed); err != nil {
+			log.Warn().Err(err).Stringer("symbol", pair).Str("interval", interval).Msg("Failed to write klines to candle store")
+		}
+	}()
+}
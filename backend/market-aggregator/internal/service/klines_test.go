@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/candles"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/patrickmn/go-cache"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func hourlyKlines(start int64, count int) []client.BinanceKline {
+	klines := make([]client.BinanceKline, count)
+	for i := range klines {
+		openTime := start + int64(i)*time.Hour.Milliseconds()
+		klines[i] = client.BinanceKline{OpenTime: openTime, CloseTime: openTime + time.Hour.Milliseconds() - 1, Close: dec("1")}
+	}
+	return klines
+}
+
+func TestMarketService_GetKlineRange_PagesThroughLimit(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+	service.klineConfig.PageSize = 2
+
+	hour := time.Hour.Milliseconds()
+	start := int64(1620000000000)
+	end := start + 4*hour
+	all := hourlyKlines(start, 5)
+
+	mockBinance.On("GetKlinesRange", "BTCUSDT", "1h", start, end, 2).Return(all[0:2], nil).Once()
+	mockBinance.On("GetKlinesRange", "BTCUSDT", "1h", start+hour+1, end, 2).Return(all[2:4], nil).Once()
+	mockBinance.On("GetKlinesRange", "BTCUSDT", "1h", start+3*hour+1, end, 2).Return(all[4:5], nil).Once()
+
+	// Act
+	result, err := service.GetKlineRange(context.Background(), btcusdt, "1h", start, end, 0)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, result.Klines, 5)
+	for i, k := range result.Klines {
+		assert.Equal(t, all[i].OpenTime, k.OpenTime)
+	}
+	mockBinance.AssertExpectations(t)
+}
+
+func TestMarketService_GetKlineRange_StopsAtLimit(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+	service.klineConfig.PageSize = 2
+
+	hour := time.Hour.Milliseconds()
+	start := int64(1620000000000)
+	end := start + 10*hour
+	all := hourlyKlines(start, 3)
+
+	mockBinance.On("GetKlinesRange", "BTCUSDT", "1h", start, end, 2).Return(all[0:2], nil).Once()
+	mockBinance.On("GetKlinesRange", "BTCUSDT", "1h", start+hour+1, end, 1).Return(all[2:3], nil).Once()
+
+	// Act
+	result, err := service.GetKlineRange(context.Background(), btcusdt, "1h", start, end, 3)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Len(t, result.Klines, 3)
+	mockBinance.AssertExpectations(t)
+}
+
+func TestMarketService_GetKlineRange_RejectsSpanOverMax(t *testing.T) {
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+	service.klineConfig.MaxSpan = 24 * time.Hour
+
+	start := int64(1620000000000)
+	result, err := service.GetKlineRange(context.Background(), btcusdt, "1h", start, start+(25*time.Hour).Milliseconds(), 0)
+
+	assert.ErrorIs(t, err, ErrRangeTooLarge)
+	assert.Nil(t, result)
+	mockBinance.AssertNotCalled(t, "GetKlinesRange")
+}
+
+type memoryCandleStore struct {
+	mu     sync.Mutex
+	klines []provider.Kline
+	puts   int
+	// interval, when set, is the only interval the store holds
+	interval string
+}
+
+func (m *memoryCandleStore) Covered(pair symbols.Pair, interval string, start, end int64) ([]provider.Kline, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.interval != "" && interval != m.interval {
+		return nil, false
+	}
+	var result []provider.Kline
+	for _, k := range m.klines {
+		if k.OpenTime >= start && k.OpenTime <= end {
+			result = append(result, k)
+		}
+	}
+	gaps, err := candles.FindGaps(interval, result, start, end)
+	return result, err == nil && len(gaps) == 0
+}
+
+func (m *memoryCandleStore) Put(pair symbols.Pair, interval string, klines []provider.Kline) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.puts++
+	m.klines = append(m.klines, klines...)
+	return nil
+}
+
+func TestMarketService_GetKlines_ServedFromCandleStore(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	current, _ := candles.OpenTime("1h", time.Now().UnixMilli())
+	store := &memoryCandleStore{}
+	for _, k := range hourlyKlines(current-2*time.Hour.Milliseconds(), 3) {
+		store.klines = append(store.klines, provider.Kline{OpenTime: k.OpenTime, CloseTime: k.CloseTime, Close: k.Close})
+	}
+	service.UseCandleStore(store)
+
+	// Act
+	result, err := service.GetKlines(context.Background(), btcusdt, "1h", 3)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, SourceStore, result.Source)
+	assert.Len(t, result.Klines, 3)
+	mockBinance.AssertNotCalled(t, "GetKlines", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMarketService_GetKlines_WritesClosedCandlesThrough(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+	store := &memoryCandleStore{}
+	service.UseCandleStore(store)
+
+	current, _ := candles.OpenTime("1h", time.Now().UnixMilli())
+	mockBinance.On("GetKlines", "BTCUSDT", "1h", 3).Return(hourlyKlines(current-2*time.Hour.Milliseconds(), 3), nil)
+
+	// Act
+	result, err := service.GetKlines(context.Background(), btcusdt, "1h", 3)
+	service.Close()
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "binance", result.Source)
+	assert.Len(t, store.klines, 2, "the open candle is left to the backfill worker")
+}
+
+func TestMarketService_GetKlineRange_ResamplesNonNativeInterval(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	day := (24 * time.Hour).Milliseconds()
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).UnixMilli() // an even day since the epoch
+	end := start + 4*day - 1
+	daily := make([]client.BinanceKline, 4)
+	for i := range daily {
+		openTime := start + int64(i)*day
+		daily[i] = client.BinanceKline{OpenTime: openTime, CloseTime: openTime + day - 1, Open: dec("1"), High: decimal.NewFromInt(int64(10 + i)), Low: dec("1"), Close: decimal.NewFromInt(int64(i)), Volume: dec("2.5")}
+	}
+	mockBinance.On("GetKlinesRange", "BTCUSDT", "1d", start, end, mock.Anything).Return(daily, nil).Once()
+
+	// Act
+	result, err := service.GetKlineRange(context.Background(), btcusdt, "2d", start, end, 0)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "2d", result.Interval)
+	assert.Equal(t, "1d", result.BaseInterval)
+	require.Len(t, result.Klines, 2)
+	assert.Equal(t, start, result.Klines[0].OpenTime)
+	assert.Equal(t, start+2*day-1, result.Klines[0].CloseTime)
+	assert.Equal(t, "11", result.Klines[0].High.String())
+	assert.Equal(t, "1", result.Klines[0].Close.String())
+	assert.Equal(t, "5", result.Klines[0].Volume.String())
+	mockBinance.AssertExpectations(t)
+}
+
+func TestMarketService_GetResampledKlines_PicksBaseAlignedToTimeZone(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	shanghai := time.FixedZone("+08:00", 8*3600)
+	kolkata := time.FixedZone("+05:30", 5*3600+30*60)
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, shanghai).UnixMilli()
+	end := start + (24 * time.Hour).Milliseconds() - 1
+
+	mockBinance.On("GetKlinesRange", "BTCUSDT", "8h", start, end, mock.Anything).Return(hourlyKlines(start, 0), nil).Once()
+
+	// Act
+	result, err := service.GetResampledKlines(context.Background(), btcusdt, "1d", shanghai, start, end, 0)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "8h", result.BaseInterval)
+	assert.Equal(t, "+08:00", result.TimeZone)
+	assert.Empty(t, result.Klines)
+	assert.Equal(t, "30m", resampleBase(candles.Interval{Count: 1, Unit: 'd'}, kolkata, start, end))
+	mockBinance.AssertExpectations(t)
+}
+
+func TestMarketService_GetResampledKlines_RejectsTooManyBaseCandles(t *testing.T) {
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+	service.klineConfig.MaxResampleCandles = 10
+
+	_, err := service.GetResampledKlines(context.Background(), btcusdt, "10m", time.UTC, 0, 0, 100)
+
+	assert.ErrorIs(t, err, ErrRangeTooLarge)
+	mockBinance.AssertNotCalled(t, "GetKlinesRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMarketService_GetKlineRange_CachesHistoryWithPolicy(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
+	service.cacheConfig.KlineHistory = CachePolicy{SoftTTL: 3 * time.Hour, HardTTL: 6 * time.Hour}
+
+	start := int64(1620000000000)
+	end := start + 2*time.Hour.Milliseconds() - 1
+	mockBinance.On("GetKlinesRange", "BTCUSDT", "1h", start, end, mock.Anything).Return(hourlyKlines(start, 2), nil).Once()
+
+	// Act
+	first, err := service.GetKlineRange(context.Background(), btcusdt, "1h", start, end, 0)
+	require.NoError(t, err)
+	second, err := service.GetKlineRange(context.Background(), btcusdt, "1h", start, end, 0)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	entry, ok := service.load(fmt.Sprintf("klines:%s:1h:%d:%d:0", btcusdt, start, end))
+	require.True(t, ok)
+	assert.WithinDuration(t, first.FetchedAt.Add(3*time.Hour), entry.softExpiry, time.Second)
+	mockBinance.AssertExpectations(t)
+}
+
+func TestMarketService_GetResampledKlines_RejectsSpanOverMax(t *testing.T) {
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+	service.klineConfig.MaxSpan = 24 * time.Hour
+
+	start := int64(1620000000000)
+	_, err := service.GetResampledKlines(context.Background(), btcusdt, "1d", time.FixedZone("+08:00", 8*3600), start, start+(48*time.Hour).Milliseconds(), 0)
+
+	assert.ErrorIs(t, err, ErrRangeTooLarge)
+	mockBinance.AssertNotCalled(t, "GetKlinesRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMarketService_GetKlines_ResamplesNativeIntervalFromStore(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	now := time.Now().UnixMilli()
+	current, _ := candles.OpenTime("4h", now)
+	start := current - (4 * time.Hour).Milliseconds()
+	currentHour, _ := candles.OpenTime("1h", now)
+	store := &memoryCandleStore{interval: "1h"}
+	for _, k := range hourlyKlines(start, int((currentHour-start)/time.Hour.Milliseconds())+1) {
+		store.klines = append(store.klines, provider.Kline{OpenTime: k.OpenTime, CloseTime: k.CloseTime, Close: k.Close})
+	}
+	service.UseCandleStore(store)
+
+	// Act
+	result, err := service.GetKlines(context.Background(), btcusdt, "4h", 2)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, SourceStore, result.Source)
+	assert.Equal(t, "1h", result.BaseInterval)
+	require.Len(t, result.Klines, 2)
+	assert.Equal(t, start, result.Klines[0].OpenTime)
+	assert.Equal(t, current, result.Klines[1].OpenTime)
+	mockBinance.AssertNotCalled(t, "GetKlines", mock.Anything, mock.Anything, mock.Anything)
+	mockBinance.AssertNotCalled(t, "GetKlinesRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -1,188 +1,423 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
-	"github.com/patrickmn/go-cache"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/candles"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
 	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
 )
 
 type MarketService struct {
-	binanceClient   *client.BinanceClient
-	coinGeckoClient *client.CoinGeckoClient
-	cache           *cache.Cache
+	providers   *provider.Registry
+	books       OrderBookSource
+	candles     CandleStore
+	symbols     SymbolSource
+	cache       Cache
+	indexConfig IndexConfig
+	// Cancelled by Close, ending upstream calls still in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Coalesces concurrent upstream fetches per cache key
+	flights flightGroup
+	hotKeys hotKeys
+	stop    chan struct{}
+	done    chan struct{}
+	// Candle store writes still in flight, waited for by Close
+	writes sync.WaitGroup
+
+	// Settings that may be replaced while serving
+	mu          sync.RWMutex
+	klineConfig KlineRangeConfig
+	cacheConfig CacheConfig
+	timeouts    TimeoutConfig
+	precisions  map[symbols.Pair]Precision
+}
+
+// OrderBookSource serves locally maintained order books. ok is false when
+// the pair is not tracked or its book is not currently in sync.
+type OrderBookSource interface {
+	Depth(pair symbols.Pair, limit int) (depth *provider.Depth, ok bool)
+}
+
+// SymbolSource supplies the trading rules of listed symbols.
+type SymbolSource interface {
+	Lookup(pair symbols.Pair) (symbols.Symbol, bool)
 }
 
+// Responses report the canonical symbol, e.g. BTC-USDT; VenueSymbols spells
+// the pair for each venue that can serve it.
 type TickerResponse struct {
-	Symbol     string    `json:"symbol"`
-	Price      string    `json:"price"`
-	Change24h  string    `json:"change24h"`
-	Volume24h  string    `json:"volume24h"`
-	High24h    string    `json:"high24h"`
-	Low24h     string    `json:"low24h"`
-	Source     string    `json:"source"`
-	Timestamp  time.Time `json:"timestamp"`
-	LastUpdate time.Time `json:"last_update"`
+	Symbol       string            `json:"symbol"`
+	VenueSymbols map[string]string `json:"venueSymbols"`
+	Price        decimal.Decimal   `json:"price"`
+	Change24h    OptionalDecimal   `json:"change24h"`
+	Volume24h    OptionalDecimal   `json:"volume24h"`
+	High24h      OptionalDecimal   `json:"high24h"`
+	Low24h       OptionalDecimal   `json:"low24h"`
+	MarketCap    OptionalDecimal   `json:"marketCap"`
+	Source       string            `json:"source"`
+	Timestamp    time.Time         `json:"timestamp"`
+	LastUpdate   time.Time         `json:"last_update"`
+	Freshness
 }
 
 type KlineResponse struct {
-	Symbol   string     `json:"symbol"`
-	Interval string     `json:"interval"`
-	Klines   [][]string `json:"klines"`
-	Source   string     `json:"source"`
+	Symbol       string            `json:"symbol"`
+	VenueSymbols map[string]string `json:"venueSymbols"`
+	Interval     string            `json:"interval"`
+	Klines       []provider.Kline  `json:"klines"`
+	Source       string            `json:"source"`
+	// Set when the klines were aggregated from a lower interval
+	BaseInterval string `json:"baseInterval,omitempty"`
+	TimeZone     string `json:"timeZone,omitempty"`
+	Freshness
+}
+
+// LegacyKlineResponse is the original array-of-strings format:
+// [openTime, open, high, low, close, volume].
+type LegacyKlineResponse struct {
+	Symbol       string            `json:"symbol"`
+	VenueSymbols map[string]string `json:"venueSymbols"`
+	Interval     string            `json:"interval"`
+	Klines       [][]string        `json:"klines"`
+	Source       string            `json:"source"`
 }
 
 type DepthResponse struct {
-	Symbol    string     `json:"symbol"`
-	Bids      [][]string `json:"bids"`
-	Asks      [][]string `json:"asks"`
-	Source    string     `json:"source"`
-	Timestamp time.Time  `json:"timestamp"`
+	Symbol       string            `json:"symbol"`
+	VenueSymbols map[string]string `json:"venueSymbols"`
+	Bids         []provider.Level  `json:"bids"`
+	Asks         []provider.Level  `json:"asks"`
+	Source       string            `json:"source"`
+	Timestamp    time.Time         `json:"timestamp"`
+	Freshness
+}
+
+// nativeIntervals are served by the kline providers directly
+var nativeIntervals = map[string]bool{
+	"1m": true, "3m": true, "5m": true, "15m": true, "30m": true,
+	"1h": true, "2h": true, "4h": true, "6h": true, "8h": true, "12h": true,
+	"1d": true, "3d": true, "1w": true, "1M": true,
 }
 
-func NewMarketService(binanceClient *client.BinanceClient, coinGeckoClient *client.CoinGeckoClient, cache *cache.Cache) *MarketService {
+// IsNativeInterval reports whether providers serve interval without resampling.
+func IsNativeInterval(interval string) bool {
+	return nativeIntervals[interval]
+}
+
+// IsValidInterval reports whether interval is a supported kline interval,
+// either native or resampled from a native one.
+func IsValidInterval(interval string) bool {
+	_, err := candles.ParseInterval(interval)
+	return err == nil
+}
+
+func NewMarketService(providers *provider.Registry, cache Cache) *MarketService {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &MarketService{
-		binanceClient:   binanceClient,
-		coinGeckoClient: coinGeckoClient,
-		cache:           cache,
+		providers:   providers,
+		cache:       cache,
+		indexConfig: DefaultIndexConfig(),
+		klineConfig: DefaultKlineRangeConfig(),
+		cacheConfig: DefaultCacheConfig(),
+		timeouts:    DefaultTimeoutConfig(),
+		ctx:         ctx,
+		cancel:      cancel,
+		precisions:  make(map[symbols.Pair]Precision),
 	}
 }
 
-func (s *MarketService) GetTicker(symbol string) (*TickerResponse, error) {
-	cacheKey := fmt.Sprintf("ticker:%s", symbol)
+// CandleStore persists candles locally. Covered only succeeds when every
+// candle in the range is present.
+type CandleStore interface {
+	Covered(pair symbols.Pair, interval string, start, end int64) ([]provider.Kline, bool)
+	Put(pair symbols.Pair, interval string, klines []provider.Kline) error
+}
 
-	// Try cache first
-	if cached, found := s.cache.Get(cacheKey); found {
-		if ticker, ok := cached.(*TickerResponse); ok {
-			log.Debug().Str("symbol", symbol).Msg("Ticker served from cache")
-			return ticker, nil
-		}
+// UseCandleStore makes GetKlines and GetKlineRange serve from the store when
+// it covers the request, and write upstream results through to it.
+func (s *MarketService) UseCandleStore(store CandleStore) {
+	s.candles = store
+}
+
+// UseOrderBooks makes GetDepth serve tracked symbols from local books
+// instead of REST snapshots.
+func (s *MarketService) UseOrderBooks(books OrderBookSource) {
+	s.books = books
+}
+
+// UseSymbols derives each listed symbol's output precision from its tick
+// and lot sizes, unless one was set with SetPrecision.
+func (s *MarketService) UseSymbols(symbols SymbolSource) {
+	s.symbols = symbols
+}
+
+func (s *MarketService) GetTicker(ctx context.Context, pair symbols.Pair) (*TickerResponse, error) {
+	ctx, span := startSpan(ctx, "MarketService.GetTicker", pair)
+	defer span.End()
+
+	cacheKey := fmt.Sprintf("ticker:%s", pair)
+
+	cached, stale, err := s.cached(ctx, cacheKey, s.bounded(s.timeoutSettings().Ticker, func(ctx context.Context) (interface{}, error) {
+		return s.fetchTicker(ctx, pair)
+	}))
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	ticker := cached.(*TickerResponse)
+	if stale {
+		staleTicker := *ticker
+		staleTicker.Stale = true
+		return &staleTicker, nil
 	}
+	return ticker, nil
+}
 
-	// Try Binance first
-	binanceData, err := s.binanceClient.Get24hrTicker(symbol)
-	if err == nil {
-		ticker := &TickerResponse{
-			Symbol:     binanceData.Symbol,
-			Price:      binanceData.LastPrice,
-			Change24h:  binanceData.PriceChangePercent,
-			Volume24h:  binanceData.Volume,
-			High24h:    binanceData.HighPrice,
-			Low24h:     binanceData.LowPrice,
-			Source:     "binance",
-			Timestamp:  time.Now(),
-			LastUpdate: time.Unix(binanceData.CloseTime/1000, 0),
+func (s *MarketService) fetchTicker(ctx context.Context, pair symbols.Pair) (*TickerResponse, error) {
+	// Try providers in priority and health order, later ones act as fallbacks
+	var errs []string
+	primary := s.providers.Primary(provider.CapTicker)
+	for _, p := range s.providers.Providers(provider.CapTicker) {
+		data, err := p.GetTicker(ctx, pair)
+		if err != nil {
+			log.Warn().Err(err).Stringer("symbol", pair).Str("source", p.Name()).Msg("Ticker provider failed, trying next")
+			errs = append(errs, fmt.Sprintf("%s=%v", p.Name(), err))
+			if ctx.Err() != nil {
+				// Out of time; later providers would fail the same way
+				break
+			}
+			continue
 		}
 
-		// Cache the result
-		s.cache.Set(cacheKey, ticker, cache.DefaultExpiration)
-		log.Info().Str("symbol", symbol).Str("source", "binance").Msg("Ticker fetched successfully")
+		ticker := s.cacheTicker(pair, p, p.Name() == primary, data)
+		if p.Name() == primary {
+			log.Info().Stringer("symbol", pair).Str("source", p.Name()).Msg("Ticker fetched successfully")
+		} else {
+			log.Info().Stringer("symbol", pair).Str("source", p.Name()).Msg("Ticker fetched from fallback")
+		}
 		return ticker, nil
 	}
 
-	log.Warn().Err(err).Str("symbol", symbol).Msg("Binance API failed, trying CoinGecko fallback")
+	log.Error().Stringer("symbol", pair).Msg("All ticker providers failed")
+	return nil, fmt.Errorf("failed to fetch ticker data: %s", joinErrors(errs))
+}
 
-	// Fallback to CoinGecko (price only)
-	coinGeckoData, cgErr := s.coinGeckoClient.GetPrice(symbol)
-	if cgErr != nil {
-		log.Error().Err(cgErr).Str("symbol", symbol).Msg("Both Binance and CoinGecko failed")
-		return nil, fmt.Errorf("failed to fetch ticker data: binance=%v, coingecko=%v", err, cgErr)
+// cacheTicker builds the response for a ticker fetched from p and caches it.
+func (s *MarketService) cacheTicker(pair symbols.Pair, p provider.Provider, primary bool, data *provider.Ticker) *TickerResponse {
+	precision := s.precision(pair)
+	ticker := &TickerResponse{
+		Symbol:       pair.String(),
+		VenueSymbols: s.venueSymbols(pair, provider.CapTicker),
+		Price:        precision.price(data.Price),
+		Change24h:    OptionalDecimal{data.Change24h},
+		Volume24h:    precision.optional(data.Volume24h, precision.quantity),
+		High24h:      precision.optional(data.High24h, precision.price),
+		Low24h:       precision.optional(data.Low24h, precision.price),
+		MarketCap:    OptionalDecimal{data.MarketCap},
+		Source:       p.Name(),
+		Timestamp:    time.Now(),
+		LastUpdate:   data.LastUpdate,
 	}
+	ticker.FetchedAt = ticker.Timestamp
 
-	ticker := &TickerResponse{
-		Symbol:     symbol,
-		Price:      fmt.Sprintf("%.2f", coinGeckoData.USD),
-		Change24h:  "N/A",
-		Volume24h:  "N/A",
-		High24h:    "N/A",
-		Low24h:     "N/A",
-		Source:     "coingecko_fallback",
-		Timestamp:  time.Now(),
-		LastUpdate: time.Now(),
+	cacheKey := fmt.Sprintf("ticker:%s", pair)
+	if primary {
+		s.store(cacheKey, ticker, ticker.FetchedAt, s.cacheSettings().Ticker)
+		return ticker
 	}
 
 	// Cache the result with shorter TTL for fallback data
-	s.cache.Set(cacheKey, ticker, 10*time.Second)
-	log.Info().Str("symbol", symbol).Str("source", "coingecko").Msg("Ticker fetched from fallback")
-	return ticker, nil
+	tickerFallbacks.WithLabelValues(p.Name()).Inc()
+	ticker.Source = p.Name() + "_fallback"
+	s.store(cacheKey, ticker, ticker.FetchedAt, s.cacheSettings().FallbackTicker)
+	return ticker
 }
 
-func (s *MarketService) GetKlines(symbol, interval string, limit int) (*KlineResponse, error) {
-	cacheKey := fmt.Sprintf("klines:%s:%s:%d", symbol, interval, limit)
-
-	// Try cache first
-	if cached, found := s.cache.Get(cacheKey); found {
-		if klines, ok := cached.(*KlineResponse); ok {
-			log.Debug().Str("symbol", symbol).Str("interval", interval).Msg("Klines served from cache")
-			return klines, nil
-		}
+func (s *MarketService) GetKlines(ctx context.Context, pair symbols.Pair, interval string, limit int) (*KlineResponse, error) {
+	if !IsNativeInterval(interval) {
+		return s.GetResampledKlines(ctx, pair, interval, time.UTC, 0, 0, limit)
 	}
 
-	// Only Binance supports klines
-	binanceKlines, err := s.binanceClient.GetKlines(symbol, interval, limit)
+	ctx, span := startSpan(ctx, "MarketService.GetKlines", pair)
+	defer span.End()
+
+	cacheKey := fmt.Sprintf("klines:%s:%s:%d", pair, interval, limit)
+
+	cached, stale, err := s.cached(ctx, cacheKey, s.bounded(s.timeoutSettings().Klines, func(ctx context.Context) (interface{}, error) {
+		return s.fetchKlines(ctx, pair, interval, limit, cacheKey)
+	}))
 	if err != nil {
-		log.Error().Err(err).Str("symbol", symbol).Str("interval", interval).Msg("Failed to fetch klines")
-		return nil, fmt.Errorf("failed to fetch klines: %v", err)
-	}
-
-	// Convert binance klines to string format
-	var klines [][]string
-	for _, k := range binanceKlines {
-		kline := []string{
-			strconv.FormatInt(k[0].(int64), 10), // Open time
-			k[1].(string),                       // Open
-			k[2].(string),                       // High
-			k[3].(string),                       // Low
-			k[4].(string),                       // Close
-			k[5].(string),                       // Volume
-		}
-		klines = append(klines, kline)
+		return nil, spanError(span, err)
+	}
+	klines := cached.(*KlineResponse)
+	if stale {
+		staleKlines := *klines
+		staleKlines.Stale = true
+		return &staleKlines, nil
 	}
+	return klines, nil
+}
 
-	response := &KlineResponse{
-		Symbol:   symbol,
-		Interval: interval,
-		Klines:   klines,
-		Source:   "binance",
+func (s *MarketService) fetchKlines(ctx context.Context, pair symbols.Pair, interval string, limit int, cacheKey string) (*KlineResponse, error) {
+	// Then the local store, which is kept current by the backfill worker
+	if response, ok := s.latestStoredKlines(pair, interval, limit); ok {
+		response.Klines = s.precision(pair).klines(response.Klines)
+		s.store(cacheKey, response, response.FetchedAt, s.cacheSettings().Klines)
+		log.Debug().Stringer("symbol", pair).Str("interval", interval).Msg("Klines served from candle store")
+		return response, nil
 	}
 
-	// Cache with longer TTL for klines
-	s.cache.Set(cacheKey, response, 1*time.Minute)
-	log.Info().Str("symbol", symbol).Str("interval", interval).Int("count", len(klines)).Msg("Klines fetched successfully")
-	return response, nil
+	var errs []string
+	for _, p := range s.providers.Providers(provider.CapKlines) {
+		klines, err := p.GetKlines(ctx, provider.KlineQuery{Pair: pair, Interval: interval, Limit: limit})
+		if err != nil {
+			log.Warn().Err(err).Stringer("symbol", pair).Str("interval", interval).Str("source", p.Name()).Msg("Klines provider failed")
+			errs = append(errs, fmt.Sprintf("%s=%v", p.Name(), err))
+			if ctx.Err() != nil {
+				// Out of time; later providers would fail the same way
+				break
+			}
+			continue
+		}
+		s.storeKlines(pair, interval, klines)
+
+		response := &KlineResponse{
+			Symbol:       pair.String(),
+			VenueSymbols: s.venueSymbols(pair, provider.CapKlines),
+			Interval:     interval,
+			Klines:       s.precision(pair).klines(klines),
+			Source:       p.Name(),
+		}
+		response.FetchedAt = time.Now()
+
+		// Cache with longer TTL for klines
+		s.store(cacheKey, response, response.FetchedAt, s.cacheSettings().Klines)
+		log.Info().Stringer("symbol", pair).Str("interval", interval).Int("count", len(klines)).Msg("Klines fetched successfully")
+		return response, nil
+	}
+
+	log.Error().Stringer("symbol", pair).Str("interval", interval).Msg("Failed to fetch klines")
+	return nil, fmt.Errorf("failed to fetch klines: %s", joinErrors(errs))
 }
 
-func (s *MarketService) GetDepth(symbol string, limit int) (*DepthResponse, error) {
-	cacheKey := fmt.Sprintf("depth:%s:%d", symbol, limit)
+func (s *MarketService) GetDepth(ctx context.Context, pair symbols.Pair, limit int) (*DepthResponse, error) {
+	ctx, span := startSpan(ctx, "MarketService.GetDepth", pair)
+	defer span.End()
 
-	// Try cache first (shorter cache for depth data)
-	if cached, found := s.cache.Get(cacheKey); found {
-		if depth, ok := cached.(*DepthResponse); ok {
-			log.Debug().Str("symbol", symbol).Msg("Depth served from cache")
-			return depth, nil
+	// Local books are served only while their stream is live, so they
+	// bypass the cache
+	if s.books != nil {
+		if depth, ok := s.books.Depth(pair, limit); ok {
+			log.Debug().Stringer("symbol", pair).Msg("Depth served from local order book")
+			precision := s.precision(pair)
+			return &DepthResponse{
+				Symbol:       pair.String(),
+				VenueSymbols: s.venueSymbols(pair, provider.CapDepth),
+				Bids:         precision.levels(depth.Bids),
+				Asks:         precision.levels(depth.Asks),
+				Source:       provider.BinanceName,
+				Timestamp:    time.Now(),
+				Freshness:    Freshness{FetchedAt: depth.UpdatedAt},
+			}, nil
 		}
 	}
 
-	// Only Binance supports depth
-	binanceDepth, err := s.binanceClient.GetDepth(symbol, limit)
+	cacheKey := fmt.Sprintf("depth:%s:%d", pair, limit)
+
+	cached, stale, err := s.cached(ctx, cacheKey, s.bounded(s.timeoutSettings().Depth, func(ctx context.Context) (interface{}, error) {
+		return s.fetchDepth(ctx, pair, limit, cacheKey)
+	}))
 	if err != nil {
-		log.Error().Err(err).Str("symbol", symbol).Msg("Failed to fetch depth")
-		return nil, fmt.Errorf("failed to fetch depth: %v", err)
+		return nil, spanError(span, err)
 	}
+	depth := cached.(*DepthResponse)
+	if stale {
+		staleDepth := *depth
+		staleDepth.Stale = true
+		return &staleDepth, nil
+	}
+	return depth, nil
+}
+
+func (s *MarketService) fetchDepth(ctx context.Context, pair symbols.Pair, limit int, cacheKey string) (*DepthResponse, error) {
+	var errs []string
+	for _, p := range s.providers.Providers(provider.CapDepth) {
+		depth, err := p.GetDepth(ctx, pair, limit)
+		if err != nil {
+			log.Warn().Err(err).Stringer("symbol", pair).Str("source", p.Name()).Msg("Depth provider failed")
+			errs = append(errs, fmt.Sprintf("%s=%v", p.Name(), err))
+			if ctx.Err() != nil {
+				// Out of time; later providers would fail the same way
+				break
+			}
+			continue
+		}
 
-	response := &DepthResponse{
-		Symbol:    symbol,
-		Bids:      binanceDepth.Bids,
-		Asks:      binanceDepth.Asks,
-		Source:    "binance",
-		Timestamp: time.Now(),
+		precision := s.precision(pair)
+		response := &DepthResponse{
+			Symbol:       pair.String(),
+			VenueSymbols: s.venueSymbols(pair, provider.CapDepth),
+			Bids:         precision.levels(depth.Bids),
+			Asks:         precision.levels(depth.Asks),
+			Source:       p.Name(),
+			Timestamp:    time.Now(),
+		}
+		response.FetchedAt = response.Timestamp
+
+		// Cache with very short TTL for depth
+		s.store(cacheKey, response, response.FetchedAt, s.cacheSettings().Depth)
+		log.Info().Stringer("symbol", pair).Int("bids", len(response.Bids)).Int("asks", len(response.Asks)).Msg("Depth fetched successfully")
+		return response, nil
+	}
+
+	log.Error().Stringer("symbol", pair).Msg("Failed to fetch depth")
+	return nil, fmt.Errorf("failed to fetch depth: %s", joinErrors(errs))
+}
+
+// Legacy converts the response to the array-of-strings format.
+func (r *KlineResponse) Legacy() *LegacyKlineResponse {
+	klines := make([][]string, len(r.Klines))
+	for i, k := range r.Klines {
+		klines[i] = []string{strconv.FormatInt(k.OpenTime, 10), k.Open.String(), k.High.String(), k.Low.String(), k.Close.String(), k.Volume.String()}
+	}
+
+	return &LegacyKlineResponse{
+		Symbol:       r.Symbol,
+		VenueSymbols: r.VenueSymbols,
+		Interval:     r.Interval,
+		Klines:       klines,
+		Source:       r.Source,
 	}
+}
+
+// VenueSymbols spells pair for every configured provider.
+func (s *MarketService) VenueSymbols(pair symbols.Pair) map[string]string {
+	return s.venueSymbols(pair, 0)
+}
+
+// venueSymbols spells pair for every provider with capability; a zero
+// capability matches them all.
+func (s *MarketService) venueSymbols(pair symbols.Pair, capability provider.Capability) map[string]string {
+	result := make(map[string]string)
+	for _, p := range s.providers.Providers(capability) {
+		if symbol, err := p.Symbol(pair); err == nil {
+			result[p.Name()] = symbol
+		}
+	}
+	return result
+}
 
-	// Cache with very short TTL for depth (5 seconds)
-	s.cache.Set(cacheKey, response, 5*time.Second)
-	log.Info().Str("symbol", symbol).Int("bids", len(response.Bids)).Int("asks", len(response.Asks)).Msg("Depth fetched successfully")
-	return response, nil
+func joinErrors(errs []string) string {
+	if len(errs) == 0 {
+		return "no provider available"
+	}
+	return strings.Join(errs, ", ")
 }
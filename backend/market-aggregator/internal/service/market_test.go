@@ -1,22 +1,32 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
 
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
 	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
 	"github.com/patrickmn/go-cache"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+var (
+	dec     = decimal.RequireFromString
+	btcusdt = symbols.Pair{Base: "BTC", Quote: "USDT"}
+)
+
 // Mock clients for testing
 type MockBinanceClient struct {
 	mock.Mock
 }
 
-func (m *MockBinanceClient) Get24hrTicker(symbol string) (*client.BinanceTicker, error) {
+func (m *MockBinanceClient) Get24hrTicker(ctx context.Context, symbol string) (*client.BinanceTicker, error) {
 	args := m.Called(symbol)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -24,15 +34,31 @@ func (m *MockBinanceClient) Get24hrTicker(symbol string) (*client.BinanceTicker,
 	return args.Get(0).(*client.BinanceTicker), args.Error(1)
 }
 
-func (m *MockBinanceClient) GetKlines(symbol, interval string, limit int) ([][]interface{}, error) {
+func (m *MockBinanceClient) Get24hrTickers(ctx context.Context, symbols []string) ([]client.BinanceTicker, error) {
+	args := m.Called(symbols)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]client.BinanceTicker), args.Error(1)
+}
+
+func (m *MockBinanceClient) GetKlines(ctx context.Context, symbol, interval string, limit int) ([]client.BinanceKline, error) {
 	args := m.Called(symbol, interval, limit)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([][]interface{}), args.Error(1)
+	return args.Get(0).([]client.BinanceKline), args.Error(1)
+}
+
+func (m *MockBinanceClient) GetKlinesRange(ctx context.Context, symbol, interval string, startTime, endTime int64, limit int) ([]client.BinanceKline, error) {
+	args := m.Called(symbol, interval, startTime, endTime, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]client.BinanceKline), args.Error(1)
 }
 
-func (m *MockBinanceClient) GetDepth(symbol string, limit int) (*client.BinanceDepth, error) {
+func (m *MockBinanceClient) GetDepth(ctx context.Context, symbol string, limit int) (*client.BinanceDepth, error) {
 	args := m.Called(symbol, limit)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -44,12 +70,25 @@ type MockCoinGeckoClient struct {
 	mock.Mock
 }
 
-func (m *MockCoinGeckoClient) GetPrice(symbol string) (*client.CoinGeckoPrice, error) {
-	args := m.Called(symbol)
+func (m *MockCoinGeckoClient) GetMarket(ctx context.Context, coinID, vsCurrency string) (*client.CoinGeckoMarket, error) {
+	args := m.Called(coinID, vsCurrency)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*client.CoinGeckoMarket), args.Error(1)
+}
+
+func (m *MockCoinGeckoClient) GetMarkets(ctx context.Context, coinIDs []string, vsCurrency string) ([]client.CoinGeckoMarket, error) {
+	args := m.Called(coinIDs, vsCurrency)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*client.CoinGeckoPrice), args.Error(1)
+	return args.Get(0).([]client.CoinGeckoMarket), args.Error(1)
+}
+
+func newTestService(binance *MockBinanceClient, coinGecko *MockCoinGeckoClient, cacheInstance *cache.Cache) *MarketService {
+	registry := provider.NewRegistry(provider.NewBinance(binance), provider.NewCoinGecko(coinGecko))
+	return NewMarketService(registry, cacheInstance)
 }
 
 func TestMarketService_GetTicker_Success(t *testing.T) {
@@ -58,34 +97,31 @@ func TestMarketService_GetTicker_Success(t *testing.T) {
 	mockCoinGecko := new(MockCoinGeckoClient)
 	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
 
-	service := &MarketService{
-		binanceClient:   mockBinance,
-		coinGeckoClient: mockCoinGecko,
-		cache:           cacheInstance,
-	}
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
 
 	expectedBinanceTicker := &client.BinanceTicker{
 		Symbol:             "BTCUSDT",
-		LastPrice:          "26543.21",
-		PriceChangePercent: "2.45",
-		Volume:             "45123.67",
-		HighPrice:          "27100.00",
-		LowPrice:           "26200.00",
+		LastPrice:          dec("26543.21"),
+		PriceChangePercent: dec("2.45"),
+		Volume:             dec("45123.67"),
+		HighPrice:          dec("27100.00"),
+		LowPrice:           dec("26200.00"),
 		CloseTime:          time.Now().Unix() * 1000,
 	}
 
 	mockBinance.On("Get24hrTicker", "BTCUSDT").Return(expectedBinanceTicker, nil)
 
 	// Act
-	result, err := service.GetTicker("BTCUSDT")
+	result, err := service.GetTicker(context.Background(), btcusdt)
 
 	// Assert
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
-	assert.Equal(t, "BTCUSDT", result.Symbol)
-	assert.Equal(t, "26543.21", result.Price)
-	assert.Equal(t, "2.45", result.Change24h)
+	assert.Equal(t, "BTC-USDT", result.Symbol)
+	assert.Equal(t, "26543.21", result.Price.String())
+	assert.Equal(t, "2.45", result.Change24h.Decimal.String())
 	assert.Equal(t, "binance", result.Source)
+	assert.Equal(t, map[string]string{"binance": "BTCUSDT", "coingecko": "bitcoin/usd"}, result.VenueSymbols)
 
 	mockBinance.AssertExpectations(t)
 }
@@ -96,30 +132,39 @@ func TestMarketService_GetTicker_BinanceFailure_FallbackToCoinGecko(t *testing.T
 	mockCoinGecko := new(MockCoinGeckoClient)
 	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
 
-	service := &MarketService{
-		binanceClient:   mockBinance,
-		coinGeckoClient: mockCoinGecko,
-		cache:           cacheInstance,
-	}
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
 
-	expectedCoinGeckoPrice := &client.CoinGeckoPrice{
-		USD: 26543.21,
+	expectedCoinGeckoMarket := &client.CoinGeckoMarket{
+		ID:                       "bitcoin",
+		CurrentPrice:             dec("26543.21"),
+		MarketCap:                decimal.NewNullDecimal(dec("517000000000")),
+		TotalVolume:              decimal.NewNullDecimal(dec("265432100")),
+		High24h:                  decimal.NewNullDecimal(dec("27100")),
+		PriceChangePercentage24h: decimal.NewNullDecimal(dec("-1.25")),
 	}
 
 	mockBinance.On("Get24hrTicker", "BTCUSDT").Return(nil, errors.New("API error"))
-	mockCoinGecko.On("GetPrice", "BTCUSDT").Return(expectedCoinGeckoPrice, nil)
+	mockCoinGecko.On("GetMarket", "bitcoin", "usd").Return(expectedCoinGeckoMarket, nil)
 
 	// Act
-	result, err := service.GetTicker("BTCUSDT")
+	result, err := service.GetTicker(context.Background(), btcusdt)
 
 	// Assert
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
-	assert.Equal(t, "BTCUSDT", result.Symbol)
-	assert.Equal(t, "26543.21", result.Price)
-	assert.Equal(t, "N/A", result.Change24h)
+	assert.Equal(t, "BTC-USDT", result.Symbol)
+	assert.Equal(t, "26543.21", result.Price.String())
+	assert.Equal(t, "-1.25", result.Change24h.Decimal.String())
+	assert.Equal(t, "10000", result.Volume24h.Decimal.String())
+	assert.Equal(t, "27100", result.High24h.Decimal.String())
+	assert.Equal(t, "517000000000", result.MarketCap.Decimal.String())
 	assert.Equal(t, "coingecko_fallback", result.Source)
 
+	// CoinGecko had no 24h low, which is published as null
+	body, err := json.Marshal(result)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"low24h":null`)
+
 	mockBinance.AssertExpectations(t)
 	mockCoinGecko.AssertExpectations(t)
 }
@@ -130,17 +175,13 @@ func TestMarketService_GetTicker_BothAPIsFail(t *testing.T) {
 	mockCoinGecko := new(MockCoinGeckoClient)
 	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
 
-	service := &MarketService{
-		binanceClient:   mockBinance,
-		coinGeckoClient: mockCoinGecko,
-		cache:           cacheInstance,
-	}
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
 
 	mockBinance.On("Get24hrTicker", "BTCUSDT").Return(nil, errors.New("Binance API error"))
-	mockCoinGecko.On("GetPrice", "BTCUSDT").Return(nil, errors.New("CoinGecko API error"))
+	mockCoinGecko.On("GetMarket", "bitcoin", "usd").Return(nil, errors.New("CoinGecko API error"))
 
 	// Act
-	result, err := service.GetTicker("BTCUSDT")
+	result, err := service.GetTicker(context.Background(), btcusdt)
 
 	// Assert
 	assert.Error(t, err)
@@ -157,24 +198,20 @@ func TestMarketService_GetTicker_CacheHit(t *testing.T) {
 	mockCoinGecko := new(MockCoinGeckoClient)
 	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
 
-	service := &MarketService{
-		binanceClient:   mockBinance,
-		coinGeckoClient: mockCoinGecko,
-		cache:           cacheInstance,
-	}
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
 
 	// Set up cache
 	cachedTicker := &TickerResponse{
-		Symbol:    "BTCUSDT",
-		Price:     "26543.21",
-		Change24h: "2.45",
+		Symbol:    "BTC-USDT",
+		Price:     dec("26543.21"),
+		Change24h: OptionalDecimal{decimal.NewNullDecimal(dec("2.45"))},
 		Source:    "binance",
 		Timestamp: time.Now(),
 	}
-	cacheInstance.Set("ticker:BTCUSDT", cachedTicker, cache.DefaultExpiration)
+	service.store("ticker:BTC-USDT", cachedTicker, cachedTicker.Timestamp, DefaultCacheConfig().Ticker)
 
 	// Act
-	result, err := service.GetTicker("BTCUSDT")
+	result, err := service.GetTicker(context.Background(), btcusdt)
 
 	// Assert
 	assert.NoError(t, err)
@@ -183,7 +220,7 @@ func TestMarketService_GetTicker_CacheHit(t *testing.T) {
 
 	// Verify no API calls were made
 	mockBinance.AssertNotCalled(t, "Get24hrTicker")
-	mockCoinGecko.AssertNotCalled(t, "GetPrice")
+	mockCoinGecko.AssertNotCalled(t, "GetMarket")
 }
 
 func TestMarketService_GetKlines_Success(t *testing.T) {
@@ -192,29 +229,33 @@ func TestMarketService_GetKlines_Success(t *testing.T) {
 	mockCoinGecko := new(MockCoinGeckoClient)
 	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
 
-	service := &MarketService{
-		binanceClient:   mockBinance,
-		coinGeckoClient: mockCoinGecko,
-		cache:           cacheInstance,
-	}
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
 
-	expectedKlines := [][]interface{}{
-		{int64(1620000000000), "50000.00", "51000.00", "49000.00", "50500.00", "100.5"},
-		{int64(1620003600000), "50500.00", "51500.00", "50000.00", "51000.00", "150.2"},
+	expectedKlines := []client.BinanceKline{
+		{OpenTime: 1620000000000, Open: dec("50000.00"), High: dec("51000.00"), Low: dec("49000.00"), Close: dec("50500.00"), Volume: dec("100.5"),
+			CloseTime: 1620003599999, QuoteAssetVolume: dec("5050000.00"), NumberOfTrades: 1200},
+		{OpenTime: 1620003600000, Open: dec("50500.00"), High: dec("51500.00"), Low: dec("50000.00"), Close: dec("51000.00"), Volume: dec("150.2"),
+			CloseTime: 1620007199999, QuoteAssetVolume: dec("7660200.00"), NumberOfTrades: 1500},
 	}
 
 	mockBinance.On("GetKlines", "BTCUSDT", "1h", 100).Return(expectedKlines, nil)
 
 	// Act
-	result, err := service.GetKlines("BTCUSDT", "1h", 100)
+	result, err := service.GetKlines(context.Background(), btcusdt, "1h", 100)
 
 	// Assert
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
-	assert.Equal(t, "BTCUSDT", result.Symbol)
+	assert.Equal(t, "BTC-USDT", result.Symbol)
 	assert.Equal(t, "1h", result.Interval)
 	assert.Equal(t, "binance", result.Source)
 	assert.Len(t, result.Klines, 2)
+	assert.Equal(t, int64(1620003599999), result.Klines[0].CloseTime)
+	assert.Equal(t, "5050000", result.Klines[0].QuoteVolume.String())
+	assert.Equal(t, int64(1200), result.Klines[0].Trades)
+
+	legacy := result.Legacy()
+	assert.Equal(t, []string{"1620000000000", "50000", "51000", "49000", "50500", "100.5"}, legacy.Klines[0])
 
 	mockBinance.AssertExpectations(t)
 }
@@ -225,16 +266,12 @@ func TestMarketService_GetKlines_Failure(t *testing.T) {
 	mockCoinGecko := new(MockCoinGeckoClient)
 	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
 
-	service := &MarketService{
-		binanceClient:   mockBinance,
-		coinGeckoClient: mockCoinGecko,
-		cache:           cacheInstance,
-	}
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
 
 	mockBinance.On("GetKlines", "BTCUSDT", "1h", 100).Return(nil, errors.New("API error"))
 
 	// Act
-	result, err := service.GetKlines("BTCUSDT", "1h", 100)
+	result, err := service.GetKlines(context.Background(), btcusdt, "1h", 100)
 
 	// Assert
 	assert.Error(t, err)
@@ -250,33 +287,29 @@ func TestMarketService_GetDepth_Success(t *testing.T) {
 	mockCoinGecko := new(MockCoinGeckoClient)
 	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
 
-	service := &MarketService{
-		binanceClient:   mockBinance,
-		coinGeckoClient: mockCoinGecko,
-		cache:           cacheInstance,
-	}
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
 
 	expectedDepth := &client.BinanceDepth{
 		LastUpdateId: 123456789,
-		Bids: [][]string{
-			{"50000.00", "1.5"},
-			{"49999.00", "2.0"},
+		Bids: []client.BinanceLevel{
+			{dec("50000.00"), dec("1.5")},
+			{dec("49999.00"), dec("2.0")},
 		},
-		Asks: [][]string{
-			{"50001.00", "1.2"},
-			{"50002.00", "1.8"},
+		Asks: []client.BinanceLevel{
+			{dec("50001.00"), dec("1.2")},
+			{dec("50002.00"), dec("1.8")},
 		},
 	}
 
 	mockBinance.On("GetDepth", "BTCUSDT", 20).Return(expectedDepth, nil)
 
 	// Act
-	result, err := service.GetDepth("BTCUSDT", 20)
+	result, err := service.GetDepth(context.Background(), btcusdt, 20)
 
 	// Assert
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
-	assert.Equal(t, "BTCUSDT", result.Symbol)
+	assert.Equal(t, "BTC-USDT", result.Symbol)
 	assert.Equal(t, "binance", result.Source)
 	assert.Len(t, result.Bids, 2)
 	assert.Len(t, result.Asks, 2)
@@ -290,25 +323,21 @@ func BenchmarkMarketService_GetTicker_CacheHit(b *testing.B) {
 	mockCoinGecko := new(MockCoinGeckoClient)
 	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
 
-	service := &MarketService{
-		binanceClient:   mockBinance,
-		coinGeckoClient: mockCoinGecko,
-		cache:           cacheInstance,
-	}
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
 
 	// Set up cache
 	cachedTicker := &TickerResponse{
-		Symbol:    "BTCUSDT",
-		Price:     "26543.21",
-		Change24h: "2.45",
+		Symbol:    "BTC-USDT",
+		Price:     dec("26543.21"),
+		Change24h: OptionalDecimal{decimal.NewNullDecimal(dec("2.45"))},
 		Source:    "binance",
 		Timestamp: time.Now(),
 	}
-	cacheInstance.Set("ticker:BTCUSDT", cachedTicker, cache.DefaultExpiration)
+	service.store("ticker:BTC-USDT", cachedTicker, cachedTicker.Timestamp, DefaultCacheConfig().Ticker)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = service.GetTicker("BTCUSDT")
+		_, _ = service.GetTicker(context.Background(), btcusdt)
 	}
 }
 
@@ -317,19 +346,15 @@ func BenchmarkMarketService_GetTicker_APICalls(b *testing.B) {
 	mockCoinGecko := new(MockCoinGeckoClient)
 	cacheInstance := cache.New(1*time.Nanosecond, 1*time.Nanosecond) // 禁用缓存
 
-	service := &MarketService{
-		binanceClient:   mockBinance,
-		coinGeckoClient: mockCoinGecko,
-		cache:           cacheInstance,
-	}
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
 
 	expectedTicker := &client.BinanceTicker{
 		Symbol:             "BTCUSDT",
-		LastPrice:          "26543.21",
-		PriceChangePercent: "2.45",
-		Volume:             "45123.67",
-		HighPrice:          "27100.00",
-		LowPrice:           "26200.00",
+		LastPrice:          dec("26543.21"),
+		PriceChangePercent: dec("2.45"),
+		Volume:             dec("45123.67"),
+		HighPrice:          dec("27100.00"),
+		LowPrice:           dec("26200.00"),
 		CloseTime:          time.Now().Unix() * 1000,
 	}
 
@@ -337,6 +362,27 @@ func BenchmarkMarketService_GetTicker_APICalls(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = service.GetTicker("BTCUSDT")
+		_, _ = service.GetTicker(context.Background(), btcusdt)
 	}
 }
+
+func TestMarketService_GetTicker_ProviderPriority(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
+
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
+	assert.NoError(t, service.providers.SetOrder([]string{provider.CoinGeckoName}))
+
+	mockCoinGecko.On("GetMarket", "bitcoin", "usd").Return(&client.CoinGeckoMarket{ID: "bitcoin", CurrentPrice: dec("26543.21")}, nil)
+
+	// Act
+	result, err := service.GetTicker(context.Background(), btcusdt)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "coingecko", result.Source)
+	mockBinance.AssertNotCalled(t, "Get24hrTicker", mock.Anything)
+	mockCoinGecko.AssertExpectations(t)
+}
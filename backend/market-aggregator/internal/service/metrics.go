@@ -0,0 +1,32 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "market_aggregator",
+		Name:      "cache_lookups_total",
+		Help:      "Response cache lookups by key type and result: hit, stale or miss.",
+	}, []string{"type", "result"})
+
+	tickerFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "market_aggregator",
+		Name:      "ticker_fallbacks_total",
+		Help:      "Tickers served by a provider other than the primary one.",
+	}, []string{"provider"})
+)
+
+// cacheKeyType is the key's prefix, e.g. "ticker" for "ticker:BTC-USDT".
+func cacheKeyType(key string) string {
+	keyType, _, _ := strings.Cut(key, ":")
+	return keyType
+}
+
+func recordCacheLookup(key, result string) {
+	cacheLookups.WithLabelValues(cacheKeyType(key), result).Inc()
+}
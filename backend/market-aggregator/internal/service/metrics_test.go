@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarketService_RecordsCacheLookupsAndFallbacks(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	mockBinance.On("Get24hrTicker", "BTCUSDT").Return(nil, errors.New("API error")).Once()
+	mockCoinGecko.On("GetMarket", "bitcoin", "usd").Return(&client.CoinGeckoMarket{ID: "bitcoin", CurrentPrice: dec("26543.21")}, nil).Once()
+
+	misses := cacheLookups.WithLabelValues("ticker", "miss")
+	hits := cacheLookups.WithLabelValues("ticker", "hit")
+	fallbacks := tickerFallbacks.WithLabelValues("coingecko")
+	missesBefore, hitsBefore, fallbacksBefore := testutil.ToFloat64(misses), testutil.ToFloat64(hits), testutil.ToFloat64(fallbacks)
+
+	// Act
+	_, err := service.GetTicker(context.Background(), btcusdt)
+	require.NoError(t, err)
+	_, err = service.GetTicker(context.Background(), btcusdt)
+	require.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, missesBefore+1, testutil.ToFloat64(misses))
+	assert.Equal(t, hitsBefore+1, testutil.ToFloat64(hits))
+	assert.Equal(t, fallbacksBefore+1, testutil.ToFloat64(fallbacks))
+}
+
+func TestCacheKeyType(t *testing.T) {
+	assert.Equal(t, "ticker", cacheKeyType("ticker:BTC-USDT"))
+	assert.Equal(t, "klines", cacheKeyType("klines:BTC-USDT:1h:100"))
+	assert.Equal(t, "plain", cacheKeyType("plain"))
+}
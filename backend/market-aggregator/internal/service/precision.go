@@ -0,0 +1,106 @@
+package service
+
+import (
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/shopspring/decimal"
+)
+
+// Precision is the number of decimal places a symbol's prices and
+// quantities are published with. Values are computed exactly and only
+// rounded when a response is built.
+type Precision struct {
+	Price    int32
+	Quantity int32
+}
+
+// DefaultPrecision applies to symbols without a configured precision. No
+// supported venue quotes more than eight places, so nothing is lost.
+func DefaultPrecision() Precision {
+	return Precision{Price: 8, Quantity: 8}
+}
+
+// SetPrecision sets the output precision of pair, overriding the one
+// derived from its listing.
+func (s *MarketService) SetPrecision(pair symbols.Pair, precision Precision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.precisions[pair] = precision
+}
+
+// SetPrecisions replaces every precision set so far; pairs left out go back
+// to the precision derived from their listing.
+func (s *MarketService) SetPrecisions(precisions map[symbols.Pair]Precision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.precisions = make(map[symbols.Pair]Precision, len(precisions))
+	for pair, precision := range precisions {
+		s.precisions[pair] = precision
+	}
+}
+
+func (s *MarketService) precision(pair symbols.Pair) Precision {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if p, ok := s.precisions[pair]; ok {
+		return p
+	}
+	if s.symbols != nil {
+		if info, ok := s.symbols.Lookup(pair); ok && info.TickSize.IsPositive() && info.StepSize.IsPositive() {
+			return Precision{Price: info.PricePrecision(), Quantity: info.QuantityPrecision()}
+		}
+	}
+	return DefaultPrecision()
+}
+
+func (p Precision) price(d decimal.Decimal) decimal.Decimal {
+	return d.Round(p.Price)
+}
+
+func (p Precision) quantity(d decimal.Decimal) decimal.Decimal {
+	return d.Round(p.Quantity)
+}
+
+func (p Precision) levels(levels []provider.Level) []provider.Level {
+	result := make([]provider.Level, len(levels))
+	for i, l := range levels {
+		result[i] = provider.Level{p.price(l.Price()), p.quantity(l.Quantity())}
+	}
+	return result
+}
+
+// klines rounds a copy, leaving the exact candles for the store and resampling.
+func (p Precision) klines(klines []provider.Kline) []provider.Kline {
+	result := make([]provider.Kline, len(klines))
+	for i, k := range klines {
+		k.Open = p.price(k.Open)
+		k.High = p.price(k.High)
+		k.Low = p.price(k.Low)
+		k.Close = p.price(k.Close)
+		k.Volume = p.quantity(k.Volume)
+		k.TakerBuyBaseVolume = p.quantity(k.TakerBuyBaseVolume)
+		result[i] = k
+	}
+	return result
+}
+
+// OptionalDecimal is a statistic a provider may not report. Missing values
+// are published as null.
+type OptionalDecimal struct {
+	decimal.NullDecimal
+}
+
+// Equal reports whether both values are missing or both hold equal decimals.
+func (d OptionalDecimal) Equal(other OptionalDecimal) bool {
+	return d.Valid == other.Valid && (!d.Valid || d.Decimal.Equal(other.Decimal))
+}
+
+func (p Precision) optional(d decimal.NullDecimal, round func(decimal.Decimal) decimal.Decimal) OptionalDecimal {
+	if !d.Valid {
+		return OptionalDecimal{}
+	}
+	return OptionalDecimal{decimal.NewNullDecimal(round(d.Decimal))}
+}
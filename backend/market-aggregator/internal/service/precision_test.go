@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarketService_SetPrecision_RoundsOutput(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+	service.SetPrecision(btcusdt, Precision{Price: 2, Quantity: 3})
+
+	mockBinance.On("GetDepth", "BTCUSDT", 5).Return(&client.BinanceDepth{
+		Bids: []client.BinanceLevel{{dec("26543.214"), dec("0.12345")}},
+		Asks: []client.BinanceLevel{{dec("26543.219"), dec("1.00000000")}},
+	}, nil)
+
+	// Act
+	result, err := service.GetDepth(context.Background(), btcusdt, 5)
+
+	// Assert
+	require.NoError(t, err)
+	body, err := json.Marshal(result)
+	require.NoError(t, err)
+	var depth struct {
+		Bids [][]string `json:"bids"`
+		Asks [][]string `json:"asks"`
+	}
+	require.NoError(t, json.Unmarshal(body, &depth))
+	assert.Equal(t, [][]string{{"26543.21", "0.123"}}, depth.Bids)
+	assert.Equal(t, [][]string{{"26543.22", "1"}}, depth.Asks)
+}
+
+func TestMarketService_DefaultPrecision_KeepsSmallPrices(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	mockBinance.On("Get24hrTicker", "SHIBUSDT").Return(&client.BinanceTicker{
+		Symbol:             "SHIBUSDT",
+		LastPrice:          dec("0.00001234"),
+		PriceChangePercent: dec("-1.5"),
+		Volume:             dec("1000000"),
+		HighPrice:          dec("0.00001300"),
+		LowPrice:           dec("0.00001200"),
+	}, nil)
+
+	// Act
+	result, err := service.GetTicker(context.Background(), symbols.Pair{Base: "SHIB", Quote: "USDT"})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "0.00001234", result.Price.String())
+	assert.Equal(t, "0.000013", result.High24h.Decimal.String())
+}
+
+func TestOptionalDecimal_JSON(t *testing.T) {
+	var missing OptionalDecimal
+	body, err := json.Marshal(missing)
+	require.NoError(t, err)
+	assert.Equal(t, `null`, string(body))
+
+	var parsed OptionalDecimal
+	require.NoError(t, json.Unmarshal([]byte(`"2.45"`), &parsed))
+	assert.True(t, parsed.Valid)
+	assert.Equal(t, "2.45", parsed.Decimal.String())
+
+	require.NoError(t, json.Unmarshal([]byte(`null`), &parsed))
+	assert.False(t, parsed.Valid)
+}
+
+type symbolStub map[symbols.Pair]symbols.Symbol
+
+func (s symbolStub) Lookup(pair symbols.Pair) (symbols.Symbol, bool) {
+	info, ok := s[pair]
+	return info, ok
+}
+
+func TestMarketService_UseSymbols_PrecisionFromListing(t *testing.T) {
+	service := NewMarketService(provider.NewRegistry(), cache.New(5*time.Minute, 10*time.Minute))
+	ethusdt := symbols.Pair{Base: "ETH", Quote: "USDT"}
+	service.UseSymbols(symbolStub{
+		btcusdt: {Symbol: "BTC-USDT", TickSize: dec("0.01000000"), StepSize: dec("0.00001000")},
+		ethusdt: {Symbol: "ETH-USDT", TickSize: dec("0.01"), StepSize: dec("0.0001")},
+	})
+	service.SetPrecision(ethusdt, Precision{Price: 4, Quantity: 4})
+
+	assert.Equal(t, Precision{Price: 2, Quantity: 5}, service.precision(btcusdt))
+	assert.Equal(t, Precision{Price: 4, Quantity: 4}, service.precision(ethusdt))
+	assert.Equal(t, DefaultPrecision(), service.precision(symbols.Pair{Base: "XYZ", Quote: "USDT"}))
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/candles"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/rs/zerolog/log"
+)
+
+// resampleBases are the native intervals candles are aggregated from,
+// largest first so that the fewest base candles are fetched.
+var resampleBases = []string{"1d", "12h", "8h", "6h", "4h", "2h", "1h", "30m", "15m", "5m", "3m", "1m"}
+
+// GetResampledKlines aggregates a native interval into interval, which may be
+// one providers do not serve such as "10m" or "2d". Day, week and month
+// candles open at midnight in loc, as do sub-day candles whose length divides
+// a day. The range semantics match GetKlineRange; without a startTime the
+// latest limit candles are returned, the last of which is still forming.
+func (s *MarketService) GetResampledKlines(ctx context.Context, pair symbols.Pair, interval string, loc *time.Location, startTime, endTime int64, limit int) (*KlineResponse, error) {
+	target, err := candles.ParseInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	ctx, span := startSpan(ctx, "MarketService.GetResampledKlines", pair)
+	defer span.End()
+
+	cacheKey := fmt.Sprintf("klines:resampled:%s:%s:%s:%d:%d:%d", pair, interval, loc, startTime, endTime, limit)
+
+	limits := s.klineSettings()
+	if startTime == 0 {
+		if limit <= 0 || limit > limits.PageSize {
+			limit = limits.PageSize
+		}
+	} else if err := checkKlineRange(startTime, endTime, limits); err != nil {
+		return nil, err
+	}
+
+	cached, stale, err := s.cached(ctx, cacheKey, s.bounded(s.timeoutSettings().KlineRange, func(ctx context.Context) (interface{}, error) {
+		response, err := s.resampleKlines(ctx, pair, interval, target, loc, startTime, endTime, limit)
+		if err != nil {
+			return nil, err
+		}
+		s.store(cacheKey, response, response.FetchedAt, s.klineRangePolicy(endTime))
+		return response, nil
+	}))
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	klines := cached.(*KlineResponse)
+	if stale {
+		staleKlines := *klines
+		staleKlines.Stale = true
+		return &staleKlines, nil
+	}
+	return klines, nil
+}
+
+// resampleKlines fetches the base candles of a validated request and
+// aggregates them. The range is resolved against the clock on every run, so
+// background refreshes of open-ended requests move with it.
+func (s *MarketService) resampleKlines(ctx context.Context, pair symbols.Pair, interval string, target candles.Interval, loc *time.Location, startTime, endTime int64, limit int) (*KlineResponse, error) {
+	now := time.Now().UnixMilli()
+	if endTime == 0 || endTime > now {
+		endTime = now
+	}
+
+	latest := startTime == 0
+	if latest {
+		startTime = target.Shift(target.Open(endTime, loc), -(limit - 1), loc)
+	} else {
+		// Only candles opening at or after startTime, as for native intervals
+		if open := target.Open(startTime, loc); open < startTime {
+			startTime = target.Shift(open, 1, loc)
+		}
+		if startTime > endTime {
+			return &KlineResponse{
+				Symbol:       pair.String(),
+				VenueSymbols: s.venueSymbols(pair, provider.CapKlines),
+				Interval:     interval,
+				Klines:       []provider.Kline{},
+				TimeZone:     loc.String(),
+				Freshness:    Freshness{FetchedAt: time.Now()},
+			}, nil
+		}
+	}
+
+	base := resampleBase(target, loc, startTime, endTime)
+	step, _ := candles.Step(base)
+	maxCandles := s.klineSettings().MaxResampleCandles
+	if n := (endTime-startTime)/step.Milliseconds() + 1; n > int64(maxCandles) {
+		return nil, fmt.Errorf("%w: needs %d %s candles, at most %d", ErrRangeTooLarge, n, base, maxCandles)
+	}
+
+	baseKlines, err := s.fetchKlineRange(ctx, pair, base, startTime, endTime, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	klines := candles.Resample(baseKlines.Klines, target, loc)
+	if limit > 0 && len(klines) > limit {
+		if latest {
+			klines = klines[len(klines)-limit:]
+		} else {
+			klines = klines[:limit]
+		}
+	}
+
+	log.Info().Stringer("symbol", pair).Str("interval", interval).Str("base", base).Int("count", len(klines)).Msg("Klines resampled successfully")
+	return &KlineResponse{
+		Symbol:       pair.String(),
+		VenueSymbols: baseKlines.VenueSymbols,
+		Interval:     interval,
+		Klines:       s.precision(pair).klines(klines),
+		Source:       baseKlines.Source,
+		BaseInterval: base,
+		TimeZone:     loc.String(),
+		Freshness:    Freshness{FetchedAt: baseKlines.FetchedAt},
+	}, nil
+}
+
+// resampleBase picks the largest native interval whose candles never straddle
+// a target boundary: its length must divide the target's, and for targets
+// aligned to local midnight it must also divide loc's UTC offset.
+func resampleBase(target candles.Interval, loc *time.Location, start, end int64) string {
+	targetStep, fixed := target.Step()
+	localAligned := true
+	if target.Unit == 'm' || target.Unit == 'h' {
+		localAligned = (24*time.Hour)%targetStep == 0
+	}
+
+	for _, name := range resampleBases {
+		step, _ := candles.Step(name)
+		if fixed && targetStep%step != 0 {
+			continue
+		}
+		if localAligned && !offsetAligned(loc, step, start, end) {
+			continue
+		}
+		return name
+	}
+	return "1m"
+}
+
+// offsetAligned checks loc's offset at both ends of the range, which covers
+// a daylight saving change inside it.
+func offsetAligned(loc *time.Location, step time.Duration, times ...int64) bool {
+	for _, t := range times {
+		_, offset := time.UnixMilli(t).In(loc).Zone()
+		if (time.Duration(offset)*time.Second)%step != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TickerError reports a symbol of a batch that could not be served.
+type TickerError struct {
+	Symbol string `json:"symbol"`
+	Code   string `json:"code"`
+	Error  string `json:"error"`
+}
+
+// TickersResponse carries the tickers of a batch in request order; symbols
+// no provider could serve are listed in Errors instead.
+type TickersResponse struct {
+	Tickers   []*TickerResponse `json:"tickers"`
+	Errors    []TickerError     `json:"errors"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// GetTickers returns the tickers of pairs. Cached tickers are reused; the
+// rest are fetched with one batch call per provider where the provider
+// supports it, and each provider only sees the pairs earlier ones missed.
+func (s *MarketService) GetTickers(ctx context.Context, pairs []symbols.Pair) *TickersResponse {
+	ctx, span := tracer.Start(ctx, "MarketService.GetTickers", trace.WithAttributes(attribute.Int("market.symbols", len(pairs))))
+	defer span.End()
+
+	results := make(map[symbols.Pair]*TickerResponse, len(pairs))
+	var missing []symbols.Pair
+	fromCache := 0
+	for _, pair := range pairs {
+		if _, seen := results[pair]; seen {
+			continue
+		}
+		pair := pair
+		cacheKey := fmt.Sprintf("ticker:%s", pair)
+		fetch := s.bounded(s.timeoutSettings().Ticker, func(ctx context.Context) (interface{}, error) {
+			return s.fetchTicker(ctx, pair)
+		})
+		s.hotKeys.hit(cacheKey, fetch)
+
+		// Stale tickers are served while refreshed one by one in the background
+		if entry, result := s.lookup(ctx, cacheKey); result != "miss" {
+			ticker := entry.value.(*TickerResponse)
+			if result == "stale" {
+				s.flights.Go(ctx, cacheKey, fetch)
+				staleTicker := *ticker
+				staleTicker.Stale = true
+				ticker = &staleTicker
+			}
+			results[pair] = ticker
+			fromCache++
+			continue
+		}
+		results[pair] = nil
+		missing = append(missing, pair)
+	}
+
+	ctx, cancel := s.withDeadline(ctx, s.timeoutSettings().Tickers)
+	defer cancel()
+
+	errs := make(map[symbols.Pair][]string)
+	primary := s.providers.Primary(provider.CapTicker)
+	for _, p := range s.providers.Providers(provider.CapTicker) {
+		if len(missing) == 0 || ctx.Err() != nil {
+			break
+		}
+
+		fetched := fetchTickers(ctx, p, missing)
+		var next []symbols.Pair
+		for _, pair := range missing {
+			result, ok := fetched[pair]
+			if !ok {
+				result.Err = fmt.Errorf("no ticker returned")
+			}
+			if result.Err != nil {
+				errs[pair] = append(errs[pair], fmt.Sprintf("%s=%v", p.Name(), result.Err))
+				next = append(next, pair)
+				continue
+			}
+			results[pair] = s.cacheTicker(pair, p, p.Name() == primary, result.Ticker)
+		}
+		if len(next) > 0 {
+			log.Warn().Str("source", p.Name()).Int("failed", len(next)).Msg("Batch ticker provider missed symbols, trying next")
+		}
+		missing = next
+	}
+
+	response := &TickersResponse{
+		Tickers:   []*TickerResponse{},
+		Errors:    []TickerError{},
+		Timestamp: time.Now(),
+	}
+	for _, pair := range pairs {
+		ticker, ok := results[pair]
+		if !ok {
+			// Duplicate already reported
+			continue
+		}
+		delete(results, pair)
+		if ticker != nil {
+			response.Tickers = append(response.Tickers, ticker)
+			continue
+		}
+		response.Errors = append(response.Errors, TickerError{
+			Symbol: pair.String(),
+			Code:   "TICKER_UNAVAILABLE",
+			Error:  fmt.Sprintf("failed to fetch ticker data: %s", joinErrors(errs[pair])),
+		})
+	}
+
+	span.SetAttributes(attribute.Int("market.cached", fromCache), attribute.Int("market.failed", len(response.Errors)))
+	log.Info().Int("requested", len(pairs)).Int("cached", fromCache).Int("failed", len(response.Errors)).Msg("Tickers fetched")
+	return response
+}
+
+// fetchTickers uses p's batch call when it has one and falls back to one
+// call per pair otherwise. A failed batch call fails every pair.
+func fetchTickers(ctx context.Context, p provider.Provider, pairs []symbols.Pair) map[symbols.Pair]provider.TickerResult {
+	if batch, ok := p.(provider.BatchTickerProvider); ok {
+		result, err := batch.GetTickers(ctx, pairs)
+		if err == nil {
+			return result
+		}
+		result = make(map[symbols.Pair]provider.TickerResult, len(pairs))
+		for _, pair := range pairs {
+			result[pair] = provider.TickerResult{Err: err}
+		}
+		return result
+	}
+
+	result := make(map[symbols.Pair]provider.TickerResult, len(pairs))
+	for _, pair := range pairs {
+		ticker, err := p.GetTicker(ctx, pair)
+		result[pair] = provider.TickerResult{Ticker: ticker, Err: err}
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarketService_GetTickers_PartialFailure(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	cacheInstance := cache.New(5*time.Minute, 10*time.Minute)
+	service := newTestService(mockBinance, mockCoinGecko, cacheInstance)
+
+	ethusdt := symbols.Pair{Base: "ETH", Quote: "USDT"}
+	solusdt := symbols.Pair{Base: "SOL", Quote: "USDT"}
+	injusdt := symbols.Pair{Base: "INJ", Quote: "USDT"}
+	service.store("ticker:ETH-USDT", &TickerResponse{Symbol: "ETH-USDT", Price: dec("1650.5"), Source: "binance"}, time.Now(), DefaultCacheConfig().Ticker)
+
+	// Binance does not return SOL; CoinGecko has it but cannot resolve INJ
+	mockBinance.On("Get24hrTickers", []string{"BTCUSDT", "SOLUSDT", "INJUSDT"}).Return([]client.BinanceTicker{
+		{Symbol: "BTCUSDT", LastPrice: dec("26543.21")},
+	}, nil).Once()
+	mockCoinGecko.On("GetMarkets", []string{"solana"}, "usd").Return([]client.CoinGeckoMarket{
+		{ID: "solana", CurrentPrice: dec("21.5")},
+	}, nil).Once()
+
+	// Act
+	result := service.GetTickers(context.Background(), []symbols.Pair{btcusdt, ethusdt, solusdt, injusdt, btcusdt})
+
+	// Assert
+	require.Len(t, result.Tickers, 3)
+	assert.Equal(t, "BTC-USDT", result.Tickers[0].Symbol)
+	assert.Equal(t, "binance", result.Tickers[0].Source)
+	assert.Equal(t, "1650.5", result.Tickers[1].Price.String())
+	assert.Equal(t, "SOL-USDT", result.Tickers[2].Symbol)
+	assert.Equal(t, "coingecko_fallback", result.Tickers[2].Source)
+
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "INJ-USDT", result.Errors[0].Symbol)
+	assert.Equal(t, "TICKER_UNAVAILABLE", result.Errors[0].Code)
+	assert.Contains(t, result.Errors[0].Error, "binance=no ticker returned")
+	assert.Contains(t, result.Errors[0].Error, "coingecko=")
+
+	// Fetched tickers are cached for single-symbol requests
+	_, found := cacheInstance.Get("ticker:BTC-USDT")
+	assert.True(t, found)
+	mockBinance.AssertExpectations(t)
+	mockCoinGecko.AssertExpectations(t)
+}
+
+func TestMarketService_GetTickers_BatchCallFails(t *testing.T) {
+	// Arrange
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+
+	mockBinance.On("Get24hrTickers", []string{"BTCUSDT"}).Return(nil, errors.New("API error"))
+	mockCoinGecko.On("GetMarkets", []string{"bitcoin"}, "usd").Return(nil, errors.New("rate limited"))
+
+	// Act
+	result := service.GetTickers(context.Background(), []symbols.Pair{btcusdt})
+
+	// Assert
+	assert.Empty(t, result.Tickers)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "failed to fetch ticker data: binance=API error, coingecko=rate limited", result.Errors[0].Error)
+}
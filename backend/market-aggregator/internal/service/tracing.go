@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/service")
+
+// startSpan starts the span of a service call for pair.
+func startSpan(ctx context.Context, name string, pair symbols.Pair) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.Stringer("market.symbol", pair)))
+}
+
+// spanError marks span as failed with err and returns err.
+func spanError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
+
+// startCacheSpan starts the span of a cache lookup of key; end it with
+// endCacheSpan once the result is known.
+func startCacheSpan(ctx context.Context, key string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "cache.get", trace.WithAttributes(
+		attribute.String("cache.key", key),
+		attribute.String("cache.type", cacheKeyType(key)),
+	))
+}
+
+// endCacheSpan records a lookup's result, hit, stale or miss, in its span and
+// the cache metrics.
+func endCacheSpan(span trace.Span, key, result string) {
+	span.SetAttributes(attribute.String("cache.result", result))
+	span.End()
+	recordCacheLookup(key, result)
+}
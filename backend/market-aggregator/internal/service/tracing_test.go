@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spanRecorder = tracetest.NewSpanRecorder()
+	installSpans sync.Once
+)
+
+// recordSpans installs a global tracer provider feeding spanRecorder. The
+// package tracer binds to the first provider installed, so tests share one
+// and tell their spans apart by trace ID.
+func recordSpans() trace.TracerProvider {
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+	installSpans.Do(func() { otel.SetTracerProvider(provider) })
+	return otel.GetTracerProvider()
+}
+
+func TestMarketService_TracesCacheLookups(t *testing.T) {
+	// Arrange
+	provider := recordSpans()
+
+	mockBinance := new(MockBinanceClient)
+	mockCoinGecko := new(MockCoinGeckoClient)
+	service := newTestService(mockBinance, mockCoinGecko, cache.New(5*time.Minute, 10*time.Minute))
+	mockBinance.On("Get24hrTicker", "BTCUSDT").Return(&client.BinanceTicker{Symbol: "BTCUSDT", LastPrice: dec("26543.21")}, nil).Once()
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "request")
+
+	// Act
+	_, err := service.GetTicker(ctx, btcusdt)
+	require.NoError(t, err)
+	_, err = service.GetTicker(ctx, btcusdt)
+	require.NoError(t, err)
+	request.End()
+
+	// Assert
+	var getTicker []sdktrace.ReadOnlySpan
+	var results []string
+	for _, span := range spanRecorder.Ended() {
+		if span.SpanContext().TraceID() != request.SpanContext().TraceID() {
+			continue
+		}
+		switch span.Name() {
+		case "MarketService.GetTicker":
+			assert.Equal(t, request.SpanContext().SpanID(), span.Parent().SpanID())
+			getTicker = append(getTicker, span)
+		case "cache.get":
+			for _, attr := range span.Attributes() {
+				if attr.Key == "cache.result" {
+					results = append(results, attr.Value.AsString())
+				}
+			}
+		}
+	}
+	require.Len(t, getTicker, 2)
+	assert.Contains(t, getTicker[0].Attributes(), attribute.String("market.symbol", "BTC-USDT"))
+	assert.Equal(t, []string{"miss", "hit"}, results)
+	mockBinance.AssertExpectations(t)
+}
@@ -0,0 +1,193 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/service"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	maxMessageSize = 4096
+	sendBufferSize = 256
+)
+
+// Client is a single WebSocket connection and its subscriptions.
+type Client struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan Message
+	done chan struct{}
+
+	closeOnce sync.Once
+
+	// Only touched by the read loop, and by Serve once the loop has exited
+	subscriptions map[string]Subscription
+}
+
+func newClient(hub *Hub, conn *websocket.Conn) *Client {
+	return &Client{
+		hub:           hub,
+		conn:          conn,
+		send:          make(chan Message, sendBufferSize),
+		done:          make(chan struct{}),
+		subscriptions: make(map[string]Subscription),
+	}
+}
+
+// enqueue never blocks; a client that cannot keep up is disconnected.
+func (c *Client) enqueue(msg Message) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+	default:
+		log.Warn().Str("remote_addr", c.conn.RemoteAddr().String()).Msg("Stream client too slow, disconnecting")
+		c.close()
+	}
+}
+
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (c *Client) readPump() {
+	pongWait := 2 * c.hub.config.HeartbeatInterval
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Debug().Err(err).Msg("Stream client read failed")
+			}
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var req Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.enqueue(errorMessage("INVALID_MESSAGE", "message must be a JSON object"))
+			continue
+		}
+		c.handle(req)
+	}
+}
+
+func (c *Client) writePump() {
+	heartbeat := time.NewTicker(c.hub.config.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close()
+				return
+			}
+		case <-heartbeat.C:
+			// Control-frame ping for the connection, JSON heartbeat for browser clients
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close()
+				return
+			}
+			if err := c.conn.WriteJSON(Message{Type: TypeHeartbeat, Timestamp: time.Now().UnixMilli()}); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) handle(req Request) {
+	switch req.Op {
+	case OpPing:
+		c.enqueue(Message{Type: TypePong, Timestamp: time.Now().UnixMilli()})
+	case OpSubscribe:
+		sub, ok := c.validate(req)
+		if !ok {
+			return
+		}
+		if _, exists := c.subscriptions[sub.key()]; exists {
+			c.enqueue(sub.message(TypeSubscribed, nil))
+			return
+		}
+		if len(c.subscriptions) >= c.hub.config.MaxSubscriptions {
+			c.enqueue(errorMessage("SUBSCRIPTION_LIMIT", "too many subscriptions on this connection"))
+			return
+		}
+		c.subscriptions[sub.key()] = sub
+		c.enqueue(sub.message(TypeSubscribed, nil))
+		c.hub.subscribe(c, sub)
+	case OpUnsubscribe:
+		sub, ok := c.validate(req)
+		if !ok {
+			return
+		}
+		if _, exists := c.subscriptions[sub.key()]; !exists {
+			c.enqueue(errorMessage("NOT_SUBSCRIBED", "no subscription for "+sub.key()))
+			return
+		}
+		delete(c.subscriptions, sub.key())
+		c.hub.unsubscribe(c, sub)
+		c.enqueue(sub.message(TypeUnsubscribed, nil))
+	default:
+		c.enqueue(errorMessage("UNKNOWN_OP", "op must be subscribe, unsubscribe or ping"))
+	}
+}
+
+func (c *Client) validate(req Request) (Subscription, bool) {
+	sub := Subscription{Channel: req.Channel}
+
+	switch req.Channel {
+	case ChannelTicker, ChannelDepth:
+	case ChannelKline:
+		if req.Interval == "" {
+			req.Interval = "1m"
+		}
+		if !service.IsValidInterval(req.Interval) {
+			c.enqueue(errorMessage("INVALID_INTERVAL", "invalid interval format"))
+			return sub, false
+		}
+		sub.Interval = req.Interval
+	default:
+		c.enqueue(errorMessage("INVALID_CHANNEL", "channel must be ticker, kline or depth"))
+		return sub, false
+	}
+
+	pair, err := c.hub.resolveSymbol(req.Symbol)
+	if err != nil {
+		code := "INVALID_SYMBOL"
+		if errors.Is(err, symbols.ErrUnknownSymbol) {
+			code = "UNKNOWN_SYMBOL"
+		}
+		c.enqueue(errorMessage(code, err.Error()))
+		return sub, false
+	}
+	sub.Pair = pair
+	sub.Symbol = pair.String()
+
+	return sub, true
+}
@@ -0,0 +1,376 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/service"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+)
+
+// MarketSource is the market data the hub streams; *service.MarketService implements it.
+type MarketSource interface {
+	GetTicker(ctx context.Context, pair symbols.Pair) (*service.TickerResponse, error)
+	GetKlines(ctx context.Context, pair symbols.Pair, interval string, limit int) (*service.KlineResponse, error)
+	GetDepth(ctx context.Context, pair symbols.Pair, limit int) (*service.DepthResponse, error)
+}
+
+// SymbolResolver maps a requested symbol to a listed pair; *symbols.Registry implements it.
+type SymbolResolver interface {
+	Resolve(symbol string) (symbols.Pair, error)
+}
+
+type Config struct {
+	TickerInterval    time.Duration
+	KlineInterval     time.Duration
+	DepthInterval     time.Duration
+	KlineLimit        int
+	DepthLimit        int
+	MaxSubscriptions  int
+	HeartbeatInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		TickerInterval:    1 * time.Second,
+		KlineInterval:     2 * time.Second,
+		DepthInterval:     1 * time.Second,
+		KlineLimit:        100,
+		DepthLimit:        20,
+		MaxSubscriptions:  20,
+		HeartbeatInterval: 15 * time.Second,
+	}
+}
+
+// Hub multiplexes client subscriptions onto one polling loop per topic, so
+// any number of clients watching the same symbol cost a single data source
+// lookup per interval.
+type Hub struct {
+	source  MarketSource
+	symbols SymbolResolver
+	config  Config
+
+	mu      sync.Mutex
+	topics  map[string]*topic
+	clients map[*Client]bool
+	closed  bool
+}
+
+func NewHub(source MarketSource, config Config) *Hub {
+	return &Hub{
+		source:  source,
+		config:  config,
+		topics:  make(map[string]*topic),
+		clients: make(map[*Client]bool),
+	}
+}
+
+// UseSymbols makes subscriptions to unlisted symbols fail. Without it only
+// the symbol format is checked.
+func (h *Hub) UseSymbols(symbols SymbolResolver) {
+	h.symbols = symbols
+}
+
+func (h *Hub) resolveSymbol(symbol string) (symbols.Pair, error) {
+	if h.symbols != nil {
+		return h.symbols.Resolve(symbol)
+	}
+	return symbols.Parse(symbol)
+}
+
+// Serve runs a client connection until it is closed by either side.
+func (h *Hub) Serve(conn *websocket.Conn) {
+	c := newClient(h, conn)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		conn.Close()
+		return
+	}
+	h.clients[c] = true
+	h.mu.Unlock()
+
+	go c.writePump()
+	c.readPump()
+	c.close()
+
+	for _, sub := range c.subscriptions {
+		h.unsubscribe(c, sub)
+	}
+
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+// Close stops all topics and disconnects every client.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for key, t := range h.topics {
+		t.cancel()
+		delete(h.topics, key)
+	}
+	for c := range h.clients {
+		c.close()
+	}
+}
+
+func (h *Hub) subscribe(c *Client, sub Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	t, exists := h.topics[sub.key()]
+	if !exists {
+		t = newTopic(h, sub)
+		h.topics[sub.key()] = t
+		go t.run(h.pollInterval(sub.Channel))
+	}
+	t.add(c)
+}
+
+func (h *Hub) unsubscribe(c *Client, sub Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, exists := h.topics[sub.key()]
+	if !exists {
+		return
+	}
+	if t.remove(c) == 0 {
+		t.cancel()
+		delete(h.topics, sub.key())
+	}
+}
+
+func (h *Hub) pollInterval(channel string) time.Duration {
+	switch channel {
+	case ChannelKline:
+		return h.config.KlineInterval
+	case ChannelDepth:
+		return h.config.DepthInterval
+	default:
+		return h.config.TickerInterval
+	}
+}
+
+// topic polls the data source for one subscription and fans results out.
+// New subscribers get a snapshot; existing ones only get what changed.
+type topic struct {
+	sub   Subscription
+	fetch func(ctx context.Context) (interface{}, error)
+	// diff returns the update between two polls, nil when nothing changed,
+	// or resync when only a fresh snapshot describes the change
+	diff func(prev, next interface{}) (update interface{}, resync bool)
+	// Cancelled once the topic has no subscribers left, ending a poll in
+	// flight
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	subscribers map[*Client]bool // value is true while awaiting a snapshot
+	state       interface{}
+	failing     bool
+}
+
+func newTopic(h *Hub, sub Subscription) *topic {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &topic{
+		sub:         sub,
+		ctx:         ctx,
+		cancel:      cancel,
+		subscribers: make(map[*Client]bool),
+	}
+
+	switch sub.Channel {
+	case ChannelKline:
+		t.fetch = func(ctx context.Context) (interface{}, error) {
+			return h.source.GetKlines(ctx, sub.Pair, sub.Interval, h.config.KlineLimit)
+		}
+		t.diff = diffKlines
+	case ChannelDepth:
+		t.fetch = func(ctx context.Context) (interface{}, error) {
+			return h.source.GetDepth(ctx, sub.Pair, h.config.DepthLimit)
+		}
+		t.diff = diffDepth
+	default:
+		t.fetch = func(ctx context.Context) (interface{}, error) {
+			return h.source.GetTicker(ctx, sub.Pair)
+		}
+		t.diff = diffTicker
+	}
+	return t
+}
+
+func (t *topic) run(interval time.Duration) {
+	t.poll()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+			t.poll()
+		}
+	}
+}
+
+func (t *topic) poll() {
+	data, err := t.fetch(t.ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		// Only report the transition into failure, not every failed poll
+		if !t.failing {
+			log.Warn().Err(err).Str("topic", t.sub.key()).Msg("Stream topic poll failed")
+			for c := range t.subscribers {
+				c.enqueue(errorMessage("DATA_UNAVAILABLE", "unable to fetch "+t.sub.Channel+" data"))
+			}
+		}
+		t.failing = true
+		return
+	}
+	t.failing = false
+
+	var update interface{}
+	var resync bool
+	if t.state != nil {
+		update, resync = t.diff(t.state, data)
+	}
+	t.state = data
+
+	for c, pending := range t.subscribers {
+		if pending || resync {
+			c.enqueue(t.sub.message(TypeSnapshot, data))
+			t.subscribers[c] = false
+			continue
+		}
+		if update != nil {
+			c.enqueue(t.sub.message(TypeUpdate, update))
+		}
+	}
+}
+
+func (t *topic) add(c *Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == nil {
+		t.subscribers[c] = true
+		return
+	}
+	c.enqueue(t.sub.message(TypeSnapshot, t.state))
+	t.subscribers[c] = false
+}
+
+func (t *topic) remove(c *Client) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.subscribers, c)
+	return len(t.subscribers)
+}
+
+func diffTicker(prev, next interface{}) (interface{}, bool) {
+	p, n := prev.(*service.TickerResponse), next.(*service.TickerResponse)
+	if p.Price.Equal(n.Price) && p.Change24h.Equal(n.Change24h) && p.Volume24h.Equal(n.Volume24h) &&
+		p.High24h.Equal(n.High24h) && p.Low24h.Equal(n.Low24h) && p.MarketCap.Equal(n.MarketCap) {
+		return nil, false
+	}
+	return n, false
+}
+
+// diffKlines returns the candles that are new or changed, keyed by open time.
+func diffKlines(prev, next interface{}) (interface{}, bool) {
+	p, n := prev.(*service.KlineResponse), next.(*service.KlineResponse)
+
+	known := make(map[int64]provider.Kline, len(p.Klines))
+	for _, k := range p.Klines {
+		known[k.OpenTime] = k
+	}
+
+	var changed []provider.Kline
+	for _, k := range n.Klines {
+		if old, exists := known[k.OpenTime]; !exists || !old.Equal(k) {
+			changed = append(changed, k)
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil, false
+	}
+	return changed, false
+}
+
+// diffDepth reports changed levels. The book is polled to a fixed depth, so
+// a level missing below the new window's worst price may still rest on the
+// book; rather than report it removed, a fresh snapshot is sent.
+func diffDepth(prev, next interface{}) (interface{}, bool) {
+	p, n := prev.(*service.DepthResponse), next.(*service.DepthResponse)
+
+	bids, bidsShifted := diffLevels(p.Bids, n.Bids, true)
+	asks, asksShifted := diffLevels(p.Asks, n.Asks, false)
+	if bidsShifted || asksShifted {
+		return nil, true
+	}
+	if len(bids) == 0 && len(asks) == 0 {
+		return nil, false
+	}
+	return DepthUpdate{Bids: bids, Asks: asks}, false
+}
+
+// diffLevels returns levels whose quantity changed, with removed levels
+// reported at quantity zero. Levels are sorted best first, descending for
+// bids. shifted is set when a level went missing beyond next's worst level,
+// where it cannot be told apart from one that left the window.
+func diffLevels(prev, next []provider.Level, descending bool) (changes []provider.Level, shifted bool) {
+	old := make(map[string]decimal.Decimal, len(prev))
+	for _, level := range prev {
+		old[level.Price().String()] = level.Quantity()
+	}
+
+	changes = []provider.Level{}
+	seen := make(map[string]bool, len(next))
+	for _, level := range next {
+		key := level.Price().String()
+		seen[key] = true
+		if qty, exists := old[key]; !exists || !qty.Equal(level.Quantity()) {
+			changes = append(changes, level)
+		}
+	}
+	for _, level := range prev {
+		if seen[level.Price().String()] {
+			continue
+		}
+		if len(next) == 0 {
+			return nil, true
+		}
+		worst := next[len(next)-1].Price()
+		if (descending && level.Price().LessThan(worst)) || (!descending && level.Price().GreaterThan(worst)) {
+			return nil, true
+		}
+		changes = append(changes, provider.Level{level.Price(), decimal.Zero})
+	}
+	return changes, false
+}
@@ -0,0 +1,193 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/service"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func levels(rows [][]string) []provider.Level {
+	result := make([]provider.Level, len(rows))
+	for i, row := range rows {
+		result[i] = provider.Level{decimal.RequireFromString(row[0]), decimal.RequireFromString(row[1])}
+	}
+	return result
+}
+
+type fakeSource struct {
+	mu    sync.Mutex
+	depth *service.DepthResponse
+}
+
+func (f *fakeSource) GetTicker(ctx context.Context, pair symbols.Pair) (*service.TickerResponse, error) {
+	return &service.TickerResponse{Symbol: pair.String(), Price: decimal.RequireFromString("100.00")}, nil
+}
+
+func (f *fakeSource) GetKlines(ctx context.Context, pair symbols.Pair, interval string, limit int) (*service.KlineResponse, error) {
+	return &service.KlineResponse{Symbol: pair.String(), Interval: interval}, nil
+}
+
+func (f *fakeSource) GetDepth(ctx context.Context, pair symbols.Pair, limit int) (*service.DepthResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.depth, nil
+}
+
+func (f *fakeSource) setDepth(depth *service.DepthResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.depth = depth
+}
+
+func newTestHub(t *testing.T, source MarketSource, config Config) *websocket.Conn {
+	hub := NewHub(source, config)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		hub.Serve(conn)
+	}))
+	t.Cleanup(func() {
+		hub.Close()
+		server.Close()
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) Message {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg Message
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func testConfig() Config {
+	config := DefaultConfig()
+	config.TickerInterval = 20 * time.Millisecond
+	config.DepthInterval = 20 * time.Millisecond
+	config.KlineInterval = 20 * time.Millisecond
+	return config
+}
+
+func TestHub_DepthSnapshotThenUpdate(t *testing.T) {
+	// Arrange
+	source := &fakeSource{depth: &service.DepthResponse{
+		Symbol: "BTC-USDT",
+		Bids:   levels([][]string{{"100", "1"}, {"99", "2"}}),
+		Asks:   levels([][]string{{"101", "1"}}),
+	}}
+	conn := newTestHub(t, source, testConfig())
+
+	// Act
+	require.NoError(t, conn.WriteJSON(Request{Op: OpSubscribe, Channel: ChannelDepth, Symbol: "BTCUSDT"}))
+
+	// Assert
+	assert.Equal(t, TypeSubscribed, readMessage(t, conn).Type)
+	snapshot := readMessage(t, conn)
+	assert.Equal(t, TypeSnapshot, snapshot.Type)
+	assert.Equal(t, ChannelDepth, snapshot.Channel)
+	assert.Equal(t, "BTC-USDT", snapshot.Symbol)
+
+	source.setDepth(&service.DepthResponse{
+		Symbol: "BTC-USDT",
+		Bids:   levels([][]string{{"100", "3"}, {"98", "1"}}),
+		Asks:   levels([][]string{{"101", "1"}}),
+	})
+
+	update := readMessage(t, conn)
+	assert.Equal(t, TypeUpdate, update.Type)
+	data, _ := json.Marshal(update.Data)
+	assert.JSONEq(t, `{"bids":[["100","3"],["98","1"],["99","0"]],"asks":[]}`, string(data))
+}
+
+func TestHub_DepthSnapshotWhenWindowShifts(t *testing.T) {
+	// Arrange
+	source := &fakeSource{depth: &service.DepthResponse{
+		Symbol: "BTC-USDT",
+		Bids:   levels([][]string{{"100", "1"}, {"99", "2"}}),
+		Asks:   levels([][]string{{"101", "1"}}),
+	}}
+	conn := newTestHub(t, source, testConfig())
+	require.NoError(t, conn.WriteJSON(Request{Op: OpSubscribe, Channel: ChannelDepth, Symbol: "BTCUSDT"}))
+	assert.Equal(t, TypeSubscribed, readMessage(t, conn).Type)
+	assert.Equal(t, TypeSnapshot, readMessage(t, conn).Type)
+
+	// Act: a better bid pushes 99 out of a two-level window
+	source.setDepth(&service.DepthResponse{
+		Symbol: "BTC-USDT",
+		Bids:   levels([][]string{{"100.5", "1"}, {"100", "1"}}),
+		Asks:   levels([][]string{{"101", "1"}}),
+	})
+
+	// Assert
+	snapshot := readMessage(t, conn)
+	assert.Equal(t, TypeSnapshot, snapshot.Type)
+	data, _ := json.Marshal(snapshot.Data)
+	assert.Contains(t, string(data), `"bids":[["100.5","1"],["100","1"]]`)
+}
+
+func TestHub_SubscriptionLimit(t *testing.T) {
+	// Arrange
+	config := testConfig()
+	config.MaxSubscriptions = 1
+	conn := newTestHub(t, &fakeSource{}, config)
+
+	// Act
+	require.NoError(t, conn.WriteJSON(Request{Op: OpSubscribe, Channel: ChannelTicker, Symbol: "BTCUSDT"}))
+	assert.Equal(t, TypeSubscribed, readMessage(t, conn).Type)
+	assert.Equal(t, TypeSnapshot, readMessage(t, conn).Type)
+
+	require.NoError(t, conn.WriteJSON(Request{Op: OpSubscribe, Channel: ChannelTicker, Symbol: "ETHUSDT"}))
+
+	// Assert
+	msg := readMessage(t, conn)
+	assert.Equal(t, TypeError, msg.Type)
+	assert.Equal(t, "SUBSCRIPTION_LIMIT", msg.Code)
+}
+
+func TestHub_InvalidRequests(t *testing.T) {
+	conn := newTestHub(t, &fakeSource{}, testConfig())
+
+	require.NoError(t, conn.WriteJSON(Request{Op: OpSubscribe, Channel: "trades", Symbol: "BTCUSDT"}))
+	assert.Equal(t, "INVALID_CHANNEL", readMessage(t, conn).Code)
+
+	require.NoError(t, conn.WriteJSON(Request{Op: OpSubscribe, Channel: ChannelKline, Symbol: "BTCUSDT", Interval: "7x"}))
+	assert.Equal(t, "INVALID_INTERVAL", readMessage(t, conn).Code)
+
+	require.NoError(t, conn.WriteJSON(Request{Op: OpSubscribe, Channel: ChannelTicker, Symbol: "X"}))
+	assert.Equal(t, "INVALID_SYMBOL", readMessage(t, conn).Code)
+
+	require.NoError(t, conn.WriteJSON(Request{Op: OpPing}))
+	assert.Equal(t, TypePong, readMessage(t, conn).Type)
+}
+
+func TestDiffLevels(t *testing.T) {
+	prev := levels([][]string{{"100", "1"}, {"99", "2"}, {"98", "1"}})
+	next := levels([][]string{{"100", "1.00"}, {"99", "5"}, {"97", "4"}})
+
+	changes, shifted := diffLevels(prev, next, true)
+	data, err := json.Marshal(changes)
+	require.NoError(t, err)
+	assert.False(t, shifted)
+	assert.JSONEq(t, `[["99","5"],["97","4"],["98","0"]]`, string(data))
+
+	_, shifted = diffLevels(prev, levels([][]string{{"101", "1"}, {"100", "1"}, {"99", "2"}}), true)
+	assert.True(t, shifted, "98 left the window")
+}
@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/provider"
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/internal/symbols"
+)
+
+const (
+	ChannelTicker = "ticker"
+	ChannelKline  = "kline"
+	ChannelDepth  = "depth"
+)
+
+const (
+	OpSubscribe   = "subscribe"
+	OpUnsubscribe = "unsubscribe"
+	OpPing        = "ping"
+)
+
+const (
+	TypeSnapshot     = "snapshot"
+	TypeUpdate       = "update"
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypeHeartbeat    = "heartbeat"
+	TypePong         = "pong"
+	TypeError        = "error"
+)
+
+// Request is a message sent by a client.
+type Request struct {
+	Op       string `json:"op"`
+	Channel  string `json:"channel"`
+	Symbol   string `json:"symbol"`
+	Interval string `json:"interval,omitempty"`
+}
+
+// Message is a message pushed to a client.
+type Message struct {
+	Type      string      `json:"type"`
+	Channel   string      `json:"channel,omitempty"`
+	Symbol    string      `json:"symbol,omitempty"`
+	Interval  string      `json:"interval,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Code      string      `json:"code,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Timestamp int64       `json:"timestamp"`
+}
+
+// Subscription identifies a channel for one pair (and interval for klines).
+// Symbol is the canonical spelling, so every spelling of a pair shares a topic.
+type Subscription struct {
+	Channel  string
+	Symbol   string
+	Pair     symbols.Pair
+	Interval string
+}
+
+func (s Subscription) key() string {
+	if s.Channel == ChannelKline {
+		return fmt.Sprintf("%s:%s:%s", s.Channel, s.Symbol, s.Interval)
+	}
+	return fmt.Sprintf("%s:%s", s.Channel, s.Symbol)
+}
+
+func (s Subscription) message(msgType string, data interface{}) Message {
+	return Message{
+		Type:      msgType,
+		Channel:   s.Channel,
+		Symbol:    s.Symbol,
+		Interval:  s.Interval,
+		Data:      data,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+func errorMessage(code, message string) Message {
+	return Message{
+		Type:      TypeError,
+		Code:      code,
+		Error:     message,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// DepthUpdate carries changed levels; a quantity of "0" removes the level.
+// When levels only drop out of the streamed depth, a snapshot replaces the
+// book instead.
+type DepthUpdate struct {
+	Bids []provider.Level `json:"bids"`
+	Asks []provider.Level `json:"asks"`
+}
@@ -0,0 +1,87 @@
+package symbols
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pair is the canonical identity of a trading pair, independent of how any
+// venue spells it. Assets are upper case with venue aliases resolved, so
+// XBT/USD and BTC-USD are the same pair.
+type Pair struct {
+	Base  string
+	Quote string
+}
+
+// String is the canonical form, e.g. "BTC-USDT".
+func (p Pair) String() string {
+	return p.Base + "-" + p.Quote
+}
+
+// Compact joins the assets without a separator, e.g. "BTCUSDT", as Binance
+// spells its symbols.
+func (p Pair) Compact() string {
+	return p.Base + p.Quote
+}
+
+func (p Pair) IsZero() bool {
+	return p.Base == "" && p.Quote == ""
+}
+
+// assetAliases maps venue-specific asset codes to the canonical ones.
+var assetAliases = map[string]string{
+	"XBT": "BTC",
+	"XDG": "DOGE",
+}
+
+// quoteAssets are tried, longest first, to split a symbol written without a
+// separator when it is not in the listing.
+var quoteAssets = []string{
+	"FDUSD", "USDT", "USDC", "BUSD", "TUSD",
+	"BTC", "ETH", "BNB", "DAI", "USD", "EUR", "GBP", "TRY", "BRL", "JPY",
+}
+
+// Parse reads a pair written as BASE-QUOTE, BASE/QUOTE, BASE_QUOTE or
+// BASEQUOTE, in any case. Without a separator the quote must be one of the
+// common quote assets; Registry.Resolve also knows every listed pair.
+func Parse(s string) (Pair, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	if i := strings.IndexAny(s, "-/_"); i >= 0 {
+		return newPair(s[:i], s[i+1:])
+	}
+
+	for _, quote := range quoteAssets {
+		if strings.HasSuffix(s, quote) && len(s) > len(quote) {
+			return newPair(strings.TrimSuffix(s, quote), quote)
+		}
+	}
+	return Pair{}, fmt.Errorf("%w: %q has no known quote asset", ErrInvalidSymbol, s)
+}
+
+func newPair(base, quote string) (Pair, error) {
+	if !validAsset(base) || !validAsset(quote) {
+		return Pair{}, fmt.Errorf("%w: %s/%s", ErrInvalidSymbol, base, quote)
+	}
+	return Pair{Base: canonicalAsset(base), Quote: canonicalAsset(quote)}, nil
+}
+
+func canonicalAsset(asset string) string {
+	if canonical, ok := assetAliases[asset]; ok {
+		return canonical
+	}
+	return asset
+}
+
+// validAsset accepts 1 to 12 upper case letters and digits.
+func validAsset(s string) bool {
+	if len(s) == 0 || len(s) > 12 {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package symbols
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]Pair{
+		"BTCUSDT":       {Base: "BTC", Quote: "USDT"},
+		"btc-usdt":      {Base: "BTC", Quote: "USDT"},
+		"BTC/USDT":      {Base: "BTC", Quote: "USDT"},
+		"XBT/USD":       {Base: "BTC", Quote: "USD"},
+		"ETHBTC":        {Base: "ETH", Quote: "BTC"},
+		"PEPEFDUSD":     {Base: "PEPE", Quote: "FDUSD"},
+		"1000SATS_USDT": {Base: "1000SATS", Quote: "USDT"},
+	}
+	for input, want := range cases {
+		pair, err := Parse(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, pair, input)
+	}
+
+	for _, invalid := range []string{"", "USDT", "BTCXYZ", "BTC-", "-USDT", "BTC-US-DT", "BTC USDT"} {
+		_, err := Parse(invalid)
+		assert.ErrorIs(t, err, ErrInvalidSymbol, invalid)
+	}
+}
+
+func TestPair_Format(t *testing.T) {
+	pair := Pair{Base: "BTC", Quote: "USDT"}
+
+	assert.Equal(t, "BTC-USDT", pair.String())
+	assert.Equal(t, "BTCUSDT", pair.Compact())
+}
@@ -0,0 +1,264 @@
+package symbols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+)
+
+// StatusTrading is the status of symbols open for trading.
+const StatusTrading = "TRADING"
+
+var (
+	// ErrInvalidSymbol is returned for strings that cannot be a symbol.
+	ErrInvalidSymbol = errors.New("symbol format is invalid")
+	// ErrUnknownSymbol is returned for well-formed symbols that are not listed.
+	ErrUnknownSymbol = errors.New("symbol is not listed")
+)
+
+// Symbol is a listed trading pair with its order rules. Zero sizes mean the
+// venue does not apply that rule.
+type Symbol struct {
+	Pair Pair `json:"-"`
+	// Symbol is the canonical form of Pair
+	Symbol string `json:"symbol"`
+	// VenueSymbols spells the pair for each venue that serves it
+	VenueSymbols map[string]string `json:"venueSymbols,omitempty"`
+	BaseAsset    string            `json:"baseAsset"`
+	QuoteAsset   string            `json:"quoteAsset"`
+	Status       string            `json:"status"`
+	TickSize     decimal.Decimal   `json:"tickSize"`
+	MinPrice     decimal.Decimal   `json:"minPrice"`
+	MaxPrice     decimal.Decimal   `json:"maxPrice"`
+	StepSize     decimal.Decimal   `json:"stepSize"`
+	MinQty       decimal.Decimal   `json:"minQty"`
+	MaxQty       decimal.Decimal   `json:"maxQty"`
+	MinNotional  decimal.Decimal   `json:"minNotional"`
+}
+
+// PricePrecision is the number of decimal places in the tick size.
+func (s Symbol) PricePrecision() int32 {
+	return places(s.TickSize)
+}
+
+// QuantityPrecision is the number of decimal places in the lot step size.
+func (s Symbol) QuantityPrecision() int32 {
+	return places(s.StepSize)
+}
+
+// places counts significant decimal places; String drops trailing zeros,
+// so "0.01000000" has two.
+func places(d decimal.Decimal) int32 {
+	s := d.String()
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return int32(len(s) - i - 1)
+	}
+	return 0
+}
+
+// ExchangeInfoFetcher loads trading rules; *client.BinanceClient implements it.
+type ExchangeInfoFetcher interface {
+	GetExchangeInfo(ctx context.Context) (*client.BinanceExchangeInfo, error)
+}
+
+type Config struct {
+	RefreshInterval time.Duration
+	// RetryInterval replaces RefreshInterval after a failed refresh
+	RetryInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		RefreshInterval: 1 * time.Hour,
+		RetryInterval:   1 * time.Minute,
+	}
+}
+
+// Registry holds the symbols listed on Binance, refreshed periodically from
+// exchangeInfo. A failed refresh keeps the previous listing.
+type Registry struct {
+	fetcher ExchangeInfoFetcher
+	config  Config
+
+	mu      sync.RWMutex
+	symbols map[Pair]Symbol
+	// byVenueSymbol resolves Binance's separator-less spelling exactly
+	byVenueSymbol map[string]Pair
+	updatedAt     time.Time
+
+	// Cancelled by Close, ending a refresh in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewRegistry(fetcher ExchangeInfoFetcher, config Config) *Registry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registry{
+		fetcher: fetcher,
+		config:  config,
+		ctx:     ctx,
+		cancel:  cancel,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start refreshes the listing until Close is called. The first refresh
+// happens one interval in; call Refresh beforehand to load it immediately.
+func (r *Registry) Start() {
+	go func() {
+		defer close(r.done)
+
+		wait := r.config.RefreshInterval
+		if !r.Loaded() {
+			wait = r.config.RetryInterval
+		}
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-time.After(wait):
+			}
+
+			wait = r.config.RefreshInterval
+			if err := r.Refresh(); err != nil {
+				log.Warn().Err(err).Msg("Symbol registry refresh failed")
+				wait = r.config.RetryInterval
+			}
+		}
+	}()
+}
+
+func (r *Registry) Close() {
+	r.cancel()
+	close(r.stop)
+	<-r.done
+}
+
+// Refresh replaces the listing with the current exchangeInfo.
+func (r *Registry) Refresh() error {
+	info, err := r.fetcher.GetExchangeInfo(r.ctx)
+	if err != nil {
+		return err
+	}
+	if len(info.Symbols) == 0 {
+		return fmt.Errorf("exchange info lists no symbols")
+	}
+
+	listing := make(map[Pair]Symbol, len(info.Symbols))
+	byVenueSymbol := make(map[string]Pair, len(info.Symbols))
+	for _, s := range info.Symbols {
+		symbol, err := fromBinance(s)
+		if err != nil {
+			log.Debug().Err(err).Str("symbol", s.Symbol).Msg("Skipping unparseable listed symbol")
+			continue
+		}
+		listing[symbol.Pair] = symbol
+		byVenueSymbol[s.Symbol] = symbol.Pair
+	}
+
+	r.mu.Lock()
+	r.symbols = listing
+	r.byVenueSymbol = byVenueSymbol
+	r.updatedAt = time.Now()
+	r.mu.Unlock()
+
+	log.Info().Int("symbols", len(listing)).Msg("Symbol registry refreshed")
+	return nil
+}
+
+func fromBinance(s client.BinanceSymbol) (Symbol, error) {
+	pair, err := newPair(s.BaseAsset, s.QuoteAsset)
+	if err != nil {
+		return Symbol{}, err
+	}
+
+	symbol := Symbol{
+		Pair:       pair,
+		Symbol:     pair.String(),
+		BaseAsset:  s.BaseAsset,
+		QuoteAsset: s.QuoteAsset,
+		Status:     s.Status,
+	}
+	for _, f := range s.Filters {
+		switch f.FilterType {
+		case "PRICE_FILTER":
+			symbol.TickSize, symbol.MinPrice, symbol.MaxPrice = f.TickSize, f.MinPrice, f.MaxPrice
+		case "LOT_SIZE":
+			symbol.StepSize, symbol.MinQty, symbol.MaxQty = f.StepSize, f.MinQty, f.MaxQty
+		case "MIN_NOTIONAL", "NOTIONAL":
+			// Binance is migrating MIN_NOTIONAL to NOTIONAL; symbols carry one or the other
+			symbol.MinNotional = f.MinNotional
+		}
+	}
+	return symbol, nil
+}
+
+// Loaded reports whether a listing has been loaded.
+func (r *Registry) Loaded() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.symbols != nil
+}
+
+// UpdatedAt is when the listing was last refreshed.
+func (r *Registry) UpdatedAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.updatedAt
+}
+
+func (r *Registry) Lookup(pair Pair) (Symbol, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.symbols[pair]
+	return s, ok
+}
+
+// All returns every listed symbol, sorted by name.
+func (r *Registry) All() []Symbol {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]Symbol, 0, len(r.symbols))
+	for _, s := range r.symbols {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Symbol < result[j].Symbol })
+	return result
+}
+
+// Resolve parses a symbol in any accepted spelling and checks that the pair
+// is listed. Until a listing is loaded, any well-formed symbol is accepted
+// so an exchangeInfo outage does not take market data down with it.
+func (r *Registry) Resolve(symbol string) (Pair, error) {
+	r.mu.RLock()
+	pair, exact := r.byVenueSymbol[strings.ToUpper(strings.TrimSpace(symbol))]
+	loaded := r.symbols != nil
+	r.mu.RUnlock()
+	if exact {
+		return pair, nil
+	}
+
+	pair, err := Parse(symbol)
+	if err != nil {
+		return Pair{}, err
+	}
+	if !loaded {
+		return pair, nil
+	}
+	if _, ok := r.Lookup(pair); !ok {
+		return Pair{}, fmt.Errorf("%w: %s", ErrUnknownSymbol, pair)
+	}
+	return pair, nil
+}
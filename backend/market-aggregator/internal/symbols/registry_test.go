@@ -0,0 +1,117 @@
+package symbols
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFetcher struct {
+	info *client.BinanceExchangeInfo
+	err  error
+}
+
+func (f *fakeFetcher) GetExchangeInfo(ctx context.Context) (*client.BinanceExchangeInfo, error) {
+	return f.info, f.err
+}
+
+func exchangeInfo() *client.BinanceExchangeInfo {
+	dec := decimal.RequireFromString
+	return &client.BinanceExchangeInfo{Symbols: []client.BinanceSymbol{
+		{Symbol: "BTCUSDT", Status: StatusTrading, BaseAsset: "BTC", QuoteAsset: "USDT", Filters: []client.BinanceSymbolFilter{
+			{FilterType: "PRICE_FILTER", MinPrice: dec("0.01000000"), MaxPrice: dec("1000000.00000000"), TickSize: dec("0.01000000")},
+			{FilterType: "LOT_SIZE", MinQty: dec("0.00001000"), MaxQty: dec("9000.00000000"), StepSize: dec("0.00001000")},
+			{FilterType: "NOTIONAL", MinNotional: dec("5.00000000")},
+		}},
+		{Symbol: "SHIBUSDT", Status: StatusTrading, BaseAsset: "SHIB", QuoteAsset: "USDT", Filters: []client.BinanceSymbolFilter{
+			{FilterType: "PRICE_FILTER", TickSize: dec("0.00000001")},
+			{FilterType: "LOT_SIZE", StepSize: dec("1.00")},
+			{FilterType: "MIN_NOTIONAL", MinNotional: dec("1")},
+		}},
+		{Symbol: "LUNAUSDT", Status: "BREAK", BaseAsset: "LUNA", QuoteAsset: "USDT"},
+		{Symbol: "BTCIDR", Status: StatusTrading, BaseAsset: "BTC", QuoteAsset: "IDR"},
+	}}
+}
+
+func TestRegistry_Refresh(t *testing.T) {
+	// Arrange
+	registry := NewRegistry(&fakeFetcher{info: exchangeInfo()}, DefaultConfig())
+
+	// Act
+	require.NoError(t, registry.Refresh())
+
+	// Assert
+	btc, ok := registry.Lookup(Pair{Base: "BTC", Quote: "USDT"})
+	require.True(t, ok)
+	assert.Equal(t, "BTC-USDT", btc.Symbol)
+	assert.Equal(t, "BTC", btc.BaseAsset)
+	assert.Equal(t, "0.01", btc.TickSize.String())
+	assert.Equal(t, "9000", btc.MaxQty.String())
+	assert.Equal(t, "5", btc.MinNotional.String())
+	assert.Equal(t, int32(2), btc.PricePrecision())
+	assert.Equal(t, int32(5), btc.QuantityPrecision())
+
+	shib, _ := registry.Lookup(Pair{Base: "SHIB", Quote: "USDT"})
+	assert.Equal(t, int32(8), shib.PricePrecision())
+	assert.Equal(t, int32(0), shib.QuantityPrecision())
+	assert.Equal(t, "1", shib.MinNotional.String())
+
+	all := registry.All()
+	require.Len(t, all, 4)
+	assert.Equal(t, "BTC-IDR", all[0].Symbol)
+	assert.Equal(t, "BTC-USDT", all[1].Symbol)
+}
+
+func TestRegistry_FailedRefreshKeepsListing(t *testing.T) {
+	fetcher := &fakeFetcher{info: exchangeInfo()}
+	registry := NewRegistry(fetcher, DefaultConfig())
+	require.NoError(t, registry.Refresh())
+
+	fetcher.info, fetcher.err = nil, errors.New("API error")
+	assert.Error(t, registry.Refresh())
+
+	fetcher.info, fetcher.err = &client.BinanceExchangeInfo{}, nil
+	assert.Error(t, registry.Refresh())
+
+	_, ok := registry.Lookup(Pair{Base: "BTC", Quote: "USDT"})
+	assert.True(t, ok)
+}
+
+func TestRegistry_Resolve(t *testing.T) {
+	registry := NewRegistry(&fakeFetcher{info: exchangeInfo()}, DefaultConfig())
+	btcusdt := Pair{Base: "BTC", Quote: "USDT"}
+
+	// Before the first load only the format is checked
+	pair, err := registry.Resolve("AAA-USDT")
+	require.NoError(t, err)
+	assert.Equal(t, "AAA-USDT", pair.String())
+	_, err = registry.Resolve("BTC")
+	assert.ErrorIs(t, err, ErrInvalidSymbol)
+
+	require.NoError(t, registry.Refresh())
+
+	for _, spelling := range []string{"BTCUSDT", "BTC-USDT", "btc/usdt", "btc_usdt", " XBT-USDT "} {
+		pair, err := registry.Resolve(spelling)
+		require.NoError(t, err, spelling)
+		assert.Equal(t, btcusdt, pair, spelling)
+	}
+
+	// IDR is not a common quote asset, but the listing splits it exactly
+	pair, err = registry.Resolve("btcidr")
+	require.NoError(t, err)
+	assert.Equal(t, Pair{Base: "BTC", Quote: "IDR"}, pair)
+
+	_, err = registry.Resolve("LUNAUSDT")
+	assert.NoError(t, err)
+	_, err = registry.Resolve("AAA-USDT")
+	assert.ErrorIs(t, err, ErrUnknownSymbol)
+	_, err = registry.Resolve("")
+	assert.ErrorIs(t, err, ErrInvalidSymbol)
+	_, err = registry.Resolve("BTC-US DT")
+	assert.ErrorIs(t, err, ErrInvalidSymbol)
+}
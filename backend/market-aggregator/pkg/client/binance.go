@@ -1,67 +1,170 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type BinanceClient struct {
 	baseURL    string
 	httpClient *http.Client
+	limiter    *RateLimiter
+	retry      RetryPolicy
 }
 
 type BinanceTicker struct {
-	Symbol             string `json:"symbol"`
-	PriceChange        string `json:"priceChange"`
-	PriceChangePercent string `json:"priceChangePercent"`
-	WeightedAvgPrice   string `json:"weightedAvgPrice"`
-	PrevClosePrice     string `json:"prevClosePrice"`
-	LastPrice          string `json:"lastPrice"`
-	LastQty            string `json:"lastQty"`
-	BidPrice           string `json:"bidPrice"`
-	BidQty             string `json:"bidQty"`
-	AskPrice           string `json:"askPrice"`
-	AskQty             string `json:"askQty"`
-	OpenPrice          string `json:"openPrice"`
-	HighPrice          string `json:"highPrice"`
-	LowPrice           string `json:"lowPrice"`
-	Volume             string `json:"volume"`
-	QuoteVolume        string `json:"quoteVolume"`
-	OpenTime           int64  `json:"openTime"`
-	CloseTime          int64  `json:"closeTime"`
-	Count              int    `json:"count"`
+	Symbol             string          `json:"symbol"`
+	PriceChange        decimal.Decimal `json:"priceChange"`
+	PriceChangePercent decimal.Decimal `json:"priceChangePercent"`
+	WeightedAvgPrice   decimal.Decimal `json:"weightedAvgPrice"`
+	PrevClosePrice     decimal.Decimal `json:"prevClosePrice"`
+	LastPrice          decimal.Decimal `json:"lastPrice"`
+	LastQty            decimal.Decimal `json:"lastQty"`
+	BidPrice           decimal.Decimal `json:"bidPrice"`
+	BidQty             decimal.Decimal `json:"bidQty"`
+	AskPrice           decimal.Decimal `json:"askPrice"`
+	AskQty             decimal.Decimal `json:"askQty"`
+	OpenPrice          decimal.Decimal `json:"openPrice"`
+	HighPrice          decimal.Decimal `json:"highPrice"`
+	LowPrice           decimal.Decimal `json:"lowPrice"`
+	Volume             decimal.Decimal `json:"volume"`
+	QuoteVolume        decimal.Decimal `json:"quoteVolume"`
+	OpenTime           int64           `json:"openTime"`
+	CloseTime          int64           `json:"closeTime"`
+	Count              int             `json:"count"`
+}
+
+// BinanceKline is one row of /api/v3/klines. Binance encodes each candle as
+// a positional array mixing numbers and strings.
+type BinanceKline struct {
+	OpenTime                 int64
+	Open                     decimal.Decimal
+	High                     decimal.Decimal
+	Low                      decimal.Decimal
+	Close                    decimal.Decimal
+	Volume                   decimal.Decimal
+	CloseTime                int64
+	QuoteAssetVolume         decimal.Decimal
+	NumberOfTrades           int64
+	TakerBuyBaseAssetVolume  decimal.Decimal
+	TakerBuyQuoteAssetVolume decimal.Decimal
 }
 
+// BinanceLevel is a [price, quantity] order book level.
+type BinanceLevel [2]decimal.Decimal
+
 type BinanceDepth struct {
-	LastUpdateId int64      `json:"lastUpdateId"`
-	Bids         [][]string `json:"bids"`
-	Asks         [][]string `json:"asks"`
+	LastUpdateId int64          `json:"lastUpdateId"`
+	Bids         []BinanceLevel `json:"bids"`
+	Asks         []BinanceLevel `json:"asks"`
 }
 
-func NewBinanceClient() *BinanceClient {
+type BinanceExchangeInfo struct {
+	ServerTime int64           `json:"serverTime"`
+	Symbols    []BinanceSymbol `json:"symbols"`
+}
+
+type BinanceSymbol struct {
+	Symbol     string                `json:"symbol"`
+	Status     string                `json:"status"`
+	BaseAsset  string                `json:"baseAsset"`
+	QuoteAsset string                `json:"quoteAsset"`
+	Filters    []BinanceSymbolFilter `json:"filters"`
+}
+
+// BinanceSymbolFilter holds the fields of the PRICE_FILTER, LOT_SIZE,
+// MIN_NOTIONAL and NOTIONAL filters; fields of other filter types are ignored.
+type BinanceSymbolFilter struct {
+	FilterType  string          `json:"filterType"`
+	MinPrice    decimal.Decimal `json:"minPrice"`
+	MaxPrice    decimal.Decimal `json:"maxPrice"`
+	TickSize    decimal.Decimal `json:"tickSize"`
+	MinQty      decimal.Decimal `json:"minQty"`
+	MaxQty      decimal.Decimal `json:"maxQty"`
+	StepSize    decimal.Decimal `json:"stepSize"`
+	MinNotional decimal.Decimal `json:"minNotional"`
+}
+
+// ClientConfig locates a venue's REST API. Timeout bounds every attempt,
+// reading the response included; Retry decides which failed attempts are
+// repeated.
+type ClientConfig struct {
+	BaseURL string
+	Timeout time.Duration
+	Retry   RetryPolicy
+}
+
+func DefaultBinanceConfig() ClientConfig {
+	return ClientConfig{
+		BaseURL: "https://api.binance.com",
+		Timeout: 10 * time.Second,
+		Retry:   DefaultRetryPolicy(),
+	}
+}
+
+func NewBinanceClient(config ClientConfig) *BinanceClient {
 	return &BinanceClient{
-		baseURL: "https://api.binance.com",
+		baseURL: config.BaseURL,
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout: config.Timeout,
 		},
+		limiter: NewRateLimiter("binance", DefaultBinanceRateLimit()),
+		retry:   config.Retry,
 	}
 }
 
-func (c *BinanceClient) Get24hrTicker(symbol string) (*BinanceTicker, error) {
+// UseRateLimiter replaces the default request weight budget.
+func (c *BinanceClient) UseRateLimiter(limiter *RateLimiter) {
+	c.limiter = limiter
+}
+
+// RateLimiter returns the request weight budget shared by all calls.
+func (c *BinanceClient) RateLimiter() *RateLimiter {
+	return c.limiter
+}
+
+// tickersWeight is the request weight of /api/v3/ticker/24hr for count
+// symbols; zero means all symbols.
+func tickersWeight(count int) int {
+	switch {
+	case count == 0 || count > 100:
+		return 80
+	case count > 20:
+		return 40
+	}
+	return 2
+}
+
+// depthWeight is the request weight of /api/v3/depth at limit.
+func depthWeight(limit int) int {
+	switch {
+	case limit <= 100:
+		return 5
+	case limit <= 500:
+		return 25
+	case limit <= 1000:
+		return 50
+	}
+	return 250
+}
+
+func (c *BinanceClient) Get24hrTicker(ctx context.Context, symbol string) (*BinanceTicker, error) {
 	url := fmt.Sprintf("%s/api/v3/ticker/24hr?symbol=%s", c.baseURL, symbol)
 	
-	resp, err := c.httpClient.Get(url)
+	resp, err := do(ctx, c.httpClient, c.limiter, c.retry, "ticker/24hr", tickersWeight(1), url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch ticker: %v", err)
+		return nil, fmt.Errorf("failed to fetch ticker: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("binance API error: %d - %s", resp.StatusCode, string(body))
+		return nil, apiError("binance", resp)
 	}
 
 	var ticker BinanceTicker
@@ -72,22 +175,64 @@ func (c *BinanceClient) Get24hrTicker(symbol string) (*BinanceTicker, error) {
 	return &ticker, nil
 }
 
-func (c *BinanceClient) GetKlines(symbol, interval string, limit int) ([][]interface{}, error) {
-	url := fmt.Sprintf("%s/api/v3/klines?symbol=%s&interval=%s&limit=%d", 
+// Get24hrTickers fetches the 24h tickers of symbols in one call, or of every
+// symbol when symbols is empty. Binance rejects the whole call if any symbol
+// is not listed.
+func (c *BinanceClient) Get24hrTickers(ctx context.Context, symbols []string) ([]BinanceTicker, error) {
+	endpoint := fmt.Sprintf("%s/api/v3/ticker/24hr", c.baseURL)
+	if len(symbols) > 0 {
+		list, err := json.Marshal(symbols)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode symbols: %v", err)
+		}
+		endpoint += "?symbols=" + url.QueryEscape(string(list))
+	}
+
+	resp, err := do(ctx, c.httpClient, c.limiter, c.retry, "ticker/24hr", tickersWeight(len(symbols)), endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tickers: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError("binance", resp)
+	}
+
+	var tickers []BinanceTicker
+	if err := json.NewDecoder(resp.Body).Decode(&tickers); err != nil {
+		return nil, fmt.Errorf("failed to decode tickers response: %v", err)
+	}
+
+	return tickers, nil
+}
+
+func (c *BinanceClient) GetKlines(ctx context.Context, symbol, interval string, limit int) ([]BinanceKline, error) {
+	return c.GetKlinesRange(ctx, symbol, interval, 0, 0, limit)
+}
+
+// GetKlinesRange fetches klines between startTime and endTime (Unix ms,
+// inclusive). A zero bound is left to Binance's default.
+func (c *BinanceClient) GetKlinesRange(ctx context.Context, symbol, interval string, startTime, endTime int64, limit int) ([]BinanceKline, error) {
+	url := fmt.Sprintf("%s/api/v3/klines?symbol=%s&interval=%s&limit=%d",
 		c.baseURL, symbol, interval, limit)
-	
-	resp, err := c.httpClient.Get(url)
+	if startTime > 0 {
+		url += fmt.Sprintf("&startTime=%d", startTime)
+	}
+	if endTime > 0 {
+		url += fmt.Sprintf("&endTime=%d", endTime)
+	}
+
+	resp, err := do(ctx, c.httpClient, c.limiter, c.retry, "klines", 2, url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch klines: %v", err)
+		return nil, fmt.Errorf("failed to fetch klines: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("binance API error: %d - %s", resp.StatusCode, string(body))
+		return nil, apiError("binance", resp)
 	}
 
-	var klines [][]interface{}
+	var klines []BinanceKline
 	if err := json.NewDecoder(resp.Body).Decode(&klines); err != nil {
 		return nil, fmt.Errorf("failed to decode klines response: %v", err)
 	}
@@ -95,18 +240,17 @@ func (c *BinanceClient) GetKlines(symbol, interval string, limit int) ([][]inter
 	return klines, nil
 }
 
-func (c *BinanceClient) GetDepth(symbol string, limit int) (*BinanceDepth, error) {
+func (c *BinanceClient) GetDepth(ctx context.Context, symbol string, limit int) (*BinanceDepth, error) {
 	url := fmt.Sprintf("%s/api/v3/depth?symbol=%s&limit=%d", c.baseURL, symbol, limit)
 	
-	resp, err := c.httpClient.Get(url)
+	resp, err := do(ctx, c.httpClient, c.limiter, c.retry, "depth", depthWeight(limit), url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch depth: %v", err)
+		return nil, fmt.Errorf("failed to fetch depth: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("binance API error: %d - %s", resp.StatusCode, string(body))
+		return nil, apiError("binance", resp)
 	}
 
 	var depth BinanceDepth
@@ -115,4 +259,49 @@ func (c *BinanceClient) GetDepth(symbol string, limit int) (*BinanceDepth, error
 	}
 
 	return &depth, nil
-}
\ No newline at end of file
+}
+
+// GetExchangeInfo fetches trading rules for every listed symbol.
+func (c *BinanceClient) GetExchangeInfo(ctx context.Context) (*BinanceExchangeInfo, error) {
+	url := fmt.Sprintf("%s/api/v3/exchangeInfo", c.baseURL)
+
+	resp, err := do(ctx, c.httpClient, c.limiter, c.retry, "exchangeInfo", 20, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError("binance", resp)
+	}
+
+	var info BinanceExchangeInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange info response: %v", err)
+	}
+
+	return &info, nil
+}
+
+func (k *BinanceKline) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("kline is not an array: %v", err)
+	}
+	if len(fields) < 11 {
+		return fmt.Errorf("kline has %d fields, expected at least 11", len(fields))
+	}
+
+	targets := []interface{}{
+		&k.OpenTime, &k.Open, &k.High, &k.Low, &k.Close, &k.Volume,
+		&k.CloseTime, &k.QuoteAssetVolume, &k.NumberOfTrades,
+		&k.TakerBuyBaseAssetVolume, &k.TakerBuyQuoteAssetVolume,
+	}
+	for i, target := range targets {
+		if err := json.Unmarshal(fields[i], target); err != nil {
+			return fmt.Errorf("invalid kline field %d: %v", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const BinanceStreamURL = "wss://stream.binance.com:9443"
+
+// DefaultStreamReadTimeout is how long a stream may stay silent, neither
+// sending an event nor answering a ping, before Read gives up on it. Binance
+// pings every 20 seconds and we ping at a third of the timeout.
+const DefaultStreamReadTimeout = time.Minute
+
+const streamWriteTimeout = 10 * time.Second
+
+type BinanceStreamClient struct {
+	baseURL     string
+	dialer      *websocket.Dialer
+	readTimeout time.Duration
+}
+
+// BinanceDepthEvent is a diff-depth update. U and u are the first and last
+// update IDs covered by the event.
+type BinanceDepthEvent struct {
+	EventType     string         `json:"e"`
+	EventTime     int64          `json:"E"`
+	Symbol        string         `json:"s"`
+	FirstUpdateId int64          `json:"U"`
+	FinalUpdateId int64          `json:"u"`
+	Bids          []BinanceLevel `json:"b"`
+	Asks          []BinanceLevel `json:"a"`
+}
+
+// BinanceDepthStream is an open diff-depth WebSocket stream for one symbol.
+// Its read deadline is extended by every event, ping and pong, so a stream
+// that goes silent or half-open fails Read instead of blocking it forever.
+type BinanceDepthStream struct {
+	conn        *websocket.Conn
+	readTimeout time.Duration
+	// Unix nanoseconds of the last event, ping or pong
+	lastSeen  atomic.Int64
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewBinanceStreamClient(baseURL string) *BinanceStreamClient {
+	return &BinanceStreamClient{
+		baseURL: baseURL,
+		dialer: &websocket.Dialer{
+			HandshakeTimeout: 10 * time.Second,
+		},
+		readTimeout: DefaultStreamReadTimeout,
+	}
+}
+
+// SetReadTimeout sets how long a stream may stay silent before Read fails.
+func (c *BinanceStreamClient) SetReadTimeout(timeout time.Duration) {
+	c.readTimeout = timeout
+}
+
+// DialDepth opens the 100ms diff-depth stream for symbol. Cancelling ctx
+// aborts the handshake; it does not affect the stream once open.
+func (c *BinanceStreamClient) DialDepth(ctx context.Context, symbol string) (*BinanceDepthStream, error) {
+	url := fmt.Sprintf("%s/ws/%s@depth@100ms", c.baseURL, strings.ToLower(symbol))
+
+	// The dialer only applies ctx's deadline to the handshake, so the
+	// connection is closed if ctx is cancelled before it completes
+	var stop func() bool
+	dialer := *c.dialer
+	dialer.NetDialContext = func(dialCtx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(dialCtx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		stop = context.AfterFunc(ctx, func() { conn.Close() })
+		return conn, nil
+	}
+
+	conn, _, err := dialer.DialContext(ctx, url, nil)
+	if stop != nil && !stop() && err == nil {
+		conn.Close()
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open depth stream: %v", err)
+	}
+
+	s := &BinanceDepthStream{conn: conn, readTimeout: c.readTimeout, done: make(chan struct{})}
+	s.alive()
+	conn.SetPongHandler(func(string) error {
+		s.alive()
+		return nil
+	})
+	conn.SetPingHandler(func(data string) error {
+		s.alive()
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(streamWriteTimeout))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	go s.ping()
+
+	return s, nil
+}
+
+// Read blocks until the next depth event arrives or the read deadline passes.
+func (s *BinanceDepthStream) Read() (*BinanceDepthEvent, error) {
+	var event BinanceDepthEvent
+	if err := s.conn.ReadJSON(&event); err != nil {
+		return nil, fmt.Errorf("failed to read depth event: %v", err)
+	}
+	s.alive()
+	return &event, nil
+}
+
+func (s *BinanceDepthStream) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return s.conn.Close()
+}
+
+// LastSeen is when the stream last sent an event, ping or pong, that is when
+// it was last known to be live.
+func (s *BinanceDepthStream) LastSeen() time.Time {
+	return time.Unix(0, s.lastSeen.Load())
+}
+
+// alive records that the stream is live and extends its read deadline.
+func (s *BinanceDepthStream) alive() {
+	now := time.Now()
+	s.lastSeen.Store(now.UnixNano())
+	s.conn.SetReadDeadline(now.Add(s.readTimeout))
+}
+
+// ping keeps a quiet but healthy stream alive; the pongs extend the deadline.
+func (s *BinanceDepthStream) ping() {
+	ticker := time.NewTicker(s.readTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinanceKline_UnmarshalJSON(t *testing.T) {
+	// Verbatim row shape from /api/v3/klines
+	data := `[[1499040000000,"0.01634790","0.80000000","0.01575800","0.01577100","148976.11427815",1499644799999,"2434.19055334",308,"1756.87402397","28.46694368","0"]]`
+
+	var klines []BinanceKline
+	require.NoError(t, json.Unmarshal([]byte(data), &klines))
+	require.Len(t, klines, 1)
+
+	assert.Equal(t, BinanceKline{
+		OpenTime:                 1499040000000,
+		Open:                     decimal.RequireFromString("0.01634790"),
+		High:                     decimal.RequireFromString("0.80000000"),
+		Low:                      decimal.RequireFromString("0.01575800"),
+		Close:                    decimal.RequireFromString("0.01577100"),
+		Volume:                   decimal.RequireFromString("148976.11427815"),
+		CloseTime:                1499644799999,
+		QuoteAssetVolume:         decimal.RequireFromString("2434.19055334"),
+		NumberOfTrades:           308,
+		TakerBuyBaseAssetVolume:  decimal.RequireFromString("1756.87402397"),
+		TakerBuyQuoteAssetVolume: decimal.RequireFromString("28.46694368"),
+	}, klines[0])
+}
+
+func TestBinanceKline_UnmarshalJSON_Malformed(t *testing.T) {
+	var kline BinanceKline
+
+	assert.Error(t, json.Unmarshal([]byte(`[1499040000000,"0.0163"]`), &kline))
+	assert.Error(t, json.Unmarshal([]byte(`{"openTime":1}`), &kline))
+	assert.Error(t, json.Unmarshal([]byte(`["x","1","1","1","1","1",1,"1",1,"1","1"]`), &kline))
+}
+
+func TestBinanceClient_GetExchangeInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v3/exchangeInfo", r.URL.Path)
+		w.Write([]byte(`{"serverTime":1700000000000,"symbols":[{"symbol":"BTCUSDT","status":"TRADING","baseAsset":"BTC","quoteAsset":"USDT","filters":[
+			{"filterType":"PRICE_FILTER","minPrice":"0.01000000","maxPrice":"1000000.00000000","tickSize":"0.01000000"},
+			{"filterType":"LOT_SIZE","minQty":"0.00001000","maxQty":"9000.00000000","stepSize":"0.00001000"},
+			{"filterType":"ICEBERG_PARTS","limit":10},
+			{"filterType":"NOTIONAL","minNotional":"5.00000000","applyMinToMarket":true,"maxNotional":"9000000.00000000"}
+		]}]}`))
+	}))
+	defer server.Close()
+
+	c := NewBinanceClient(DefaultBinanceConfig())
+	c.baseURL = server.URL
+
+	info, err := c.GetExchangeInfo(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, info.Symbols, 1)
+	symbol := info.Symbols[0]
+	assert.Equal(t, "BTC", symbol.BaseAsset)
+	require.Len(t, symbol.Filters, 4)
+	assert.Equal(t, "0.01", symbol.Filters[0].TickSize.String())
+	assert.Equal(t, "0.00001", symbol.Filters[1].StepSize.String())
+	assert.Equal(t, "5", symbol.Filters[3].MinNotional.String())
+}
+
+func TestBinanceClient_Get24hrTickers(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v3/ticker/24hr", r.URL.Path)
+		queries = append(queries, r.URL.Query().Get("symbols"))
+		w.Write([]byte(`[{"symbol":"BTCUSDT","lastPrice":"26543.21"},{"symbol":"ETHUSDT","lastPrice":"1650.5"}]`))
+	}))
+	defer server.Close()
+
+	c := NewBinanceClient(DefaultBinanceConfig())
+	c.baseURL = server.URL
+
+	tickers, err := c.Get24hrTickers(context.Background(), []string{"BTCUSDT", "ETHUSDT"})
+	require.NoError(t, err)
+	require.Len(t, tickers, 2)
+	assert.Equal(t, "1650.5", tickers[1].LastPrice.String())
+
+	_, err = c.Get24hrTickers(context.Background(), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{`["BTCUSDT","ETHUSDT"]`, ""}, queries)
+}
@@ -1,103 +1,184 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type CoinGeckoClient struct {
 	baseURL    string
 	httpClient *http.Client
+	limiter    *RateLimiter
+	retry      RetryPolicy
 }
 
+// CoinGeckoPrice is a coin's price in one currency, exactly as sent;
+// CoinGecko uses JSON numbers, sometimes in exponent form for tiny prices.
 type CoinGeckoPrice struct {
-	USD float64 `json:"usd"`
+	ID       string
+	Currency string
+	Price    decimal.Decimal
+}
+
+// CoinGeckoMarket is a coin's market data in one currency from /coins/markets.
+// CoinGecko sends null for statistics it does not have, so those are nullable.
+// TotalVolume is the 24h volume across all venues, in the quote currency.
+type CoinGeckoMarket struct {
+	ID                       string              `json:"id"`
+	Symbol                   string              `json:"symbol"`
+	CurrentPrice             decimal.Decimal     `json:"current_price"`
+	MarketCap                decimal.NullDecimal `json:"market_cap"`
+	TotalVolume              decimal.NullDecimal `json:"total_volume"`
+	High24h                  decimal.NullDecimal `json:"high_24h"`
+	Low24h                   decimal.NullDecimal `json:"low_24h"`
+	PriceChangePercentage24h decimal.NullDecimal `json:"price_change_percentage_24h"`
+	LastUpdated              time.Time           `json:"last_updated"`
 }
 
-func NewCoinGeckoClient() *CoinGeckoClient {
+// CoinGeckoCoin is an entry of /coins/list. Symbol is the lower-case ticker,
+// which many coins share.
+type CoinGeckoCoin struct {
+	ID     string `json:"id"`
+	Symbol string `json:"symbol"`
+	Name   string `json:"name"`
+}
+
+func DefaultCoinGeckoConfig() ClientConfig {
+	return ClientConfig{
+		BaseURL: "https://api.coingecko.com/api/v3",
+		Timeout: 15 * time.Second,
+		Retry:   DefaultRetryPolicy(),
+	}
+}
+
+func NewCoinGeckoClient(config ClientConfig) *CoinGeckoClient {
 	return &CoinGeckoClient{
-		baseURL: "https://api.coingecko.com/api/v3",
+		baseURL: config.BaseURL,
 		httpClient: &http.Client{
-			Timeout: 15 * time.Second,
+			Timeout: config.Timeout,
 		},
+		limiter: NewRateLimiter("coingecko", DefaultCoinGeckoRateLimit()),
+		retry:   config.Retry,
 	}
 }
 
-func (c *CoinGeckoClient) GetPrice(symbol string) (*CoinGeckoPrice, error) {
-	// Convert trading pair to CoinGecko format
-	coinId := c.symbolToCoinGeckoId(symbol)
-	if coinId == "" {
-		return nil, fmt.Errorf("unsupported symbol: %s", symbol)
-	}
+// UseRateLimiter replaces the default per-minute call budget.
+func (c *CoinGeckoClient) UseRateLimiter(limiter *RateLimiter) {
+	c.limiter = limiter
+}
 
-	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=usd", c.baseURL, coinId)
-	
-	resp, err := c.httpClient.Get(url)
+// RateLimiter returns the call budget shared by all calls.
+func (c *CoinGeckoClient) RateLimiter() *RateLimiter {
+	return c.limiter
+}
+
+// GetPrice fetches the price of the coin with CoinGecko ID coinID (e.g.
+// "bitcoin") in vsCurrency (e.g. "usd").
+func (c *CoinGeckoClient) GetPrice(ctx context.Context, coinID, vsCurrency string) (*CoinGeckoPrice, error) {
+	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=%s", c.baseURL, coinID, vsCurrency)
+
+	resp, err := do(ctx, c.httpClient, c.limiter, c.retry, "simple/price", 1, url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch price: %v", err)
+		return nil, fmt.Errorf("failed to fetch price: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("coingecko API error: %d - %s", resp.StatusCode, string(body))
+		return nil, apiError("coingecko", resp)
 	}
 
 	// CoinGecko returns nested structure: {"bitcoin": {"usd": 26543.21}}
-	var priceData map[string]CoinGeckoPrice
+	var priceData map[string]map[string]decimal.Decimal
 	if err := json.NewDecoder(resp.Body).Decode(&priceData); err != nil {
 		return nil, fmt.Errorf("failed to decode price response: %v", err)
 	}
 
-	price, exists := priceData[coinId]
+	price, exists := priceData[coinID][vsCurrency]
 	if !exists {
-		return nil, fmt.Errorf("price not found for %s", coinId)
+		return nil, fmt.Errorf("price not found for %s in %s", coinID, vsCurrency)
 	}
 
-	return &price, nil
+	return &CoinGeckoPrice{ID: coinID, Currency: vsCurrency, Price: price}, nil
 }
 
-// Convert trading symbol to CoinGecko coin ID
-func (c *CoinGeckoClient) symbolToCoinGeckoId(symbol string) string {
-	// Remove USDT suffix and convert to lowercase
-	base := strings.TrimSuffix(symbol, "USDT")
-	base = strings.TrimSuffix(base, "BUSD")
-	base = strings.ToLower(base)
-
-	// Map common symbols to CoinGecko IDs
-	symbolMap := map[string]string{
-		"btc":  "bitcoin",
-		"eth":  "ethereum",
-		"bnb":  "binancecoin",
-		"ada":  "cardano",
-		"dot":  "polkadot",
-		"link": "chainlink",
-		"ltc":  "litecoin",
-		"xrp":  "ripple",
-		"sol":  "solana",
-		"matic": "matic-network",
-		"avax": "avalanche-2",
-		"atom": "cosmos",
-		"near": "near",
-		"ftm":  "fantom",
-		"algo": "algorand",
-		"vet":  "vechain",
-		"icp":  "internet-computer",
-		"fil":  "filecoin",
-		"trx":  "tron",
-		"xlm":  "stellar",
-		"aave": "aave",
-		"uni":  "uniswap",
+// coinGeckoMaxPerPage is the most markets /coins/markets returns per call.
+const coinGeckoMaxPerPage = 250
+
+// GetMarket fetches the price and 24h statistics of the coin with CoinGecko
+// ID coinID in vsCurrency.
+func (c *CoinGeckoClient) GetMarket(ctx context.Context, coinID, vsCurrency string) (*CoinGeckoMarket, error) {
+	markets, err := c.GetMarkets(ctx, []string{coinID}, vsCurrency)
+	if err != nil {
+		return nil, err
+	}
+	if len(markets) == 0 {
+		return nil, fmt.Errorf("market not found for %s in %s", coinID, vsCurrency)
 	}
+	return &markets[0], nil
+}
 
-	if coinId, exists := symbolMap[base]; exists {
-		return coinId
+// GetMarkets fetches the markets of several coins in vsCurrency, in calls of
+// up to 250 coins. Coins CoinGecko does not know are left out.
+func (c *CoinGeckoClient) GetMarkets(ctx context.Context, coinIDs []string, vsCurrency string) ([]CoinGeckoMarket, error) {
+	var result []CoinGeckoMarket
+	for start := 0; start < len(coinIDs); start += coinGeckoMaxPerPage {
+		ids := coinIDs[start:min(start+coinGeckoMaxPerPage, len(coinIDs))]
+		markets, err := c.getMarketsPage(ctx, ids, vsCurrency)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, markets...)
 	}
+	return result, nil
+}
+
+func (c *CoinGeckoClient) getMarketsPage(ctx context.Context, coinIDs []string, vsCurrency string) ([]CoinGeckoMarket, error) {
+	endpoint := fmt.Sprintf("%s/coins/markets?vs_currency=%s&ids=%s&per_page=%d",
+		c.baseURL, url.QueryEscape(vsCurrency), url.QueryEscape(strings.Join(coinIDs, ",")), coinGeckoMaxPerPage)
 
-	// For unknown symbols, try the base name directly
-	return base
-}
\ No newline at end of file
+	resp, err := do(ctx, c.httpClient, c.limiter, c.retry, "coins/markets", 1, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch markets: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError("coingecko", resp)
+	}
+
+	var markets []CoinGeckoMarket
+	if err := json.NewDecoder(resp.Body).Decode(&markets); err != nil {
+		return nil, fmt.Errorf("failed to decode markets response: %v", err)
+	}
+
+	return markets, nil
+}
+
+// GetCoinsList fetches the ID, ticker and name of every coin CoinGecko tracks.
+func (c *CoinGeckoClient) GetCoinsList(ctx context.Context) ([]CoinGeckoCoin, error) {
+	url := fmt.Sprintf("%s/coins/list", c.baseURL)
+
+	resp, err := do(ctx, c.httpClient, c.limiter, c.retry, "coins/list", 1, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch coins list: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError("coingecko", resp)
+	}
+
+	var coins []CoinGeckoCoin
+	if err := json.NewDecoder(resp.Body).Decode(&coins); err != nil {
+		return nil, fmt.Errorf("failed to decode coins list: %v", err)
+	}
+
+	return coins, nil
+}
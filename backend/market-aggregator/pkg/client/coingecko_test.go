@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoinGeckoClient_GetPrice_KeepsSmallPrices(t *testing.T) {
+	// CoinGecko sends tiny prices as JSON numbers in exponent form
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "shiba-inu", r.URL.Query().Get("ids"))
+		assert.Equal(t, "usd", r.URL.Query().Get("vs_currencies"))
+		w.Write([]byte(`{"shiba-inu":{"usd":1.234e-05}}`))
+	}))
+	defer server.Close()
+
+	c := NewCoinGeckoClient(DefaultCoinGeckoConfig())
+	c.baseURL = server.URL
+
+	price, err := c.GetPrice(context.Background(), "shiba-inu", "usd")
+
+	require.NoError(t, err)
+	assert.Equal(t, "0.00001234", price.Price.String())
+}
+
+func TestCoinGeckoClient_GetCoinsList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/coins/list", r.URL.Path)
+		w.Write([]byte(`[{"id":"bitcoin","symbol":"btc","name":"Bitcoin"},{"id":"batcoin","symbol":"btc","name":"BatCoin"}]`))
+	}))
+	defer server.Close()
+
+	c := NewCoinGeckoClient(DefaultCoinGeckoConfig())
+	c.baseURL = server.URL
+
+	coins, err := c.GetCoinsList(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, []CoinGeckoCoin{
+		{ID: "bitcoin", Symbol: "btc", Name: "Bitcoin"},
+		{ID: "batcoin", Symbol: "btc", Name: "BatCoin"},
+	}, coins)
+}
+
+func TestCoinGeckoClient_GetMarket(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/coins/markets", r.URL.Path)
+		assert.Equal(t, "bitcoin", r.URL.Query().Get("ids"))
+		assert.Equal(t, "usd", r.URL.Query().Get("vs_currency"))
+		w.Write([]byte(`[{"id":"bitcoin","symbol":"btc","current_price":26543.21,"market_cap":517000000000,
+			"total_volume":1.2e10,"high_24h":27100,"low_24h":null,"price_change_percentage_24h":-1.25,
+			"last_updated":"2024-01-02T03:04:05.678Z"}]`))
+	}))
+	defer server.Close()
+
+	c := NewCoinGeckoClient(DefaultCoinGeckoConfig())
+	c.baseURL = server.URL
+
+	market, err := c.GetMarket(context.Background(), "bitcoin", "usd")
+
+	require.NoError(t, err)
+	assert.Equal(t, "26543.21", market.CurrentPrice.String())
+	assert.Equal(t, "12000000000", market.TotalVolume.Decimal.String())
+	assert.Equal(t, "-1.25", market.PriceChangePercentage24h.Decimal.String())
+	assert.True(t, market.High24h.Valid)
+	assert.False(t, market.Low24h.Valid)
+	assert.Equal(t, int64(1704164645), market.LastUpdated.Unix())
+}
+
+func TestCoinGeckoClient_GetMarkets_Chunks(t *testing.T) {
+	var calls []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := strings.Split(r.URL.Query().Get("ids"), ",")
+		calls = append(calls, len(ids))
+		w.Write([]byte(`[{"id":"` + ids[0] + `","current_price":1}]`))
+	}))
+	defer server.Close()
+
+	c := NewCoinGeckoClient(DefaultCoinGeckoConfig())
+	c.baseURL = server.URL
+
+	coinIDs := make([]string, 300)
+	for i := range coinIDs {
+		coinIDs[i] = fmt.Sprintf("coin-%d", i)
+	}
+	markets, err := c.GetMarkets(context.Background(), coinIDs, "usd")
+
+	require.NoError(t, err)
+	assert.Equal(t, []int{250, 50}, calls)
+	require.Len(t, markets, 2)
+	assert.Equal(t, "coin-250", markets[1].ID)
+}
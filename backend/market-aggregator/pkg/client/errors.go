@@ -0,0 +1,51 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// BinanceInvalidSymbol is Binance's error code for a symbol it does not list.
+const BinanceInvalidSymbol = -1121
+
+// APIError is an error status answered by a venue. Code and Message are the
+// venue's own when its body carries them, as Binance's
+// {"code":-1121,"msg":"Invalid symbol."} does.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Code       int
+	Message    string
+
+	body string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error: %d - %s", e.Provider, e.StatusCode, e.body)
+}
+
+// ClientError reports whether the venue rejected the request itself, e.g. for
+// an unknown symbol, rather than failing to serve it. Rate limiting never
+// arrives as an APIError; it is ErrRateLimited.
+func (e *APIError) ClientError() bool {
+	return e.StatusCode >= http.StatusBadRequest && e.StatusCode < http.StatusInternalServerError &&
+		e.StatusCode != http.StatusTooManyRequests && e.StatusCode != http.StatusTeapot
+}
+
+// apiError reads the error response resp into an APIError.
+func apiError(provider string, resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	e := &APIError{Provider: provider, StatusCode: resp.StatusCode, body: string(body)}
+
+	var venueErr struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if json.Unmarshal(body, &venueErr) == nil {
+		e.Code = venueErr.Code
+		e.Message = venueErr.Msg
+	}
+	return e
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "market_aggregator",
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of upstream API calls by provider and endpoint.",
+		Buckets:   []float64{.025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"provider", "endpoint"})
+
+	upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "market_aggregator",
+		Name:      "upstream_errors_total",
+		Help:      "Failed upstream API calls by provider, endpoint and reason: rate_limited, canceled, http or transport.",
+	}, []string{"provider", "endpoint", "reason"})
+
+	upstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "market_aggregator",
+		Name:      "upstream_retries_total",
+		Help:      "Upstream API calls retried by provider, endpoint and reason: transport, server_error or rate_limited.",
+	}, []string{"provider", "endpoint", "reason"})
+)
+
+// observe records an upstream call made through do. Calls refused by the
+// limiter count as errors without a latency.
+func observe(provider, endpoint string, latency time.Duration, status int, err error) {
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		upstreamErrors.WithLabelValues(provider, endpoint, "rate_limited").Inc()
+		if status == 0 {
+			return
+		}
+	case errors.Is(err, context.Canceled):
+		// The caller gave up; the venue is not to blame
+		upstreamErrors.WithLabelValues(provider, endpoint, "canceled").Inc()
+		return
+	case err != nil:
+		upstreamErrors.WithLabelValues(provider, endpoint, "transport").Inc()
+	case status < 200 || status > 299:
+		upstreamErrors.WithLabelValues(provider, endpoint, "http").Inc()
+	}
+	upstreamDuration.WithLabelValues(provider, endpoint).Observe(latency.Seconds())
+}
+
+var (
+	rateLimitLimitDesc = prometheus.NewDesc("market_aggregator_upstream_rate_limit",
+		"Request weight allowed per window.", []string{"provider"}, nil)
+	rateLimitUsedDesc = prometheus.NewDesc("market_aggregator_upstream_rate_limit_used",
+		"Request weight used in the current window.", []string{"provider"}, nil)
+	rateLimitBannedDesc = prometheus.NewDesc("market_aggregator_upstream_rate_limit_banned",
+		"1 while the venue has told us to back off.", []string{"provider"}, nil)
+	rateLimitThrottledDesc = prometheus.NewDesc("market_aggregator_upstream_rate_limit_throttled_total",
+		"Requests that waited for budget.", []string{"provider"}, nil)
+	rateLimitRejectedDesc = prometheus.NewDesc("market_aggregator_upstream_rate_limit_rejected_total",
+		"Requests refused for lack of budget.", []string{"provider"}, nil)
+	rateLimitWeightDesc = prometheus.NewDesc("market_aggregator_upstream_weight_total",
+		"Request weight spent by endpoint.", []string{"provider", "endpoint"}, nil)
+)
+
+// rateLimitCollector exports the budgets of limiters to Prometheus.
+type rateLimitCollector []*RateLimiter
+
+// NewRateLimitCollector reports the budget of each limiter, labelled by its
+// name.
+func NewRateLimitCollector(limiters ...*RateLimiter) prometheus.Collector {
+	return rateLimitCollector(limiters)
+}
+
+func (c rateLimitCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rateLimitLimitDesc
+	ch <- rateLimitUsedDesc
+	ch <- rateLimitBannedDesc
+	ch <- rateLimitThrottledDesc
+	ch <- rateLimitRejectedDesc
+	ch <- rateLimitWeightDesc
+}
+
+func (c rateLimitCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, limiter := range c {
+		collectRateLimit(ch, limiter.Stats())
+	}
+}
+
+func collectRateLimit(ch chan<- prometheus.Metric, stats RateLimitStats) {
+	banned := 0.0
+	if stats.BannedUntil != nil {
+		banned = 1
+	}
+	ch <- prometheus.MustNewConstMetric(rateLimitLimitDesc, prometheus.GaugeValue, float64(stats.Limit), stats.Name)
+	ch <- prometheus.MustNewConstMetric(rateLimitUsedDesc, prometheus.GaugeValue, float64(stats.Used), stats.Name)
+	ch <- prometheus.MustNewConstMetric(rateLimitBannedDesc, prometheus.GaugeValue, banned, stats.Name)
+	ch <- prometheus.MustNewConstMetric(rateLimitThrottledDesc, prometheus.CounterValue, float64(stats.Throttled), stats.Name)
+	ch <- prometheus.MustNewConstMetric(rateLimitRejectedDesc, prometheus.CounterValue, float64(stats.Rejected), stats.Name)
+	for endpoint, weight := range stats.Endpoints {
+		ch <- prometheus.MustNewConstMetric(rateLimitWeightDesc, prometheus.CounterValue, float64(weight), stats.Name, endpoint)
+	}
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrRateLimited is returned when a request would exceed the upstream budget
+// for longer than the limiter may wait, or while the venue has told us to
+// back off.
+var ErrRateLimited = errors.New("upstream rate limit reached")
+
+type RateLimitConfig struct {
+	// Limit is the weight we allow ourselves per Window, kept below the
+	// venue's hard limit
+	Limit int
+	// Window is the budget period; budgets reset at multiples of it
+	Window time.Duration
+	// MaxWait is the longest a request is queued for budget before failing
+	MaxWait time.Duration
+	// UsedWeightHeader reports the weight the venue has counted this window
+	UsedWeightHeader string
+}
+
+// DefaultBinanceRateLimit keeps below Binance's 6000 request weight per
+// minute per IP.
+func DefaultBinanceRateLimit() RateLimitConfig {
+	return RateLimitConfig{
+		Limit:            5000,
+		Window:           time.Minute,
+		MaxWait:          2 * time.Second,
+		UsedWeightHeader: "X-MBX-USED-WEIGHT-1M",
+	}
+}
+
+// DefaultCoinGeckoRateLimit matches CoinGecko's public API, which allows
+// about 30 calls per minute and reports no usage headers.
+func DefaultCoinGeckoRateLimit() RateLimitConfig {
+	return RateLimitConfig{
+		Limit:   30,
+		Window:  time.Minute,
+		MaxWait: 2 * time.Second,
+	}
+}
+
+// RateLimitStats is a snapshot of a limiter's budget.
+type RateLimitStats struct {
+	Name        string         `json:"name"`
+	Limit       int            `json:"limit"`
+	Used        int            `json:"used"`
+	ResetAt     time.Time      `json:"resetAt"`
+	BannedUntil *time.Time     `json:"bannedUntil,omitempty"`
+	Throttled   int64          `json:"throttled"`
+	Rejected    int64          `json:"rejected"`
+	Endpoints   map[string]int `json:"endpoints"`
+}
+
+// RateLimiter budgets request weight in fixed windows. Requests that would
+// overrun the budget wait for the next window when that is soon enough and
+// fail with ErrRateLimited otherwise. The venue's own count, when it sends
+// one, raises ours if it is higher, and 429/418 responses stop all requests
+// until their Retry-After has passed.
+type RateLimiter struct {
+	name   string
+	config RateLimitConfig
+	now    func() time.Time
+	sleep  func(context.Context, time.Duration) error
+
+	mu          sync.Mutex
+	windowStart time.Time
+	used        int
+	bannedUntil time.Time
+	throttled   int64
+	rejected    int64
+	// Weight spent per endpoint since start
+	endpoints map[string]int
+}
+
+func NewRateLimiter(name string, config RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		name:      name,
+		config:    config,
+		now:       time.Now,
+		sleep:     sleep,
+		endpoints: make(map[string]int),
+	}
+}
+
+// Acquire reserves weight for a request to endpoint, waiting up to MaxWait.
+// It does not wait past ctx's deadline and stops waiting when ctx is done.
+func (l *RateLimiter) Acquire(ctx context.Context, endpoint string, weight int) error {
+	waited := false
+	for {
+		l.mu.Lock()
+		now := l.now()
+		l.roll(now)
+
+		var wait time.Duration
+		switch {
+		case now.Before(l.bannedUntil):
+			wait = l.bannedUntil.Sub(now)
+		case l.used+weight > l.config.Limit && l.used > 0:
+			wait = l.windowStart.Add(l.config.Window).Sub(now)
+		default:
+			l.used += weight
+			l.endpoints[endpoint] += weight
+			l.mu.Unlock()
+			return nil
+		}
+
+		if wait > l.config.MaxWait {
+			l.rejected++
+			l.mu.Unlock()
+			return fmt.Errorf("%w: %s budget exhausted for %s", ErrRateLimited, l.name, wait.Round(time.Second))
+		}
+		if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+			l.rejected++
+			l.mu.Unlock()
+			return fmt.Errorf("%w: %s budget exhausted past the request deadline", ErrRateLimited, l.name)
+		}
+		if !waited {
+			l.throttled++
+			waited = true
+		}
+		l.mu.Unlock()
+		if err := l.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// roll starts a new window once the current one has passed.
+func (l *RateLimiter) roll(now time.Time) {
+	start := now.Truncate(l.config.Window)
+	if start.After(l.windowStart) {
+		l.windowStart = start
+		l.used = 0
+	}
+}
+
+// Update applies the venue's view of our budget from a response.
+func (l *RateLimiter) Update(resp *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.roll(now)
+
+	if l.config.UsedWeightHeader != "" {
+		// The venue counted this request before others we have reserved
+		// weight for reached it, so its count never lowers ours
+		if used, err := strconv.Atoi(resp.Header.Get(l.config.UsedWeightHeader)); err == nil && used > l.used {
+			l.used = used
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		until := now.Add(retryAfter(resp))
+		if until.After(l.bannedUntil) {
+			l.bannedUntil = until
+		}
+	}
+}
+
+// retryAfter reads Retry-After in seconds. Without it the rest of the window
+// is assumed for 429 and a few minutes for 418, which is an IP ban.
+func retryAfter(resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if resp.StatusCode == http.StatusTeapot {
+		return 2 * time.Minute
+	}
+	return time.Minute
+}
+
+func (l *RateLimiter) Stats() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.roll(now)
+
+	stats := RateLimitStats{
+		Name:      l.name,
+		Limit:     l.config.Limit,
+		Used:      l.used,
+		ResetAt:   l.windowStart.Add(l.config.Window),
+		Throttled: l.throttled,
+		Rejected:  l.rejected,
+		Endpoints: make(map[string]int, len(l.endpoints)),
+	}
+	if now.Before(l.bannedUntil) {
+		until := l.bannedUntil
+		stats.BannedUntil = &until
+	}
+	for endpoint, weight := range l.endpoints {
+		stats.Endpoints[endpoint] = weight
+	}
+	return stats
+}
+
+// do sends a GET through limiter, retrying failures the policy allows.
+// 429 and 418 become ErrRateLimited; other error statuses are returned as
+// responses once retries are exhausted. Every attempt's latency and outcome
+// is recorded.
+func do(ctx context.Context, httpClient *http.Client, limiter *RateLimiter, retry RetryPolicy, endpoint string, weight int, url string) (*http.Response, error) {
+	ctx, span := tracer.Start(ctx, limiter.name+" "+endpoint, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("upstream.provider", limiter.name),
+			attribute.String("upstream.endpoint", endpoint),
+			attribute.Int("upstream.weight", weight),
+			attribute.String("http.request.method", http.MethodGet),
+			attribute.String("url.full", url),
+		))
+	defer span.End()
+
+	for attempt := 1; ; attempt++ {
+		resp, status, err := send(ctx, httpClient, limiter, endpoint, weight, url)
+		reason, retryable := classify(ctx, status, err)
+
+		var delay time.Duration
+		if retryable && attempt < retry.MaxAttempts {
+			delay = retry.delay(attempt)
+			if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+				retryable = false
+			}
+		}
+		if !retryable || attempt >= retry.MaxAttempts {
+			span.SetAttributes(attribute.Int("upstream.attempts", attempt))
+			if status != 0 {
+				span.SetAttributes(attribute.Int("http.response.status_code", status))
+			}
+			if err != nil {
+				recordSpanError(span, err)
+				return nil, err
+			}
+			if status >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, resp.Status)
+			}
+			return resp, nil
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		upstreamRetries.WithLabelValues(limiter.name, endpoint, reason).Inc()
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("upstream.attempt", attempt),
+			attribute.String("upstream.reason", reason),
+		))
+		log.Warn().Err(err).Int("status", status).Str("provider", limiter.name).Str("endpoint", endpoint).
+			Int("attempt", attempt).Dur("delay", delay).Str("reason", reason).Msg("Upstream call failed, retrying")
+
+		if err := sleep(ctx, delay); err != nil {
+			recordSpanError(span, err)
+			return nil, err
+		}
+	}
+}
+
+// send makes a single attempt. status is zero when no response arrived.
+func send(ctx context.Context, httpClient *http.Client, limiter *RateLimiter, endpoint string, weight int, url string) (*http.Response, int, error) {
+	if err := limiter.Acquire(ctx, endpoint, weight); err != nil {
+		observe(limiter.name, endpoint, 0, 0, err)
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		observe(limiter.name, endpoint, time.Since(start), 0, err)
+		return nil, 0, err
+	}
+	limiter.Update(resp)
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		resp.Body.Close()
+		err = fmt.Errorf("%w: %s answered %d", ErrRateLimited, limiter.name, resp.StatusCode)
+		observe(limiter.name, endpoint, time.Since(start), resp.StatusCode, err)
+		return nil, resp.StatusCode, err
+	}
+	observe(limiter.name, endpoint, time.Since(start), resp.StatusCode, nil)
+	return resp, resp.StatusCode, nil
+}
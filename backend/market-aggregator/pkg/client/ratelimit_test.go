@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock drives a limiter's now and sleep without waiting.
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func newTestLimiter(config RateLimitConfig, start time.Time) (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{now: start}
+	limiter := NewRateLimiter("test", config)
+	limiter.now = clock.Now
+	limiter.sleep = clock.Sleep
+	return limiter, clock
+}
+
+func TestRateLimiter_WaitsForNextWindow(t *testing.T) {
+	// Arrange
+	config := RateLimitConfig{Limit: 10, Window: time.Minute, MaxWait: 5 * time.Second}
+	limiter, clock := newTestLimiter(config, time.Date(2024, 1, 1, 0, 0, 58, 0, time.UTC))
+
+	// Act
+	require.NoError(t, limiter.Acquire(context.Background(), "depth", 5))
+	require.NoError(t, limiter.Acquire(context.Background(), "depth", 5))
+	err := limiter.Acquire(context.Background(), "klines", 2)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{2 * time.Second}, clock.slept)
+	stats := limiter.Stats()
+	assert.Equal(t, 2, stats.Used)
+	assert.Equal(t, int64(1), stats.Throttled)
+	assert.Equal(t, map[string]int{"depth": 10, "klines": 2}, stats.Endpoints)
+}
+
+func TestRateLimiter_RejectsBeyondMaxWait(t *testing.T) {
+	// Arrange
+	config := RateLimitConfig{Limit: 10, Window: time.Minute, MaxWait: 2 * time.Second}
+	limiter, clock := newTestLimiter(config, time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC))
+	require.NoError(t, limiter.Acquire(context.Background(), "depth", 10))
+
+	// Act
+	err := limiter.Acquire(context.Background(), "depth", 1)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Empty(t, clock.slept)
+	stats := limiter.Stats()
+	assert.Equal(t, 10, stats.Used)
+	assert.Equal(t, int64(1), stats.Rejected)
+}
+
+func TestRateLimiter_UsesVenueWeight(t *testing.T) {
+	// Arrange
+	config := DefaultBinanceRateLimit()
+	limiter, _ := newTestLimiter(config, time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC))
+	require.NoError(t, limiter.Acquire(context.Background(), "exchangeInfo", 20))
+
+	// Act
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	resp.Header.Set("X-MBX-USED-WEIGHT-1M", "4995")
+	limiter.Update(resp)
+	err := limiter.Acquire(context.Background(), "depth", 25)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, 4995, limiter.Stats().Used)
+}
+
+func TestRateLimiter_VenueWeightKeepsConcurrentReservations(t *testing.T) {
+	// Arrange: every response reports only its own request, as if it was
+	// counted before the others reached the venue
+	config := DefaultBinanceRateLimit()
+	limiter, _ := newTestLimiter(config, time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC))
+
+	// Act
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limiter.Acquire(context.Background(), "depth", 10); err != nil {
+				return
+			}
+			resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+			resp.Header.Set("X-MBX-USED-WEIGHT-1M", "10")
+			limiter.Update(resp)
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, 500, limiter.Stats().Used)
+}
+
+func TestBinanceClient_BacksOffAfter429(t *testing.T) {
+	// Arrange
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c := NewBinanceClient(DefaultBinanceConfig())
+	c.baseURL = server.URL
+
+	// Act
+	_, first := c.Get24hrTicker(context.Background(), "BTCUSDT")
+	_, second := c.Get24hrTicker(context.Background(), "BTCUSDT")
+
+	// Assert
+	assert.ErrorIs(t, first, ErrRateLimited)
+	assert.ErrorIs(t, second, ErrRateLimited)
+	assert.Equal(t, 1, calls)
+	stats := c.RateLimiter().Stats()
+	require.NotNil(t, stats.BannedUntil)
+	assert.WithinDuration(t, time.Now().Add(30*time.Second), *stats.BannedUntil, 5*time.Second)
+}
+
+func TestBinanceWeights(t *testing.T) {
+	assert.Equal(t, 2, tickersWeight(1))
+	assert.Equal(t, 40, tickersWeight(21))
+	assert.Equal(t, 80, tickersWeight(0))
+	assert.Equal(t, 5, depthWeight(100))
+	assert.Equal(t, 25, depthWeight(500))
+	assert.Equal(t, 250, depthWeight(5000))
+}
+
+func TestRateLimitCollector(t *testing.T) {
+	// Arrange
+	config := RateLimitConfig{Limit: 10, Window: time.Minute, MaxWait: time.Second}
+	binance, _ := newTestLimiter(config, time.Now())
+	binance.name = "binance"
+	coinGecko, _ := newTestLimiter(config, time.Now())
+	coinGecko.name = "coingecko"
+	require.NoError(t, binance.Acquire(context.Background(), "depth", 5))
+
+	// Act
+	collector := NewRateLimitCollector(binance, coinGecko)
+
+	// Assert
+	expected := `
+# HELP market_aggregator_upstream_rate_limit_used Request weight used in the current window.
+# TYPE market_aggregator_upstream_rate_limit_used gauge
+market_aggregator_upstream_rate_limit_used{provider="binance"} 5
+market_aggregator_upstream_rate_limit_used{provider="coingecko"} 0
+# HELP market_aggregator_upstream_weight_total Request weight spent by endpoint.
+# TYPE market_aggregator_upstream_weight_total counter
+market_aggregator_upstream_weight_total{endpoint="depth",provider="binance"} 5
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"market_aggregator_upstream_rate_limit_used", "market_aggregator_upstream_weight_total"))
+}
+
+func TestDo_RecordsUpstreamErrors(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	limiter := NewRateLimiter("metrics-test", DefaultBinanceRateLimit())
+	httpErrors := upstreamErrors.WithLabelValues("metrics-test", "klines", "http")
+	before := testutil.ToFloat64(httpErrors)
+
+	// Act
+	resp, err := do(context.Background(), http.DefaultClient, limiter, RetryPolicy{MaxAttempts: 1}, "klines", 2, server.URL)
+
+	// Assert
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, before+1, testutil.ToFloat64(httpErrors))
+}
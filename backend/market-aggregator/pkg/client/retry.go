@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy retries upstream calls that failed for a reason likely to
+// pass: transport errors, 5xx responses and 429s. Every call made through do
+// is a GET and safe to repeat. Waits grow exponentially from BaseDelay up to
+// MaxDelay with jitter, and a retry whose wait would pass the request's
+// deadline is not attempted.
+type RetryPolicy struct {
+	// MaxAttempts counts the first call; 1 disables retries
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+	}
+}
+
+// Reasons an upstream call failed, as used in metrics.
+const (
+	ReasonTransport   = "transport"
+	ReasonServerError = "server_error"
+	ReasonRateLimited = "rate_limited"
+	ReasonClientError = "client_error"
+	ReasonCanceled    = "canceled"
+)
+
+// classify tells why an attempt failed and whether retrying may help. The
+// reason is empty when the attempt succeeded.
+func classify(ctx context.Context, status int, err error) (reason string, retryable bool) {
+	switch {
+	case ctx.Err() != nil || errors.Is(err, context.Canceled):
+		return ReasonCanceled, false
+	case errors.Is(err, ErrRateLimited):
+		// A 429 clears once the limiter has waited out its Retry-After; a
+		// 418 is an IP ban, and refusals by our own limiter already waited
+		// as long as they may
+		return ReasonRateLimited, status == http.StatusTooManyRequests
+	case err != nil:
+		return ReasonTransport, true
+	case status >= http.StatusInternalServerError:
+		return ReasonServerError, true
+	case status >= http.StatusBadRequest:
+		return ReasonClientError, false
+	}
+	return "", false
+}
+
+// delay is the wait before retry n, counting from 1: BaseDelay doubled per
+// retry up to MaxDelay, of which the upper half is random so callers that
+// failed together do not retry together.
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.BaseDelay << (n - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
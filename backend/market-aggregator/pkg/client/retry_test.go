@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer fails the first failures requests with fail and answers the
+// rest with body.
+func flakyServer(t *testing.T, failures int32, fail http.HandlerFunc, body string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			fail(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func status(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
+
+// dropConnection closes the connection without answering.
+func dropConnection(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func newRetryingBinanceClient(baseURL string) *BinanceClient {
+	config := DefaultBinanceConfig()
+	config.BaseURL = baseURL
+	config.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	return NewBinanceClient(config)
+}
+
+const depthBody = `{"lastUpdateId":1,"bids":[["26500.00","1.5"]],"asks":[["26501.00","0.5"]]}`
+
+func TestBinanceClient_RetriesServerErrors(t *testing.T) {
+	// Arrange
+	server, calls := flakyServer(t, 2, status(http.StatusServiceUnavailable), depthBody)
+	c := newRetryingBinanceClient(server.URL)
+	retries := upstreamRetries.WithLabelValues("binance", "depth", ReasonServerError)
+	before := testutil.ToFloat64(retries)
+
+	// Act
+	depth, err := c.GetDepth(context.Background(), "BTCUSDT", 100)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), depth.LastUpdateId)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+	assert.Equal(t, before+2, testutil.ToFloat64(retries))
+}
+
+func TestBinanceClient_RetriesDroppedConnections(t *testing.T) {
+	// Arrange
+	server, calls := flakyServer(t, 1, dropConnection, `[]`)
+	c := newRetryingBinanceClient(server.URL)
+	retries := upstreamRetries.WithLabelValues("binance", "klines", ReasonTransport)
+	before := testutil.ToFloat64(retries)
+
+	// Act
+	klines, err := c.GetKlines(context.Background(), "BTCUSDT", "1m", 10)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, klines)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	assert.Equal(t, before+1, testutil.ToFloat64(retries))
+}
+
+func TestBinanceClient_RetriesTooManyRequests(t *testing.T) {
+	// Arrange
+	retryNow := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	server, calls := flakyServer(t, 1, retryNow, depthBody)
+	c := newRetryingBinanceClient(server.URL)
+
+	// Act
+	_, err := c.GetDepth(context.Background(), "BTCUSDT", 100)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestBinanceClient_DoesNotRetryClientErrors(t *testing.T) {
+	// Arrange
+	server, calls := flakyServer(t, 1, status(http.StatusBadRequest), depthBody)
+	c := newRetryingBinanceClient(server.URL)
+
+	// Act
+	_, err := c.GetDepth(context.Background(), "BTCUSDT", 100)
+
+	// Assert
+	assert.ErrorContains(t, err, "binance API error: 400")
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestBinanceClient_GivesUpAfterMaxAttempts(t *testing.T) {
+	// Arrange
+	server, calls := flakyServer(t, 5, status(http.StatusBadGateway), depthBody)
+	c := newRetryingBinanceClient(server.URL)
+
+	// Act
+	_, err := c.GetDepth(context.Background(), "BTCUSDT", 100)
+
+	// Assert
+	assert.ErrorContains(t, err, "binance API error: 502")
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestBinanceClient_DoesNotRetryPastDeadline(t *testing.T) {
+	// Arrange
+	server, calls := flakyServer(t, 1, status(http.StatusInternalServerError), depthBody)
+	config := DefaultBinanceConfig()
+	config.BaseURL = server.URL
+	config.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second}
+	c := NewBinanceClient(config)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// Act
+	start := time.Now()
+	_, err := c.GetDepth(ctx, "BTCUSDT", 100)
+
+	// Assert
+	assert.ErrorContains(t, err, "binance API error: 500")
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestCoinGeckoClient_RetriesServerErrors(t *testing.T) {
+	// Arrange
+	server, calls := flakyServer(t, 1, status(http.StatusInternalServerError), `{"bitcoin":{"usd":26543.21}}`)
+	config := DefaultCoinGeckoConfig()
+	config.BaseURL = server.URL
+	config.Retry = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	c := NewCoinGeckoClient(config)
+
+	// Act
+	price, err := c.GetPrice(context.Background(), "bitcoin", "usd")
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "26543.21", price.Price.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+
+	for n, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 10: 300 * time.Millisecond} {
+		for i := 0; i < 20; i++ {
+			delay := policy.delay(n)
+			assert.GreaterOrEqual(t, delay, max/2)
+			assert.LessOrEqual(t, delay, max)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	ctx := context.Background()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	cases := []struct {
+		status    int
+		err       error
+		ctx       context.Context
+		reason    string
+		retryable bool
+	}{
+		{http.StatusOK, nil, ctx, "", false},
+		{http.StatusServiceUnavailable, nil, ctx, ReasonServerError, true},
+		{http.StatusNotFound, nil, ctx, ReasonClientError, false},
+		{http.StatusTooManyRequests, ErrRateLimited, ctx, ReasonRateLimited, true},
+		{http.StatusTeapot, ErrRateLimited, ctx, ReasonRateLimited, false},
+		{0, ErrRateLimited, ctx, ReasonRateLimited, false},
+		{0, context.DeadlineExceeded, cancelled, ReasonCanceled, false},
+		{0, assert.AnError, ctx, ReasonTransport, true},
+	}
+	for _, c := range cases {
+		reason, retryable := classify(c.ctx, c.status, c.err)
+		assert.Equal(t, c.reason, reason, "status %d, err %v", c.status, c.err)
+		assert.Equal(t, c.retryable, retryable, "status %d, err %v", c.status, c.err)
+	}
+}
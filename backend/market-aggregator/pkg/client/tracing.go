@@ -0,0 +1,16 @@
+package client
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer follows the global provider, so spans are exported once main
+// installs one and dropped before that.
+var tracer = otel.Tracer("github.com/mifasol123/cex-exchange/backend/market-aggregator/pkg/client")
+
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spanRecorder = tracetest.NewSpanRecorder()
+	installSpans sync.Once
+)
+
+// recordSpans installs a global tracer provider feeding spanRecorder. The
+// package tracer binds to the first provider installed, so tests share one
+// and tell their spans apart by trace ID.
+func recordSpans() trace.TracerProvider {
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+	installSpans.Do(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	return otel.GetTracerProvider()
+}
+
+func TestBinanceClient_PropagatesTraceContext(t *testing.T) {
+	// Arrange
+	provider := recordSpans()
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"symbol":"BTCUSDT","lastPrice":"26543.21"}`))
+	}))
+	defer server.Close()
+
+	c := NewBinanceClient(DefaultBinanceConfig())
+	c.baseURL = server.URL
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+
+	// Act
+	_, err := c.Get24hrTicker(ctx, "BTCUSDT")
+	parent.End()
+
+	// Assert
+	require.NoError(t, err)
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range spanRecorder.Ended() {
+		if span.SpanContext().TraceID() == parent.SpanContext().TraceID() {
+			spans = append(spans, span)
+		}
+	}
+	require.Len(t, spans, 2)
+	upstream := spans[0]
+	assert.Equal(t, "binance ticker/24hr", upstream.Name())
+	assert.Equal(t, trace.SpanKindClient, upstream.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), upstream.Parent().SpanID())
+	assert.Contains(t, traceparent, upstream.SpanContext().TraceID().String())
+	assert.Contains(t, traceparent, upstream.SpanContext().SpanID().String())
+}
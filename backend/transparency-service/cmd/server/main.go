@@ -78,6 +78,7 @@ func setupRouter(complianceHandler *handler.ComplianceHandler, healthHandler *ha
 	// Middlewares
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
+	router.Use(handler.Metrics())
 
 	// CORS configuration
 	corsConfig := cors.DefaultConfig()
@@ -88,6 +89,7 @@ func setupRouter(complianceHandler *handler.ComplianceHandler, healthHandler *ha
 
 	// Health check
 	router.GET("/health", healthHandler.Health)
+	router.GET("/metrics", handler.MetricsHandler())
 
 	// Compliance routes
 	compliance := router.Group("/compliance")